@@ -17,32 +17,1352 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// FailurePolicyType describes how the controller reacts to owned pods that
+// have failed.
+// +kubebuilder:validation:Enum=Replace;Halt
+type FailurePolicyType string
+
+const (
+	// ReplaceFailurePolicy deletes failed pods and creates replacements
+	// for them.
+	ReplaceFailurePolicy FailurePolicyType = "Replace"
+	// HaltFailurePolicy stops creating replacements once an owned pod has
+	// failed, until the failed pod is deleted or the spec is edited.
+	HaltFailurePolicy FailurePolicyType = "Halt"
+)
+
+// PodFailureAction is what the controller does with a failed pod matched by
+// a pod failure policy.
+// +kubebuilder:validation:Enum=Replace;Halt;Ignore
+type PodFailureAction string
+
+const (
+	// ReplacePodFailureAction deletes the failed pod and creates a
+	// replacement for it.
+	ReplacePodFailureAction PodFailureAction = "Replace"
+	// HaltPodFailureAction stops creating replacements, as the Halt failure
+	// policy does.
+	HaltPodFailureAction PodFailureAction = "Halt"
+	// IgnorePodFailureAction counts the failed pod as done, so it keeps its
+	// place among the replicas and is not replaced.
+	IgnorePodFailureAction PodFailureAction = "Ignore"
+)
+
+// PodFailurePolicy decides what to do with each failed pod by matching it
+// against ordered rules.
+type PodFailurePolicy struct {
+	// Rules are matched against a failed pod in order; the first that
+	// matches decides the action.
+	// +optional
+	Rules []PodFailurePolicyRule `json:"rules,omitempty"`
+
+	// DefaultAction applies to failed pods that match no rule. Defaults to
+	// Replace.
+	// +optional
+	// +kubebuilder:default=Replace
+	DefaultAction PodFailureAction `json:"defaultAction,omitempty"`
+}
+
+// PodFailurePolicyRule matches failed pods by the exit codes of their
+// containers and the reasons they failed. A rule matches a pod when each of
+// its non-empty criteria matches.
+type PodFailurePolicyRule struct {
+	// Action is what to do with a pod the rule matches.
+	Action PodFailureAction `json:"action"`
+
+	// ContainerName restricts ExitCodes to the container with this name.
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+
+	// ExitCodes matches pods with a container that terminated with one of
+	// these exit codes.
+	// +optional
+	ExitCodes []int32 `json:"exitCodes,omitempty"`
+
+	// Reasons matches pods whose status reason, or the reason of one of
+	// their conditions, is one of these.
+	// +optional
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// MissingReferencePolicyType describes what the controller does when the
+// pods reference objects that do not exist.
+// +kubebuilder:validation:Enum=Create;Wait
+type MissingReferencePolicyType string
+
+const (
+	// CreateMissingReferencePolicy creates pods even though they reference
+	// missing objects.
+	CreateMissingReferencePolicy MissingReferencePolicyType = "Create"
+	// WaitMissingReferencePolicy holds off creating pods until every
+	// referenced object exists.
+	WaitMissingReferencePolicy MissingReferencePolicyType = "Wait"
+)
+
+// ManagementPolicyType describes how far the controller manages a PodSet's
+// pods.
+// +kubebuilder:validation:Enum=Full;ObserveOnly
+type ManagementPolicyType string
+
+const (
+	// FullManagementPolicy creates, updates and deletes pods to match the
+	// spec.
+	FullManagementPolicy ManagementPolicyType = "Full"
+	// ObserveOnlyManagementPolicy only reports on the pods, which are
+	// created and deleted by something else.
+	ObserveOnlyManagementPolicy ManagementPolicyType = "ObserveOnly"
+)
+
+// ScaleDownActionType describes what happens to pods removed from a PodSet
+// on scale-down.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type ScaleDownActionType string
+
+const (
+	// DeleteScaleDownAction deletes the pods.
+	DeleteScaleDownAction ScaleDownActionType = "Delete"
+	// OrphanScaleDownAction releases the pods from the PodSet, leaving them
+	// running.
+	OrphanScaleDownAction ScaleDownActionType = "Orphan"
+)
+
+// PersistentVolumeClaimRetentionPolicyType is what happens to the claims of
+// spec.volumeClaimTemplates when their pods are removed.
+// +kubebuilder:validation:Enum=Retain;Delete
+type PersistentVolumeClaimRetentionPolicyType string
+
+const (
+	// RetainPersistentVolumeClaimRetentionPolicyType keeps the claims.
+	RetainPersistentVolumeClaimRetentionPolicyType PersistentVolumeClaimRetentionPolicyType = "Retain"
+	// DeletePersistentVolumeClaimRetentionPolicyType deletes the claims.
+	DeletePersistentVolumeClaimRetentionPolicyType PersistentVolumeClaimRetentionPolicyType = "Delete"
+)
+
+// ScaleDownPolicyType describes which pods are chosen for removal when a
+// PodSet scales down.
+// +kubebuilder:validation:Enum=Random;Newest;Oldest;LeastReady
+type ScaleDownPolicyType string
+
+const (
+	// RandomScaleDownPolicy removes pods chosen at random.
+	RandomScaleDownPolicy ScaleDownPolicyType = "Random"
+	// NewestScaleDownPolicy removes the most recently created pods first.
+	NewestScaleDownPolicy ScaleDownPolicyType = "Newest"
+	// OldestScaleDownPolicy removes the least recently created pods first.
+	OldestScaleDownPolicy ScaleDownPolicyType = "Oldest"
+	// LeastReadyScaleDownPolicy removes pods that are not Ready first, then
+	// the pods that have been Ready for the shortest time.
+	LeastReadyScaleDownPolicy ScaleDownPolicyType = "LeastReady"
+)
+
+// DefaultAntiAffinityType describes how strongly the pods of a PodSet avoid
+// sharing a node.
+// +kubebuilder:validation:Enum=Preferred;Required
+type DefaultAntiAffinityType string
+
+const (
+	// PreferredDefaultAntiAffinity asks the scheduler to avoid nodes that
+	// run a pod of the PodSet.
+	PreferredDefaultAntiAffinity DefaultAntiAffinityType = "Preferred"
+	// RequiredDefaultAntiAffinity forbids scheduling a pod on a node that
+	// runs a pod of the PodSet.
+	RequiredDefaultAntiAffinity DefaultAntiAffinityType = "Required"
+)
+
+// PodManagementPolicyType describes how the pods of a PodSet are named.
+// +kubebuilder:validation:Enum=Parallel;Ordered
+type PodManagementPolicyType string
+
+const (
+	// ParallelPodManagement gives pods generated names; a replaced pod gets
+	// a new one.
+	ParallelPodManagement PodManagementPolicyType = "Parallel"
+	// OrderedPodManagement names pods <name>-0 to <name>-N-1, recreates a
+	// pod that is gone under the same name, and scales down from the
+	// highest ordinal.
+	OrderedPodManagement PodManagementPolicyType = "Ordered"
+)
+
+// MislabeledPodPolicyType describes what the controller does with an owned
+// pod whose management labels were changed.
+// +kubebuilder:validation:Enum=Repair;Release
+type MislabeledPodPolicyType string
+
+const (
+	// RepairMislabeledPodPolicy restores the labels.
+	RepairMislabeledPodPolicy MislabeledPodPolicyType = "Repair"
+	// ReleaseMislabeledPodPolicy releases the pod from the PodSet, leaving
+	// it running, unmanaged.
+	ReleaseMislabeledPodPolicy MislabeledPodPolicyType = "Release"
+)
+
 // PodSetSpec defines the desired state of PodSet
+// +kubebuilder:validation:XValidation:rule="has(self.selector) == has(oldSelf.selector)",message="selector cannot be added or removed"
+// +kubebuilder:validation:XValidation:rule="has(self.podManagementPolicy) == has(oldSelf.podManagementPolicy)",message="podManagementPolicy cannot be added or removed"
+// +kubebuilder:validation:XValidation:rule="has(self.volumeClaimTemplates) == has(oldSelf.volumeClaimTemplates)",message="volumeClaimTemplates cannot be added or removed"
+// +kubebuilder:validation:XValidation:rule="!has(self.dnsPolicy) || self.dnsPolicy != 'None' || has(self.dnsConfig)",message="dnsConfig is required when dnsPolicy is None"
 type PodSetSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// +kubebuilder:validation:Minimum=1
-	// +kubebuilder:validation:Maximum=10
+	// Replicas is the number of pods to run. Zero runs none, so a PodSet
+	// can be scaled to zero and back; large scale-ups are created in
+	// batches bounded by the operator's --max-creates-per-reconcile.
+	// +kubebuilder:validation:Minimum=0
 	Replicas int32 `json:"replicas,omitempty"`
+
+	// Selector selects the PodSet's pods in place of the default app and
+	// version labels. The controller stamps its matchLabels, which must not
+	// be empty, on the pods it creates, and the template's labels must
+	// satisfy it. It cannot be added, removed or changed once the PodSet
+	// exists.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="selector is immutable"
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Template describes the pods that will be created. Its labels are
+	// merged with the labels the controller selects its pods by, which take
+	// precedence. Defaults to a single busybox container that sleeps.
+	//
+	// Container commands, args and env values may contain the placeholders
+	// {{.PodSetName}}, {{.Namespace}} (the namespace of the pods),
+	// {{.TemplateHash}} and, for an Ordered PodSet, {{.Index}} (the pod's
+	// ordinal), which are replaced when pods are created. Other
+	// placeholders are left as they are. A placeholder preceded by a
+	// backslash, as in \{{.PodSetName}}, is kept verbatim without the
+	// backslash.
+	// +optional
+	Template *corev1.PodTemplateSpec `json:"template,omitempty"`
+
+	// Resources are the compute resources of every container of the pods,
+	// merged under each container's own so that a container of the
+	// template that sets a resource keeps it. Extended resources, such as
+	// nvidia.com/gpu, are requested in whole units and a request must equal
+	// its limit. They take precedence over
+	// the defaults of the PodSet's class.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// ImagePullSecrets are added to the image pull secrets of the template,
+	// for pulling the pods' images from private registries. The secrets
+	// must exist in the namespace of the pods.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// ContainerEnv adds environment variables and sources to the containers
+	// of the pods. Variables the template already sets for a container keep
+	// the template's value. Values may contain the placeholders of
+	// template.
+	// +optional
+	ContainerEnv []ContainerEnvSpec `json:"containerEnv,omitempty"`
+
+	// Volumes are added to the volumes of the pods. A volume the template
+	// also defines keeps the template's source.
+	// +optional
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// VolumeClaimTemplates are claims the controller creates for each pod,
+	// named <claim name>-<pod name>, and adds to the pod as volumes named
+	// after the claim, replacing a volume of the template by that name.
+	// The claims of an Ordered PodSet's pods outlive them and are reused
+	// when a pod is recreated under its name; otherwise a pod's claims are
+	// deleted once it is gone. What happens to them on scale-down and when
+	// the PodSet is deleted is set by persistentVolumeClaimRetentionPolicy.
+	// The templates cannot be changed, except to grow their storage
+	// requests, which expands the existing claims where their storage class
+	// allows volume expansion.
+	// +optional
+	VolumeClaimTemplates []VolumeClaimTemplate `json:"volumeClaimTemplates,omitempty"`
+
+	// PersistentVolumeClaimRetentionPolicy decides whether the claims of
+	// spec.volumeClaimTemplates are kept or deleted when their pods are
+	// scaled down and when the PodSet is deleted. By default claims are
+	// kept on scale-down and deleted with the PodSet.
+	// +optional
+	PersistentVolumeClaimRetentionPolicy *PersistentVolumeClaimRetentionPolicy `json:"persistentVolumeClaimRetentionPolicy,omitempty"`
+
+	// VolumeMounts mount volumes of the pods, from spec.volumes,
+	// spec.volumeClaimTemplates or the template, into their containers. A container that already mounts
+	// something at a mount path keeps its own mount.
+	// +optional
+	VolumeMounts []ContainerVolumeMountsSpec `json:"volumeMounts,omitempty"`
+
+	// Probes sets the liveness, readiness and startup probes of the
+	// containers of the pods. A probe the template already sets for a
+	// container is kept. Readiness, and so availability, follows the pods'
+	// Ready condition, which these probes drive.
+	// +optional
+	Probes []ContainerProbesSpec `json:"probes,omitempty"`
+
+	// NodeSelector is merged into the node selector of the pods; keys the
+	// template also sets keep the template's value.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Affinity is the scheduling affinity of the pods when the template
+	// sets none.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Tolerations are added to the tolerations of the template.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// TopologySpreadConstraints spread the pods across topology domains, in
+	// addition to those of the template. A constraint without a
+	// labelSelector selects the PodSet's pods.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// DefaultAntiAffinity keeps the pods off nodes that already run a pod
+	// of the PodSet: Preferred asks the scheduler to avoid them, Required
+	// leaves pods pending rather than share a node. Unset adds no
+	// anti-affinity.
+	// +optional
+	DefaultAntiAffinity DefaultAntiAffinityType `json:"defaultAntiAffinity,omitempty"`
+
+	// SecurityContext is the pod-level security context of the pods when
+	// the template sets none.
+	// +optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// ContainerSecurityContext is the security context of every container
+	// and init container of the pods that the template gives none, for
+	// running as non-root, dropping capabilities or setting a seccomp
+	// profile.
+	// +optional
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+
+	// TerminationGracePeriodSeconds is how long the pods are given to shut
+	// down once deleted, when the template sets no grace period. The
+	// controller also passes it when it deletes or evicts a pod, so that it
+	// applies to pods created before it was changed.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// HostNetwork runs the pods in the network namespace of their node.
+	// Unless a DNS policy is set, the pods then resolve names with
+	// ClusterFirstWithHostNet.
+	// +optional
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+
+	// DNSPolicy is the DNS policy of the pods when the template sets none.
+	// +kubebuilder:validation:Enum=ClusterFirstWithHostNet;ClusterFirst;Default;None
+	// +optional
+	DNSPolicy corev1.DNSPolicy `json:"dnsPolicy,omitempty"`
+
+	// DNSConfig is the DNS configuration of the pods, such as custom
+	// resolvers, when the template sets none. A DNS policy of None needs
+	// one.
+	// +optional
+	DNSConfig *corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
+
+	// RuntimeClassName is the runtime class of the pods, such as a
+	// sandboxed runtime, when the template sets none. It takes precedence
+	// over the default of the PodSet's class.
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+
+	// PriorityClassName is the priority class of the pods when the
+	// template sets none. It takes precedence over the default of the
+	// PodSet's class.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// PodOverrides is a partial Pod that is applied as a strategic merge patch
+	// over the pod generated by the controller, for pod fields that have no
+	// dedicated PodSet field. It may not set metadata.ownerReferences or the
+	// labels the controller uses to select its pods. Container commands,
+	// args and env values may contain the placeholders of template.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodOverrides *runtime.RawExtension `json:"podOverrides,omitempty"`
+
+	// FailurePolicy controls whether failed pods are replaced. Defaults to
+	// Replace.
+	// +optional
+	// +kubebuilder:default=Replace
+	FailurePolicy FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// PodFailurePolicy decides per failed pod whether to replace it, halt
+	// or count it as done. When set, it takes the place of FailurePolicy.
+	// +optional
+	PodFailurePolicy *PodFailurePolicy `json:"podFailurePolicy,omitempty"`
+
+	// ReconcileInterval, when set, reconciles the PodSet again this long
+	// after each reconcile, such as 5m, so that drift the controller is
+	// not notified of is corrected. It takes the place of the operator's
+	// --reconcile-interval.
+	// +optional
+	ReconcileInterval *metav1.Duration `json:"reconcileInterval,omitempty"`
+
+	// CrashLoopRestartLimit, when set, replaces a pod with a container in
+	// CrashLoopBackOff once that container has restarted this many times,
+	// if the failure policy would replace the pod had it failed. Crash
+	// looping pods are reported in the Degraded condition either way.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	CrashLoopRestartLimit *int32 `json:"crashLoopRestartLimit,omitempty"`
+
+	// PendingTimeout flags pods that stay Pending, such as unschedulable
+	// pods or pods whose image cannot be pulled, for longer than a timeout
+	// and optionally replaces them.
+	// +optional
+	PendingTimeout *PendingTimeoutSpec `json:"pendingTimeout,omitempty"`
+
+	// Service makes the controller create a Service selecting the pods.
+	// +optional
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// DisruptionBudget makes the controller create a PodDisruptionBudget,
+	// named after the PodSet, covering the pods. Evictions through the
+	// Eviction API, including those of spec.scaleDown.useEvictionAPI, then
+	// respect it.
+	// +optional
+	DisruptionBudget *DisruptionBudgetSpec `json:"disruptionBudget,omitempty"`
+
+	// NetworkPolicy makes the controller create a NetworkPolicy, named after
+	// the PodSet, that limits the traffic of the pods.
+	// +optional
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// PodMonitor makes the controller create a prometheus-operator
+	// PodMonitor, named after the PodSet, that scrapes the pods.
+	// +optional
+	PodMonitor *PodMonitorSpec `json:"podMonitor,omitempty"`
+
+	// ServiceAccount configures a dedicated ServiceAccount for the pods.
+	// +optional
+	ServiceAccount *ServiceAccountSpec `json:"serviceAccount,omitempty"`
+
+	// NodeNames pins the pods to the listed nodes, bypassing the scheduler.
+	// Each new pod goes to the listed node with the fewest pods of this
+	// PodSet. Pods on nodes that are removed from the list are deleted and
+	// recreated on the remaining nodes.
+	// +optional
+	NodeNames []string `json:"nodeNames,omitempty"`
+
+	// Shards splits the pods into this many shards, numbered from zero. Each
+	// pod is labeled with its shard and given SHARD_ID and SHARD_COUNT
+	// environment variables. When set, the desired number of pods is
+	// shards * replicasPerShard and replicas is ignored. Changing the shard
+	// count changes SHARD_COUNT, so the pods are rolled out again.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Shards int32 `json:"shards,omitempty"`
+
+	// ReplicasPerShard is the number of pods in each shard. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ReplicasPerShard int32 `json:"replicasPerShard,omitempty"`
+
+	// TargetNamespace is the namespace the pods are created in. Defaults to
+	// the PodSet's own namespace. Namespaces other than the PodSet's must be
+	// allowed by the operator.
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// ElectLeader makes the controller label exactly one Ready pod, the
+	// oldest by default, with podset.example.com/role=leader, moving the
+	// label when that pod stops being Ready or is deleted.
+	// +optional
+	ElectLeader bool `json:"electLeader,omitempty"`
+
+	// PerPodConfig has the controller render a ConfigMap for each pod and
+	// mount it into the pod's containers.
+	// +optional
+	PerPodConfig *PerPodConfigSpec `json:"perPodConfig,omitempty"`
+
+	// UpdateStrategy controls how pods created from an earlier version of
+	// the spec are replaced. By default they are replaced one at a time.
+	// +optional
+	UpdateStrategy PodSetUpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// Paused stops the controller from creating, deleting or changing the
+	// PodSet's pods while it is true. Status is still kept up to date.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// MinReadySeconds is how long a pod must have been Ready before it
+	// counts as available: towards the Available condition and the
+	// completion of a rollout batch.
+	// Defaults to 0, counting a pod as soon as it is Ready.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+
+	// RollbackTo asks the controller to restore the pod template recorded
+	// in an earlier revision. The controller clears it once handled. The
+	// revisions are kept in ControllerRevisions labeled
+	// podset.example.com/podset=<name>.
+	// +optional
+	RollbackTo *RollbackConfig `json:"rollbackTo,omitempty"`
+
+	// HostPortRange gives each pod a host port from the range that no other
+	// pod of the PodSet holds. The port is exposed on the first container
+	// and passed to every container in the HOST_PORT environment variable.
+	// Pods are not created while the range has no free ports.
+	// +optional
+	HostPortRange *HostPortRange `json:"hostPortRange,omitempty"`
+
+	// ResourceBudget caps the total CPU and memory requested by the
+	// PodSet's pods. When the desired pods would exceed it, only as many
+	// pods as fit in the budget are run.
+	// +optional
+	ResourceBudget *ResourceBudget `json:"resourceBudget,omitempty"`
+
+	// MissingReferencePolicy controls whether pods are created while the
+	// ServiceAccount, Secrets or ConfigMaps they reference are missing.
+	// Missing objects are reported in the MissingReference condition either
+	// way. Defaults to Create.
+	// +optional
+	// +kubebuilder:default=Create
+	MissingReferencePolicy MissingReferencePolicyType `json:"missingReferencePolicy,omitempty"`
+
+	// DeletionDrain makes the controller delete the pods of a deleted PodSet
+	// gradually instead of all at once. The drain is skipped when the PodSet
+	// has the podset.example.com/force-delete=true annotation.
+	// +optional
+	DeletionDrain *DeletionDrain `json:"deletionDrain,omitempty"`
+
+	// Cleanup is teardown the controller runs when the PodSet is deleted,
+	// after its pods are gone and before the PodSet is removed.
+	// +optional
+	Cleanup *CleanupSpec `json:"cleanup,omitempty"`
+
+	// ManagementPolicy is Full, the default, for the controller to manage
+	// the pods, or ObserveOnly for it to only report on pods that are
+	// managed externally, never creating, changing or deleting them.
+	// +optional
+	// +kubebuilder:default=Full
+	ManagementPolicy ManagementPolicyType `json:"managementPolicy,omitempty"`
+
+	// ClassName selects a cluster-scoped PodSetClass whose pod defaults
+	// apply under this PodSet's own. Changes to the class roll out to the
+	// pods like changes to the PodSet.
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
+	// ColocateWith schedules the pods near the pods of other PodSets in the
+	// same namespace.
+	// +optional
+	ColocateWith []PodSetAffinityTerm `json:"colocateWith,omitempty"`
+
+	// Avoid schedules the pods away from the pods of other PodSets in the
+	// same namespace.
+	// +optional
+	Avoid []PodSetAffinityTerm `json:"avoid,omitempty"`
+
+	// MislabeledPodPolicy is Repair, the default, for the controller to
+	// restore the labels it selects its pods by when they are removed or
+	// changed on a pod it owns, or Release for it to give up such pods, which
+	// keep running. Pods outside the PodSet's namespace are not owned by
+	// reference and cannot be detected.
+	// +optional
+	// +kubebuilder:default=Repair
+	MislabeledPodPolicy MislabeledPodPolicyType `json:"mislabeledPodPolicy,omitempty"`
+
+	// SafeToEvict, when set, is written to the pods'
+	// cluster-autoscaler.kubernetes.io/safe-to-evict annotation: true lets
+	// the cluster autoscaler evict them to remove their node, false keeps
+	// it from doing so. Changing it rolls out to existing pods.
+	// +optional
+	SafeToEvict *bool `json:"safeToEvict,omitempty"`
+
+	// ScaleDown configures how pods are removed when the PodSet scales
+	// down.
+	// +optional
+	ScaleDown *ScaleDownSpec `json:"scaleDown,omitempty"`
+
+	// PodManagementPolicy is Parallel, the default, or Ordered, which gives
+	// the pods stable ordinal names as a StatefulSet does. Failed pods of
+	// an Ordered PodSet are deleted to be recreated under their name, and
+	// with a headless spec.service each pod gets a DNS name under it. It
+	// cannot be combined with shards or a scaleDownPolicy, and cannot be
+	// changed.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="podManagementPolicy is immutable"
+	// +optional
+	PodManagementPolicy PodManagementPolicyType `json:"podManagementPolicy,omitempty"`
+
+	// ScaleDownPolicy chooses which pods are removed on scale-down: Random,
+	// Newest, Oldest or LeastReady. When unset, pods are removed in the
+	// order they are listed. The leader of a PodSet with leader election is
+	// chosen last whatever the policy.
+	// +optional
+	ScaleDownPolicy ScaleDownPolicyType `json:"scaleDownPolicy,omitempty"`
+}
+
+// PendingTimeoutSpec configures how pods stuck in the Pending phase are
+// handled.
+type PendingTimeoutSpec struct {
+	// Seconds is how long a pod may be Pending, from its creation, before
+	// it is reported in status.stuckPendingPods and the Degraded condition.
+	// +kubebuilder:validation:Minimum=1
+	Seconds int32 `json:"seconds"`
+
+	// Replace deletes stuck pods so that they are recreated, unless the
+	// failure policy has halted replacements.
+	// +optional
+	Replace bool `json:"replace,omitempty"`
+}
+
+// DisruptionBudgetSpec configures the PodDisruptionBudget the controller
+// creates for a PodSet's pods. It is removed with the PodSet or when
+// spec.disruptionBudget is unset.
+// +kubebuilder:validation:XValidation:rule="has(self.minAvailable) != has(self.maxUnavailable)",message="exactly one of minAvailable or maxUnavailable must be set"
+type DisruptionBudgetSpec struct {
+	// MinAvailable is the number, or percentage, of pods that must stay
+	// available through evictions.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number, or percentage, of pods that may be
+	// unavailable after evictions.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// NetworkPolicySpec configures the NetworkPolicy the controller creates for a
+// PodSet's pods. Ingress to the pods is limited to what it allows; egress is
+// limited only when egress rules are given. It is removed with the PodSet or
+// when spec.networkPolicy is unset.
+type NetworkPolicySpec struct {
+	// AllowFromSameSet allows ingress from the other pods of the PodSet.
+	// +optional
+	AllowFromSameSet bool `json:"allowFromSameSet,omitempty"`
+
+	// AllowFromNamespaces allows ingress from every pod of the listed
+	// namespaces.
+	// +optional
+	AllowFromNamespaces []string `json:"allowFromNamespaces,omitempty"`
+
+	// Ingress are further rules allowing ingress to the pods.
+	// +optional
+	Ingress []networkingv1.NetworkPolicyIngressRule `json:"ingress,omitempty"`
+
+	// Egress, when set, limits egress from the pods to what these rules
+	// allow.
+	// +optional
+	Egress []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
+}
+
+// PodMonitorSpec configures the PodMonitor the controller creates for a
+// PodSet's pods. It exists only while a container of the pod template
+// declares the metrics port and the PodMonitor resource is installed, and is
+// removed with the PodSet or when spec.podMonitor is unset.
+type PodMonitorSpec struct {
+	// Port is the name of the container port metrics are served on.
+	// +kubebuilder:default=metrics
+	// +optional
+	Port string `json:"port,omitempty"`
+
+	// Path is the HTTP path metrics are served on. Defaults to /metrics.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Interval is how often the pods are scraped, such as 30s. Defaults to
+	// the Prometheus scrape interval.
+	// +kubebuilder:validation:Pattern=`^(0|(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?)$`
+	// +optional
+	Interval string `json:"interval,omitempty"`
+}
+
+// ServiceSpec configures the Service the controller creates for a PodSet's
+// pods, in their namespace. The Service is removed with the PodSet or when
+// spec.service is unset.
+// +kubebuilder:validation:XValidation:rule="(has(self.headless) && !self.headless) ? has(self.ports) && size(self.ports) > 0 : true",message="a Service that is not headless needs ports"
+type ServiceSpec struct {
+	// Name is the name of the Service. Defaults to the name of the PodSet.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Headless gives the Service no cluster IP, so that its DNS name
+	// resolves to the addresses of the pods. The cluster IP is allocated
+	// when the Service is created: changing this recreates the Service.
+	// +kubebuilder:default=true
+	// +optional
+	Headless *bool `json:"headless,omitempty"`
+
+	// Ports are the ports the Service exposes.
+	// +optional
+	Ports []corev1.ServicePort `json:"ports,omitempty"`
+
+	// PublishNotReadyAddresses publishes the addresses of pods that are
+	// not Ready, as peers discovering each other before they are ready
+	// need.
+	// +optional
+	PublishNotReadyAddresses bool `json:"publishNotReadyAddresses,omitempty"`
+}
+
+// ServiceAccountSpec configures the ServiceAccount the PodSet's pods run as.
+type ServiceAccountSpec struct {
+	// Name is the ServiceAccount the pods run as when the template names
+	// none. With create, it is the name of the created ServiceAccount,
+	// which defaults to the name of the PodSet.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Create makes the controller create the ServiceAccount and run the
+	// pods as it. It cannot be combined with a serviceAccountName in the
+	// template. A ServiceAccount created under a previous name, or before
+	// create was turned off, is deleted.
+	// +optional
+	Create bool `json:"create,omitempty"`
+
+	// ImagePullSecrets are attached to the created ServiceAccount.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// ContainerEnvSpec is the environment added to a container of the pods.
+type ContainerEnvSpec struct {
+	// ContainerName is the name of the container, or init container, the
+	// environment is added to. Empty adds it to every container.
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+
+	// Env are the environment variables to add.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// EnvFrom are the ConfigMaps and Secrets to populate environment
+	// variables from, added after those of the template.
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+}
+
+// PersistentVolumeClaimRetentionPolicy mirrors the StatefulSet policy of the
+// same name for the claims of spec.volumeClaimTemplates.
+type PersistentVolumeClaimRetentionPolicy struct {
+	// WhenDeleted is Delete, the default, to delete the claims with the
+	// PodSet, or Retain to keep them. Retained claims are released from the
+	// PodSet and reused by the pods of a PodSet of the same name created
+	// later.
+	// +kubebuilder:default=Delete
+	// +optional
+	WhenDeleted PersistentVolumeClaimRetentionPolicyType `json:"whenDeleted,omitempty"`
+
+	// WhenScaled is Retain, the default, to keep the claims of the pods of
+	// an Ordered PodSet removed by scale-down, for the pods that take their
+	// ordinals when it scales up again, or Delete to delete them. The
+	// claims of a PodSet that is not Ordered have no pod to be reused by
+	// and are deleted with their pods either way.
+	// +kubebuilder:default=Retain
+	// +optional
+	WhenScaled PersistentVolumeClaimRetentionPolicyType `json:"whenScaled,omitempty"`
+}
+
+// VolumeClaimTemplate describes the PersistentVolumeClaim created for each
+// pod of a PodSet.
+type VolumeClaimTemplate struct {
+	// Name names the claims and the pod volumes they are mounted through.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Labels are added to the claims, besides the PodSet's pod labels.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Spec is the spec of the claims.
+	Spec corev1.PersistentVolumeClaimSpec `json:"spec"`
+}
+
+// ContainerVolumeMountsSpec are the volume mounts added to a container of
+// the pods.
+type ContainerVolumeMountsSpec struct {
+	// ContainerName is the name of the container, or init container, the
+	// volumes are mounted into. Empty mounts them into every container.
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+
+	// VolumeMounts are the mounts to add.
+	// +kubebuilder:validation:MinItems=1
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts"`
+}
+
+// ContainerProbesSpec are the probes of a container of the pods.
+type ContainerProbesSpec struct {
+	// ContainerName is the name of the container the probes are set on.
+	// Empty sets them on every container.
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+
+	// LivenessProbe restarts the container when it fails.
+	// +optional
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+
+	// ReadinessProbe keeps the pod from being Ready while it fails.
+	// +optional
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+
+	// StartupProbe holds off the other probes until it succeeds.
+	// +optional
+	StartupProbe *corev1.Probe `json:"startupProbe,omitempty"`
+}
+
+// PerPodConfigSpec describes the ConfigMap rendered for each pod.
+type PerPodConfigSpec struct {
+	// MountPath is the directory the ConfigMap is mounted at in every
+	// container of the pod.
+	// +kubebuilder:validation:MinLength=1
+	MountPath string `json:"mountPath"`
+
+	// Data maps file names to Go text/template strings. The templates are
+	// rendered with .PodName, .Index (the pod's position among the PodSet's
+	// pods sorted by name), .Namespace and .Peers (the names of the other
+	// pods). The rendered files are refreshed as pods come and go.
+	Data map[string]string `json:"data"`
+}
+
+// RollbackConfig names the revision to roll a PodSet's pod template back to.
+type RollbackConfig struct {
+	// Revision is the number of the revision to roll back to. Zero, the
+	// default, means the revision before the current one.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// PodSetUpdateStrategyType names how outdated pods are replaced.
+// +kubebuilder:validation:Enum=RollingUpdate;OnDelete
+type PodSetUpdateStrategyType string
+
+const (
+	// RollingUpdatePodSetStrategyType replaces outdated pods in batches, as
+	// configured by rollingUpdate.
+	RollingUpdatePodSetStrategyType PodSetUpdateStrategyType = "RollingUpdate"
+	// OnDeletePodSetStrategyType leaves outdated pods running until they
+	// are deleted.
+	OnDeletePodSetStrategyType PodSetUpdateStrategyType = "OnDelete"
+)
+
+// PodSetUpdateStrategy describes how outdated pods are replaced.
+type PodSetUpdateStrategy struct {
+	// Type is RollingUpdate, the default, to replace outdated pods or
+	// OnDelete to leave them running until they are deleted.
+	// +optional
+	// +kubebuilder:default=RollingUpdate
+	Type PodSetUpdateStrategyType `json:"type,omitempty"`
+
+	// RollingUpdate replaces outdated pods in batches. Defaults to batches
+	// of one pod.
+	// +optional
+	RollingUpdate *RollingUpdatePodSetStrategy `json:"rollingUpdate,omitempty"`
+
+	// Progressive watches the pods of each rolling update batch for a while
+	// before moving on, and rolls the PodSet back to its previous pod
+	// template if they fail. Verification is skipped while the PodSet has
+	// the podset.example.com/force-rollout annotation.
+	// +optional
+	Progressive *ProgressiveRolloutStrategy `json:"progressive,omitempty"`
+}
+
+// RollingUpdatePodSetStrategy replaces outdated pods a batch at a time,
+// starting the next batch once every updated pod is Ready.
+type RollingUpdatePodSetStrategy struct {
+	// BatchSize is the number of outdated pods replaced at a time. Defaults
+	// to 1.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	BatchSize int32 `json:"batchSize,omitempty"`
+
+	// RequireApproval pauses the rollout after each batch, with the
+	// AwaitingApproval condition set, until the
+	// podset.example.com/approve-batch annotation is set to a new value. The
+	// first batch of a rollout starts without approval. A rollout is
+	// aborted by reverting the spec.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// ProgressiveRolloutStrategy describes how the pods of a rolling update batch
+// are verified.
+type ProgressiveRolloutStrategy struct {
+	// ObservationWindow is how long the updated pods are watched once every
+	// pod of a batch is Ready.
+	ObservationWindow metav1.Duration `json:"observationWindow"`
+
+	// FailureThreshold is the number of failures among the updated pods at
+	// which the rollout is rolled back. Container restarts, Failed pods and
+	// pods that lose readiness during the window each count as a failure.
+	// Defaults to 1.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// HostPortRange is an inclusive range of host ports.
+// +kubebuilder:validation:XValidation:rule="self.start <= self.end",message="end must not be less than start"
+type HostPortRange struct {
+	// Start is the first port of the range.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Start int32 `json:"start"`
+
+	// End is the last port of the range. It must not be less than start.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	End int32 `json:"end"`
+
+	// ContainerPort is the port of the first container the host port
+	// forwards to. Defaults to the assigned host port.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	ContainerPort int32 `json:"containerPort,omitempty"`
+}
+
+// ResourceBudget is a cap on the total resource requests of a PodSet's pods.
+// A resource the pods do not request counts as zero against the budget.
+type ResourceBudget struct {
+	// CPU is the total CPU the pods may request.
+	// +optional
+	CPU *resource.Quantity `json:"cpu,omitempty"`
+
+	// Memory is the total memory the pods may request.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+}
+
+// DeletionDrain paces the deletion of a deleted PodSet's pods.
+type DeletionDrain struct {
+	// Pods is the number of pods deleted each interval.
+	// +kubebuilder:validation:Minimum=1
+	Pods int32 `json:"pods"`
+
+	// Interval is the time between deletions.
+	Interval metav1.Duration `json:"interval"`
+}
+
+// CleanupResourceType names a kind of object the cleanup of a deleted PodSet
+// can delete.
+// +kubebuilder:validation:Enum=Services;PersistentVolumeClaims
+type CleanupResourceType string
+
+const (
+	// ServicesCleanupResource deletes Services.
+	ServicesCleanupResource CleanupResourceType = "Services"
+	// PersistentVolumeClaimsCleanupResource deletes PersistentVolumeClaims.
+	PersistentVolumeClaimsCleanupResource CleanupResourceType = "PersistentVolumeClaims"
+)
+
+// CleanupSpec configures the teardown of a deleted PodSet.
+// +kubebuilder:validation:XValidation:rule="!has(self.resources) || size(self.resources) == 0 || has(self.selector)",message="selector is required to delete resources"
+type CleanupSpec struct {
+	// Resources are the kinds of object deleted with the PodSet: those in
+	// the namespace of the pods that match Selector.
+	// +optional
+	Resources []CleanupResourceType `json:"resources,omitempty"`
+
+	// Selector selects the objects of Resources to delete. It is required
+	// when Resources is set.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Hook is called once the objects are deleted. The PodSet is removed
+	// only after the hook succeeds.
+	// +optional
+	Hook *CleanupHook `json:"hook,omitempty"`
+}
+
+// CleanupHook is an HTTP endpoint called to deprovision what belongs to a
+// deleted PodSet outside the cluster.
+type CleanupHook struct {
+	// URL is POSTed the PodSet as JSON. Any 2xx response completes the
+	// cleanup; anything else is retried with backoff until the hook
+	// succeeds or the PodSet is given the podset.example.com/force-delete=true
+	// annotation, which skips the hook. It must be an http or
+	// https URL, on a host the operator allows; hooks to other hosts are
+	// skipped. Redirects are not followed. The hook may be called more than
+	// once for a PodSet and should be idempotent.
+	// +kubebuilder:validation:XValidation:rule="self.startsWith('http://') || self.startsWith('https://')",message="must be an http or https URL"
+	URL string `json:"url"`
+
+	// TimeoutSeconds bounds each call. Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// PodSetAffinityTerm refers to another PodSet whose pods the pods should be
+// scheduled near or away from.
+type PodSetAffinityTerm struct {
+	// Name is the name of the other PodSet.
+	Name string `json:"name"`
+
+	// TopologyKey is the node label that defines what "near" means.
+	// Defaults to kubernetes.io/hostname.
+	// +optional
+	TopologyKey string `json:"topologyKey,omitempty"`
+
+	// Required makes the term a scheduling requirement rather than a
+	// preference.
+	// +optional
+	Required bool `json:"required,omitempty"`
+}
+
+// ScaleDownSpec configures how pods are removed on scale-down.
+type ScaleDownSpec struct {
+	// UseEvictionAPI removes pods through the Eviction API, so that
+	// PodDisruptionBudgets covering them are respected. A pod whose eviction
+	// a budget refuses is skipped in favour of the next candidate.
+	// +optional
+	UseEvictionAPI bool `json:"useEvictionAPI,omitempty"`
+
+	// DrainSeconds delays the removal of a pod chosen for scale-down. The
+	// pod is first labeled podset.example.com/draining=true, which Services
+	// can exclude from their selector, and removed once the delay has
+	// passed.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	DrainSeconds int32 `json:"drainSeconds,omitempty"`
+
+	// MinPodAgeSeconds keeps pods younger than this from being chosen for
+	// scale-down. When every candidate is younger, the scale-down waits.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinPodAgeSeconds int32 `json:"minPodAgeSeconds,omitempty"`
+
+	// Action is Delete, the default, to delete the pods removed from the
+	// PodSet, or Orphan to release them: their owner reference and the
+	// controller's labels are removed and they keep running, unmanaged.
+	// Only as many pods as the desired count dropped by are orphaned; any
+	// other excess pods are deleted.
+	// +optional
+	// +kubebuilder:default=Delete
+	Action ScaleDownActionType `json:"action,omitempty"`
 }
 
 // PodSetStatus defines the observed state of PodSet
 type PodSetStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	PodNames          []string `json:"podNames"`
-	AvailableReplicas int32    `json:"availableReplicas"`
+	PodNames []string `json:"podNames,omitempty"`
+
+	// Replicas is the number of running and pending pods.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// AvailableReplicas is the number of pods that have been Ready for
+	// spec.minReadySeconds.
+	AvailableReplicas int32 `json:"availableReplicas"`
+
+	// ObservedGeneration is the generation of the spec that the controller
+	// last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ReadyReplicas is the number of pods that are Ready.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// UpdatedReplicas is the number of running and pending pods created from the
+	// current pod template.
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+
+	// Selector is the label selector of the PodSet's pods, in string form,
+	// for the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// PodNamesTruncated is true when PodNames was capped by the operator and
+	// lists only some of the running and pending pods. Replicas always holds
+	// the full count.
+	// +optional
+	PodNamesTruncated bool `json:"podNamesTruncated,omitempty"`
+
+	// Leader is the name of the pod currently labeled as leader when
+	// spec.electLeader is set.
+	// +optional
+	Leader string `json:"leader,omitempty"`
+
+	// Shards reports the pods of each shard when spec.shards is set.
+	// +optional
+	Shards []ShardStatus `json:"shards,omitempty"`
+
+	// Rollout reports the progress of replacing outdated pods, unless
+	// spec.updateStrategy.type is OnDelete.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// InPlaceResize reports the pods whose container resources are updated
+	// in place rather than by replacing them, when the operator resizes
+	// pods in place.
+	// +optional
+	InPlaceResize *InPlaceResizeStatus `json:"inPlaceResize,omitempty"`
+
+	// Drain reports the progress of draining the pods of a deleted PodSet.
+	// +optional
+	Drain *DrainStatus `json:"drain,omitempty"`
+
+	// DesiredReplicas is the number of pods the controller last aimed to
+	// run.
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+
+	// PendingOrphans is the number of pods still to be orphaned because the
+	// desired count dropped, with spec.scaleDown.action Orphan.
+	// +optional
+	PendingOrphans int32 `json:"pendingOrphans,omitempty"`
+
+	// PodLatency reports how long the pod that most recently became Ready
+	// took to be scheduled and then to become Ready.
+	// +optional
+	PodLatency *PodLatencyStatus `json:"podLatency,omitempty"`
+
+	// StuckPendingPods lists the pods Pending for longer than
+	// spec.pendingTimeout.seconds.
+	// +optional
+	StuckPendingPods []string `json:"stuckPendingPods,omitempty"`
+
+	// RecentlyDeleted lists the pods the controller most recently deleted
+	// and why, most recent last.
+	// +optional
+	RecentlyDeleted []DeletedPod `json:"recentlyDeleted,omitempty"`
+
+	// Conditions represent the latest available observations of the
+	// PodSet's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ShardStatus reports the pods of a single shard.
+type ShardStatus struct {
+	// Index is the shard number.
+	Index int32 `json:"index"`
+
+	// Replicas is the number of available pods in the shard.
+	Replicas int32 `json:"replicas"`
+
+	// ReadyReplicas is the number of pods in the shard that are Ready.
+	ReadyReplicas int32 `json:"readyReplicas"`
 }
 
+// RolloutStatus reports the progress of a rolling update.
+type RolloutStatus struct {
+	// TemplateHash identifies the version of the spec being rolled out.
+	TemplateHash string `json:"templateHash"`
+
+	// BatchesCompleted is the number of batches of this rollout whose
+	// replacement pods are all Ready.
+	BatchesCompleted int32 `json:"batchesCompleted"`
+
+	// BatchesRemaining is the number of batches still to be replaced,
+	// including one in progress.
+	BatchesRemaining int32 `json:"batchesRemaining"`
+
+	// BatchInProgress is true while the pods of a started batch are being
+	// replaced.
+	// +optional
+	BatchInProgress bool `json:"batchInProgress,omitempty"`
+
+	// ApprovedBatch is the value of the podset.example.com/approve-batch
+	// annotation last used to start a batch.
+	// +optional
+	ApprovedBatch string `json:"approvedBatch,omitempty"`
+
+	// PreviousTemplateHash identifies the version of the spec most pods ran
+	// when the rollout started, which a failed progressive rollout is
+	// rolled back to.
+	// +optional
+	PreviousTemplateHash string `json:"previousTemplateHash,omitempty"`
+
+	// ObservationStartTime is when the observation window of the batch in
+	// progress started.
+	// +optional
+	ObservationStartTime *metav1.Time `json:"observationStartTime,omitempty"`
+}
+
+// PodDeletionReason is why the controller deleted a pod.
+type PodDeletionReason string
+
+const (
+	// ScaleDownDeletion removed a pod in excess of the desired count.
+	ScaleDownDeletion PodDeletionReason = "ScaleDown"
+	// TemplateRolloutDeletion replaced a pod created from an outdated pod
+	// template.
+	TemplateRolloutDeletion PodDeletionReason = "TemplateRollout"
+	// DriftReplacementDeletion replaced a pod on a node no longer listed in
+	// spec.nodeNames.
+	DriftReplacementDeletion PodDeletionReason = "DriftReplacement"
+	// FailedPodReplacementDeletion removed a failed pod of an Ordered
+	// PodSet to recreate it under the same name.
+	FailedPodReplacementDeletion PodDeletionReason = "FailedPodReplacement"
+	// FailedPodCleanupDeletion removed a failed pod that the failure policy
+	// replaces.
+	FailedPodCleanupDeletion PodDeletionReason = "FailedPodCleanup"
+	// CrashLoopDeletion replaced a pod whose container was crash looping
+	// past spec.crashLoopRestartLimit.
+	CrashLoopDeletion PodDeletionReason = "CrashLoop"
+	// StuckPendingDeletion replaced a pod Pending for longer than
+	// spec.pendingTimeout.seconds.
+	StuckPendingDeletion PodDeletionReason = "StuckPending"
+	// PodSetDeletedDeletion removed a pod of a deleted PodSet.
+	PodSetDeletedDeletion PodDeletionReason = "PodSetDeleted"
+)
+
+// DeletedPod records a pod deleted by the controller.
+type DeletedPod struct {
+	// Name is the name of the pod.
+	Name string `json:"name"`
+
+	// Time is when the controller deleted the pod.
+	Time metav1.Time `json:"time"`
+
+	// Reason is why the controller deleted the pod.
+	Reason PodDeletionReason `json:"reason"`
+}
+
+// DrainStatus reports the progress of a deletion drain.
+type DrainStatus struct {
+	// RemainingPods is the number of pods not yet deleted.
+	RemainingPods int32 `json:"remainingPods"`
+
+	// LastDeletionTime is when pods were last deleted by the drain.
+	// +optional
+	LastDeletionTime *metav1.Time `json:"lastDeletionTime,omitempty"`
+}
+
+// InPlaceResizeStatus counts the pods resized in place to the current pod
+// template.
+type InPlaceResizeStatus struct {
+	// Resized is the number of pods resized in place to the current
+	// template.
+	Resized int32 `json:"resized"`
+
+	// Pending is the number of pods that differ from the current template
+	// only in container resources and are still to be resized.
+	Pending int32 `json:"pending"`
+
+	// Infeasible is the number of pods whose resize was refused and that
+	// are left to be replaced instead.
+	Infeasible int32 `json:"infeasible"`
+}
+
+// PodLatencyStatus reports the startup latencies of a pod.
+type PodLatencyStatus struct {
+	// Pod is the name of the pod.
+	Pod string `json:"pod"`
+
+	// Scheduling is the time from the pod's creation until it was
+	// scheduled.
+	Scheduling metav1.Duration `json:"scheduling"`
+
+	// Readiness is the time from the pod being scheduled until it became
+	// Ready.
+	Readiness metav1.Duration `json:"readiness"`
+}
+
+const (
+	// ConditionAvailable is True when at least the desired number of pods
+	// have been Ready for spec.minReadySeconds.
+	ConditionAvailable = "Available"
+
+	// ConditionProgressing is True while the controller is creating,
+	// removing or replacing pods to reach the desired state.
+	ConditionProgressing = "Progressing"
+
+	// ConditionDegraded is True when the PodSet cannot reach its desired
+	// state without intervention.
+	ConditionDegraded = "Degraded"
+
+	// ConditionNodesUnavailable is True when some of the nodes listed in
+	// spec.nodeNames do not exist or are unschedulable.
+	ConditionNodesUnavailable = "NodesUnavailable"
+
+	// ConditionAwaitingApproval is True when a rolling update has completed
+	// a batch and waits for approval to start the next.
+	ConditionAwaitingApproval = "AwaitingApproval"
+
+	// ConditionRolloutFailed is True when the pods of a progressive rollout
+	// failed verification. It is cleared by the next edit of the spec.
+	ConditionRolloutFailed = "RolloutFailed"
+
+	// ConditionHostPortsExhausted is True when spec.hostPortRange has too
+	// few free ports for the pods that are missing.
+	ConditionHostPortsExhausted = "HostPortsExhausted"
+
+	// ConditionInsufficientCapacity is True when the operator's capacity
+	// check estimates that the cluster cannot fit all of the missing pods.
+	ConditionInsufficientCapacity = "InsufficientCapacity"
+
+	// ConditionBudgetExceeded is True when spec.resourceBudget does not
+	// allow all of the desired pods.
+	ConditionBudgetExceeded = "BudgetExceeded"
+
+	// ConditionMissingReference is True when the pods reference a
+	// ServiceAccount, Secret or ConfigMap that does not exist.
+	ConditionMissingReference = "MissingReference"
+
+	// ConditionDeletionBlocked is True while a deleted PodSet is kept
+	// because it is deletion-protected.
+	ConditionDeletionBlocked = "DeletionBlocked"
+
+	// ConditionPaused is True while spec.paused stops the controller from
+	// changing the PodSet's pods.
+	ConditionPaused = "Paused"
+
+	// ConditionObserveOnly is True while the controller only observes the
+	// PodSet's pods because of spec.managementPolicy.
+	ConditionObserveOnly = "ObserveOnly"
+
+	// ConditionInvalidPodTemplate is True while the pod rendered for the
+	// PodSet is rejected by a dry-run create, and pods are not created.
+	ConditionInvalidPodTemplate = "InvalidPodTemplate"
+
+	// ConditionReplicaFailure is True when creating pods failed on
+	// consecutive attempts more often than the operator allows, and pods
+	// are no longer created. It is cleared by the next edit of the spec.
+	ConditionReplicaFailure = "ReplicaFailure"
+
+	// ConditionClassNotFound is True while the PodSetClass named by
+	// spec.className does not exist and its defaults are not applied.
+	ConditionClassNotFound = "ClassNotFound"
+
+	// ConditionColocationTargetMissing is True while a PodSet named by
+	// spec.colocateWith or spec.avoid does not exist and its term is not
+	// applied.
+	ConditionColocationTargetMissing = "ColocationTargetMissing"
+
+	// ConditionScaleDownDeferred is True while a scale-down waits for pods
+	// to reach spec.scaleDown.minPodAgeSeconds.
+	ConditionScaleDownDeferred = "ScaleDownDeferred"
+
+	// ConditionFlapping is True while the desired number of pods keeps
+	// changing direction, up and down, more often than the operator allows.
+	ConditionFlapping = "Flapping"
+
+	// ConditionClaimsResizing is True while claims of spec.volumeClaimTemplates
+	// are being expanded to a grown storage request.
+	ConditionClaimsResizing = "ClaimsResizing"
+)
+
 //+kubebuilder:object:root=true
+//+kubebuilder:storageversion
 //+kubebuilder:subresource:status
+//+kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+//+kubebuilder:resource:shortName=ps,categories=all
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredReplicas`,description="Number of pods the controller aims to run"
+//+kubebuilder:printcolumn:name="Available",type=integer,JSONPath=`.status.availableReplicas`,description="Number of pods Ready for minReadySeconds"
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`,priority=1,description="Number of Ready pods"
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // PodSet is the Schema for the podsets API
 type PodSet struct {
@@ -0,0 +1,737 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// DeletionProtectedAnnotation, set to "true" on a PodSet, makes the webhook
+// reject its deletion. Without the webhook, the controller keeps a deleted
+// PodSet and its pods until the annotation is removed.
+const DeletionProtectedAnnotation = "podset.example.com/deletion-protected"
+
+// ConfirmScaleDownAnnotation, set to "true" in the same update, makes the
+// webhook admit a scale-down that the scale-down guard would reject. The
+// controller removes it afterwards, so that each drastic scale-down has to
+// be confirmed anew.
+const ConfirmScaleDownAnnotation = "podset.example.com/confirm-scale-down"
+
+// The owner labels identify the PodSet that owns a pod created outside the
+// PodSet's namespace, where it cannot carry an owner reference. OwnerNameLabel
+// is set only when the PodSet has a spec.selector; otherwise the app label
+// names the PodSet.
+const (
+	OwnerUIDLabel       = "podset.example.com/owner-uid"
+	OwnerNamespaceLabel = "podset.example.com/owner-namespace"
+	OwnerNameLabel      = "podset.example.com/owner-name"
+)
+
+// ScaleDownGuard bounds how far a single update may reduce a PodSet's
+// replicas. A zero field disables its bound.
+type ScaleDownGuard struct {
+	// MaxPercent is the largest reduction allowed in one update, as a
+	// percentage of the previous replicas.
+	MaxPercent int32
+	// MaxPods is the largest number of pods one update may remove.
+	MaxPods int32
+}
+
+// check returns an error describing how to proceed if scaling from old to
+// new replicas exceeds the guard.
+func (g ScaleDownGuard) check(name string, old, new int32) error {
+	if new >= old {
+		return nil
+	}
+	removed := old - new
+	var exceeded string
+	switch {
+	case g.MaxPods > 0 && removed > g.MaxPods:
+		exceeded = fmt.Sprintf("more than %d pods", g.MaxPods)
+	case g.MaxPercent > 0 && int64(removed)*100 > int64(old)*int64(g.MaxPercent):
+		exceeded = fmt.Sprintf("more than %d%% of its replicas", g.MaxPercent)
+	default:
+		return nil
+	}
+	return fmt.Errorf("scaling PodSet %s from %d to %d replicas removes %s in one step; "+
+		"scale down in smaller steps, or confirm by setting the %s annotation to \"true\" in the same update",
+		name, old, new, exceeded, ConfirmScaleDownAnnotation)
+}
+
+// scaleDownGuard is the guard applied to PodSet updates, set up by
+// SetupWebhookWithManager.
+var scaleDownGuard ScaleDownGuard
+
+// allowedTargetNamespaces lists the namespaces, other than their own, that
+// PodSets may create pods in, as the operator's --allowed-target-namespaces
+// does. "*" allows any namespace. It is set up by SetupWebhookWithManager.
+var allowedTargetNamespaces []string
+
+// log is for logging in this package.
+var podsetlog = logf.Log.WithName("podset-resource")
+
+func (r *PodSet) SetupWebhookWithManager(mgr ctrl.Manager, guard ScaleDownGuard, targetNamespaces []string) error {
+	scaleDownGuard = guard
+	allowedTargetNamespaces = targetNamespaces
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	mgr.GetWebhookServer().Register("/validate-podset-example-com-v1alpha1-podset-scale",
+		&webhook.Admission{Handler: &scaleValidator{decoder: decoder}})
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// IsDeletionProtected reports whether the PodSet carries the
+// deletion-protected annotation.
+func (r *PodSet) IsDeletionProtected() bool {
+	return r.Annotations[DeletionProtectedAnnotation] == "true"
+}
+
+// IsScaleDownConfirmed reports whether the PodSet carries the
+// confirm-scale-down annotation.
+func (r *PodSet) IsScaleDownConfirmed() bool {
+	return r.Annotations[ConfirmScaleDownAnnotation] == "true"
+}
+
+// targetNamespaceAllowed reports whether the PodSet's pods live in its own
+// namespace or in one of allowedTargetNamespaces.
+func (r *PodSet) targetNamespaceAllowed() bool {
+	if r.Spec.TargetNamespace == "" || r.Spec.TargetNamespace == r.Namespace {
+		return true
+	}
+	for _, ns := range allowedTargetNamespaces {
+		if ns == "*" || ns == r.Spec.TargetNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// totalReplicas returns the number of pods the PodSet asks for.
+func (r *PodSet) totalReplicas() int32 {
+	if r.Spec.Shards > 0 {
+		perShard := r.Spec.ReplicasPerShard
+		if perShard <= 0 {
+			perShard = 1
+		}
+		return r.Spec.Shards * perShard
+	}
+	return r.Spec.Replicas
+}
+
+//+kubebuilder:webhook:path=/validate-podset-example-com-v1alpha1-podset,mutating=false,failurePolicy=fail,sideEffects=None,groups=podset.example.com,resources=podsets,verbs=create;update;delete,versions=v1alpha1,name=vpodset.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &PodSet{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *PodSet) ValidateCreate() error {
+	podsetlog.Info("validate create", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *PodSet) ValidateUpdate(old runtime.Object) error {
+	podsetlog.Info("validate update", "name", r.Name)
+
+	oldPodSet, ok := old.(*PodSet)
+	if !ok {
+		return r.validate()
+	}
+	// Updates that leave the spec alone, such as those of finalizers, are
+	// admitted so that a PodSet created before a check existed can still be
+	// deleted.
+	if equality.Semantic.DeepEqual(oldPodSet.Spec, r.Spec) {
+		return nil
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(oldPodSet.Spec.Selector, r.Spec.Selector) {
+		return apierrors.NewInvalid(GroupVersion.WithKind("PodSet").GroupKind(), r.Name, field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "selector"), "field is immutable"),
+		})
+	}
+	if errs := validateClaimTemplateUpdate(oldPodSet.Spec.VolumeClaimTemplates, r.Spec.VolumeClaimTemplates,
+		field.NewPath("spec", "volumeClaimTemplates")); len(errs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("PodSet").GroupKind(), r.Name, errs)
+	}
+	if r.IsScaleDownConfirmed() {
+		return nil
+	}
+	return scaleDownGuard.check(r.Namespace+"/"+r.Name, oldPodSet.totalReplicas(), r.totalReplicas())
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *PodSet) ValidateDelete() error {
+	podsetlog.Info("validate delete", "name", r.Name)
+
+	if r.IsDeletionProtected() {
+		return fmt.Errorf("PodSet %s/%s is protected from deletion; remove the %s annotation first",
+			r.Namespace, r.Name, DeletionProtectedAnnotation)
+	}
+	return nil
+}
+
+// validate checks the parts of the spec that the CRD schema cannot, so that
+// a PodSet the controller would fail to reconcile is rejected up front.
+func (r *PodSet) validate() error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if r.Spec.Replicas < 0 {
+		errs = append(errs, field.Invalid(spec.Child("replicas"), r.Spec.Replicas, "must not be negative"))
+	}
+	if r.Spec.Template != nil {
+		errs = append(errs, validatePodTemplate(r.Spec.Template, spec.Child("template"))...)
+	}
+	if r.Spec.PodOverrides != nil {
+		errs = append(errs, ValidatePodOverrides(&r.Spec, spec.Child("podOverrides"))...)
+	}
+	if !r.targetNamespaceAllowed() {
+		errs = append(errs, field.Forbidden(spec.Child("targetNamespace"),
+			fmt.Sprintf("the operator does not allow creating pods in namespace %s", r.Spec.TargetNamespace)))
+	}
+	if r.Spec.Selector != nil {
+		errs = append(errs, validateSelector(r.Spec.Selector, r.Spec.Template, spec.Child("selector"))...)
+	}
+	errs = append(errs, metav1validation.ValidateLabels(r.Spec.NodeSelector, spec.Child("nodeSelector"))...)
+	if r.Spec.Affinity != nil {
+		errs = append(errs, validateAffinity(r.Spec.Affinity, spec.Child("affinity"))...)
+	}
+	if r.Spec.Resources != nil {
+		errs = append(errs, validateResources(r.Spec.Resources, spec.Child("resources"))...)
+	}
+	if r.Spec.ResourceBudget != nil {
+		errs = append(errs, validateResourceBudget(&r.Spec, spec.Child("resourceBudget"))...)
+	}
+	for i, secret := range r.Spec.ImagePullSecrets {
+		if secret.Name == "" {
+			errs = append(errs, field.Required(spec.Child("imagePullSecrets").Index(i).Child("name"), ""))
+		}
+	}
+	for i := range r.Spec.ContainerEnv {
+		errs = append(errs, validateContainerEnv(&r.Spec.ContainerEnv[i], spec.Child("containerEnv").Index(i))...)
+	}
+	errs = append(errs, validateVolumes(&r.Spec, spec)...)
+	for i, probes := range r.Spec.Probes {
+		path := spec.Child("probes").Index(i)
+		errs = append(errs, validateProbe(probes.LivenessProbe, path.Child("livenessProbe"))...)
+		errs = append(errs, validateProbe(probes.ReadinessProbe, path.Child("readinessProbe"))...)
+		errs = append(errs, validateProbe(probes.StartupProbe, path.Child("startupProbe"))...)
+	}
+	if r.Spec.PodManagementPolicy == OrderedPodManagement {
+		policy := spec.Child("podManagementPolicy")
+		if r.Spec.Shards > 0 {
+			errs = append(errs, field.Forbidden(policy, "Ordered cannot be combined with shards"))
+		}
+		if r.Spec.ScaleDownPolicy != "" {
+			errs = append(errs, field.Forbidden(policy, "Ordered cannot be combined with a scaleDownPolicy"))
+		}
+	}
+	if r.Spec.NetworkPolicy != nil {
+		for i, namespace := range r.Spec.NetworkPolicy.AllowFromNamespaces {
+			for _, msg := range validation.IsDNS1123Label(namespace) {
+				errs = append(errs, field.Invalid(spec.Child("networkPolicy", "allowFromNamespaces").Index(i), namespace, msg))
+			}
+		}
+	}
+	if sa := r.Spec.ServiceAccount; sa != nil {
+		if sa.Name != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(sa.Name) {
+				errs = append(errs, field.Invalid(spec.Child("serviceAccount", "name"), sa.Name, msg))
+			}
+		}
+		if sa.Create && r.Spec.Template != nil && r.Spec.Template.Spec.ServiceAccountName != "" {
+			errs = append(errs, field.Forbidden(spec.Child("template", "spec", "serviceAccountName"), "may not be set when serviceAccount.create is true"))
+		}
+	}
+	if name := r.Spec.RuntimeClassName; name != nil {
+		for _, msg := range validation.IsDNS1123Subdomain(*name) {
+			errs = append(errs, field.Invalid(spec.Child("runtimeClassName"), *name, msg))
+		}
+	}
+	if name := r.Spec.PriorityClassName; name != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			errs = append(errs, field.Invalid(spec.Child("priorityClassName"), name, msg))
+		}
+	}
+	if r.Spec.Service != nil && r.Spec.Service.Name != "" {
+		for _, msg := range validation.IsDNS1035Label(r.Spec.Service.Name) {
+			errs = append(errs, field.Invalid(spec.Child("service", "name"), r.Spec.Service.Name, msg))
+		}
+	}
+	if r.Spec.Cleanup != nil {
+		errs = append(errs, validateCleanup(r.Spec.Cleanup, spec.Child("cleanup"))...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("PodSet").GroupKind(), r.Name, errs)
+}
+
+// validateSelector checks that a selector is valid, has matchLabels, and
+// selects pods with the template's labels and its own matchLabels, which
+// the controller adds to them.
+func validateSelector(selector *metav1.LabelSelector, template *corev1.PodTemplateSpec, path *field.Path) field.ErrorList {
+	errs := metav1validation.ValidateLabelSelector(selector, path)
+	if len(selector.MatchLabels) == 0 {
+		errs = append(errs, field.Required(path.Child("matchLabels"), "must select at least one label"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	podLabels := labels.Set{}
+	if template != nil {
+		for key, value := range template.Labels {
+			podLabels[key] = value
+		}
+	}
+	for key, value := range selector.MatchLabels {
+		podLabels[key] = value
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return append(errs, field.Invalid(path, selector, err.Error()))
+	}
+	if !sel.Matches(podLabels) {
+		errs = append(errs, field.Invalid(path.Child("matchExpressions"), selector.MatchExpressions, "does not match the template's labels"))
+	}
+	return errs
+}
+
+// validateResources checks that no resource is requested beyond its limit,
+// and that extended resources come in whole units and cannot be
+// overcommitted.
+func validateResources(resources *corev1.ResourceRequirements, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for name, request := range resources.Requests {
+		limit, ok := resources.Limits[name]
+		switch {
+		case isExtendedResourceName(name) && ok && request.Cmp(limit) != 0:
+			errs = append(errs, field.Invalid(path.Child("requests").Key(string(name)), request.String(),
+				fmt.Sprintf("must be equal to %s limit of %s", name, limit.String())))
+		case ok && request.Cmp(limit) > 0:
+			errs = append(errs, field.Invalid(path.Child("requests").Key(string(name)), request.String(),
+				fmt.Sprintf("must be less than or equal to %s limit of %s", name, limit.String())))
+		}
+	}
+	for _, list := range []struct {
+		name      string
+		resources corev1.ResourceList
+	}{{"requests", resources.Requests}, {"limits", resources.Limits}} {
+		for name, quantity := range list.resources {
+			if isExtendedResourceName(name) && quantity.MilliValue()%1000 != 0 {
+				errs = append(errs, field.Invalid(path.Child(list.name).Key(string(name)), quantity.String(), "must be a whole number"))
+			}
+		}
+	}
+	return errs
+}
+
+// validateResourceBudget checks that the budget is not negative and fits
+// at least one pod, or one pod per shard of a sharded PodSet. The requests
+// of a pod are those of the template's containers, with spec.resources
+// filling in the ones they do not set; the defaults of a PodSetClass are
+// not known here and are left to the controller.
+func validateResourceBudget(spec *PodSetSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	var cpu, memory resource.Quantity
+	if spec.Template != nil {
+		for _, container := range spec.Template.Spec.Containers {
+			requests := container.Resources.Requests
+			if spec.Resources != nil {
+				requests = requests.DeepCopy()
+				if requests == nil {
+					requests = corev1.ResourceList{}
+				}
+				for name, quantity := range spec.Resources.Requests {
+					if _, ok := requests[name]; !ok {
+						requests[name] = quantity
+					}
+				}
+			}
+			cpu.Add(*requests.Cpu())
+			memory.Add(*requests.Memory())
+		}
+	}
+	pods := int64(1)
+	if spec.Shards > 0 {
+		pods = int64(spec.Shards)
+	}
+	for _, budgeted := range []struct {
+		name     string
+		budget   *resource.Quantity
+		requests resource.Quantity
+	}{{"cpu", spec.ResourceBudget.CPU, cpu}, {"memory", spec.ResourceBudget.Memory, memory}} {
+		if budgeted.budget == nil {
+			continue
+		}
+		if budgeted.budget.Sign() < 0 {
+			errs = append(errs, field.Invalid(path.Child(budgeted.name), budgeted.budget.String(), "must not be negative"))
+			continue
+		}
+		if budgeted.requests.IsZero() {
+			continue
+		}
+		if budgeted.budget.MilliValue() >= budgeted.requests.MilliValue()*pods {
+			continue
+		}
+		msg := fmt.Sprintf("must be at least the %s requested by one pod", budgeted.requests.String())
+		if spec.Shards > 0 {
+			msg = fmt.Sprintf("must fit one pod requesting %s for each of the %d shards", budgeted.requests.String(), spec.Shards)
+		}
+		errs = append(errs, field.Invalid(path.Child(budgeted.name), budgeted.budget.String(), msg))
+	}
+	return errs
+}
+
+// isExtendedResourceName reports whether the resource is an extended
+// resource, such as nvidia.com/gpu: one with a domain outside
+// kubernetes.io.
+func isExtendedResourceName(name corev1.ResourceName) bool {
+	domain, _, found := strings.Cut(string(name), "/")
+	if !found || domain == "kubernetes.io" || strings.HasSuffix(domain, ".kubernetes.io") {
+		return false
+	}
+	return !strings.HasPrefix(string(name), corev1.DefaultResourceRequestsPrefix)
+}
+
+// validateContainerEnv checks the variable names and that each source
+// references exactly one ConfigMap or Secret.
+func validateContainerEnv(env *ContainerEnvSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, variable := range env.Env {
+		namePath := path.Child("env").Index(i).Child("name")
+		if variable.Name == "" {
+			errs = append(errs, field.Required(namePath, ""))
+			continue
+		}
+		for _, msg := range validation.IsEnvVarName(variable.Name) {
+			errs = append(errs, field.Invalid(namePath, variable.Name, msg))
+		}
+	}
+	for i, source := range env.EnvFrom {
+		if (source.ConfigMapRef == nil) == (source.SecretRef == nil) {
+			errs = append(errs, field.Invalid(path.Child("envFrom").Index(i), "", "must reference exactly one of configMapRef or secretRef"))
+		}
+	}
+	return errs
+}
+
+// validateVolumes checks that spec.volumes and spec.volumeClaimTemplates have
+// unique DNS label names and that spec.volumeMounts mount volumes of the pods
+// at absolute paths. Volumes added by podOverrides are not known here, so
+// with podOverrides set the mounted volumes are left to pod validation.
+func validateVolumes(podSetSpec *PodSetSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	volumes := sets.NewString()
+	for i, volume := range podSetSpec.Volumes {
+		namePath := path.Child("volumes").Index(i).Child("name")
+		switch {
+		case volume.Name == "":
+			errs = append(errs, field.Required(namePath, ""))
+		case volumes.Has(volume.Name):
+			errs = append(errs, field.Duplicate(namePath, volume.Name))
+		default:
+			for _, msg := range validation.IsDNS1123Label(volume.Name) {
+				errs = append(errs, field.Invalid(namePath, volume.Name, msg))
+			}
+		}
+		volumes.Insert(volume.Name)
+	}
+	for i, claim := range podSetSpec.VolumeClaimTemplates {
+		namePath := path.Child("volumeClaimTemplates").Index(i).Child("name")
+		switch {
+		case claim.Name == "":
+			errs = append(errs, field.Required(namePath, ""))
+		case volumes.Has(claim.Name):
+			errs = append(errs, field.Duplicate(namePath, claim.Name))
+		default:
+			for _, msg := range validation.IsDNS1123Label(claim.Name) {
+				errs = append(errs, field.Invalid(namePath, claim.Name, msg))
+			}
+		}
+		volumes.Insert(claim.Name)
+	}
+	if podSetSpec.Template != nil {
+		for _, volume := range podSetSpec.Template.Spec.Volumes {
+			volumes.Insert(volume.Name)
+		}
+	}
+	for i, mounts := range podSetSpec.VolumeMounts {
+		for j, mount := range mounts.VolumeMounts {
+			mountPath := path.Child("volumeMounts").Index(i).Child("volumeMounts").Index(j)
+			if !volumes.Has(mount.Name) && podSetSpec.PodOverrides == nil {
+				errs = append(errs, field.NotFound(mountPath.Child("name"), mount.Name))
+			}
+			if !strings.HasPrefix(mount.MountPath, "/") {
+				errs = append(errs, field.Invalid(mountPath.Child("mountPath"), mount.MountPath, "must be an absolute path"))
+			}
+		}
+	}
+	return errs
+}
+
+// validateProbe checks that a probe, if set, has exactly one handler.
+func validateProbe(probe *corev1.Probe, path *field.Path) field.ErrorList {
+	if probe == nil {
+		return nil
+	}
+	handlers := 0
+	for _, set := range []bool{probe.Exec != nil, probe.HTTPGet != nil, probe.TCPSocket != nil, probe.GRPC != nil} {
+		if set {
+			handlers++
+		}
+	}
+	if handlers != 1 {
+		return field.ErrorList{field.Invalid(path, "", "must specify exactly one of exec, httpGet, tcpSocket or grpc")}
+	}
+	return nil
+}
+
+// validateCleanup checks that cleanup resources come with a selector and
+// that the hook URL is an absolute http or https URL.
+func validateCleanup(cleanup *CleanupSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(cleanup.Resources) > 0 && cleanup.Selector == nil {
+		errs = append(errs, field.Required(path.Child("selector"), "must be set to delete resources"))
+	}
+	errs = append(errs, metav1validation.ValidateLabelSelector(cleanup.Selector, path.Child("selector"))...)
+	if cleanup.Hook != nil {
+		hookURL := path.Child("hook", "url")
+		u, err := url.Parse(cleanup.Hook.URL)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(hookURL, cleanup.Hook.URL, err.Error()))
+		case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+			errs = append(errs, field.Invalid(hookURL, cleanup.Hook.URL, "must be an absolute http or https URL"))
+		}
+	}
+	return errs
+}
+
+// ValidatePodOverrides checks that podOverrides parses as a Pod, applies as a
+// strategic merge patch and leaves alone the fields the controller relies on
+// to track its pods. The webhook and the controller, which refuses to create
+// pods from invalid overrides, both check with it.
+func ValidatePodOverrides(podSetSpec *PodSetSpec, path *field.Path) field.ErrorList {
+	raw := podSetSpec.PodOverrides.Raw
+	if len(raw) == 0 {
+		return nil
+	}
+	override := &corev1.Pod{}
+	if err := json.Unmarshal(raw, override); err != nil {
+		return field.ErrorList{field.Invalid(path, string(raw), "must be a valid Pod: "+err.Error())}
+	}
+	if _, err := strategicpatch.StrategicMergePatch([]byte("{}"), raw, corev1.Pod{}); err != nil {
+		return field.ErrorList{field.Invalid(path, string(raw), "must apply as a strategic merge patch: "+err.Error())}
+	}
+
+	var errs field.ErrorList
+	metadata := path.Child("metadata")
+	if len(override.OwnerReferences) > 0 {
+		errs = append(errs, field.Forbidden(metadata.Child("ownerReferences"), "owner references are set by the controller"))
+	}
+	errs = append(errs, metav1validation.ValidateLabels(override.Labels, metadata.Child("labels"))...)
+	selectorLabels := map[string]string{"app": "", "version": ""}
+	if podSetSpec.Selector != nil {
+		selectorLabels = podSetSpec.Selector.MatchLabels
+	}
+	for key := range override.Labels {
+		if _, ok := selectorLabels[key]; ok {
+			errs = append(errs, field.Forbidden(metadata.Child("labels").Key(key), "the controller selects its pods by this label"))
+		}
+		switch key {
+		case OwnerUIDLabel, OwnerNamespaceLabel, OwnerNameLabel:
+			errs = append(errs, field.Forbidden(metadata.Child("labels").Key(key), "the controller tracks its pods by this label"))
+		}
+	}
+	if override.Spec.ServiceAccountName != "" && podSetSpec.ServiceAccount != nil && podSetSpec.ServiceAccount.Create {
+		errs = append(errs, field.Forbidden(path.Child("spec", "serviceAccountName"), "must not be set when serviceAccount.create is true"))
+	}
+	for i, container := range override.Spec.InitContainers {
+		if container.Name == "" {
+			errs = append(errs, field.Required(path.Child("spec", "initContainers").Index(i).Child("name"), "containers are merged by name"))
+		}
+	}
+	for i, container := range override.Spec.Containers {
+		if container.Name == "" {
+			errs = append(errs, field.Required(path.Child("spec", "containers").Index(i).Child("name"), "containers are merged by name"))
+		}
+	}
+	return errs
+}
+
+// validatePodTemplate checks the labels, selectors and containers of a pod
+// template.
+func validatePodTemplate(template *corev1.PodTemplateSpec, path *field.Path) field.ErrorList {
+	errs := metav1validation.ValidateLabels(template.Labels, path.Child("metadata", "labels"))
+	for key := range template.Annotations {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, field.Invalid(path.Child("metadata", "annotations"), key, msg))
+		}
+	}
+
+	spec := path.Child("spec")
+	errs = append(errs, metav1validation.ValidateLabels(template.Spec.NodeSelector, spec.Child("nodeSelector"))...)
+	if template.Spec.Affinity != nil {
+		errs = append(errs, validateAffinity(template.Spec.Affinity, spec.Child("affinity"))...)
+	}
+
+	containers := spec.Child("containers")
+	if len(template.Spec.Containers) == 0 {
+		errs = append(errs, field.Required(containers, "must have at least one container"))
+	}
+	names := sets.NewString()
+	for i, container := range template.Spec.InitContainers {
+		errs = append(errs, validateContainer(&container, names, spec.Child("initContainers").Index(i))...)
+	}
+	for i, container := range template.Spec.Containers {
+		errs = append(errs, validateContainer(&container, names, containers.Index(i))...)
+	}
+	return errs
+}
+
+// validateAffinity checks the label selectors of pod affinity and
+// anti-affinity.
+func validateAffinity(affinity *corev1.Affinity, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if affinity.PodAffinity != nil {
+		errs = append(errs, validatePodAffinityTerms(affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution, path.Child("podAffinity"))...)
+	}
+	if affinity.PodAntiAffinity != nil {
+		errs = append(errs, validatePodAffinityTerms(affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, path.Child("podAntiAffinity"))...)
+	}
+	return errs
+}
+
+// validatePodAffinityTerms checks the label selectors of pod affinity terms.
+func validatePodAffinityTerms(required []corev1.PodAffinityTerm, preferred []corev1.WeightedPodAffinityTerm, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, term := range required {
+		termPath := path.Child("requiredDuringSchedulingIgnoredDuringExecution").Index(i)
+		errs = append(errs, metav1validation.ValidateLabelSelector(term.LabelSelector, termPath.Child("labelSelector"))...)
+	}
+	for i, term := range preferred {
+		termPath := path.Child("preferredDuringSchedulingIgnoredDuringExecution").Index(i).Child("podAffinityTerm")
+		errs = append(errs, metav1validation.ValidateLabelSelector(term.PodAffinityTerm.LabelSelector, termPath.Child("labelSelector"))...)
+	}
+	return errs
+}
+
+// validateContainer checks that a container has a unique DNS label for a
+// name, an image and valid resources. Names holds the names of the containers seen so far.
+func validateContainer(container *corev1.Container, names sets.String, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case container.Name == "":
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	case names.Has(container.Name):
+		errs = append(errs, field.Duplicate(path.Child("name"), container.Name))
+	default:
+		for _, msg := range validation.IsDNS1123Label(container.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), container.Name, msg))
+		}
+	}
+	names.Insert(container.Name)
+	if container.Image == "" {
+		errs = append(errs, field.Required(path.Child("image"), ""))
+	}
+	errs = append(errs, validateResources(&container.Resources, path.Child("resources"))...)
+	return errs
+}
+
+//+kubebuilder:webhook:path=/validate-podset-example-com-v1alpha1-podset-scale,mutating=false,failurePolicy=fail,sideEffects=None,groups=podset.example.com,resources=podsets/scale,verbs=update,versions=v1alpha1,name=vpodsetscale.kb.io,admissionReviewVersions=v1
+
+// scaleValidator applies the scale-down guard to updates of the scale
+// subresource. A Scale carries no annotations of the PodSet, so a drastic
+// scale-down through it cannot be confirmed and has to be made in steps or
+// by updating the PodSet itself.
+type scaleValidator struct {
+	decoder *admission.Decoder
+}
+
+// Handle implements admission.Handler.
+func (v *scaleValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	scale, oldScale := &autoscalingv1.Scale{}, &autoscalingv1.Scale{}
+	if err := v.decoder.Decode(req, scale); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := v.decoder.DecodeRaw(req.OldObject, oldScale); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	podsetlog.Info("validate scale", "name", req.Name)
+
+	if err := scaleDownGuard.check(req.Namespace+"/"+req.Name, oldScale.Spec.Replicas, scale.Spec.Replicas); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// validateClaimTemplateUpdate allows the claim templates to change only by
+// growing their storage requests, which the controller expands the
+// existing claims to.
+func validateClaimTemplateUpdate(old, updated []VolumeClaimTemplate, path *field.Path) field.ErrorList {
+	if len(old) != len(updated) {
+		return field.ErrorList{field.Forbidden(path, "claim templates cannot be added or removed")}
+	}
+	var errs field.ErrorList
+	for i := range updated {
+		oldStorage := old[i].Spec.Resources.Requests[corev1.ResourceStorage]
+		newStorage := updated[i].Spec.Resources.Requests[corev1.ResourceStorage]
+		storagePath := path.Index(i).Child("spec", "resources", "requests", string(corev1.ResourceStorage))
+		if newStorage.Cmp(oldStorage) < 0 {
+			errs = append(errs, field.Forbidden(storagePath, "storage requests can grow but not shrink"))
+			continue
+		}
+		oldTemplate, newTemplate := old[i].DeepCopy(), updated[i].DeepCopy()
+		delete(oldTemplate.Spec.Resources.Requests, corev1.ResourceStorage)
+		delete(newTemplate.Spec.Resources.Requests, corev1.ResourceStorage)
+		if !equality.Semantic.DeepEqual(oldTemplate, newTemplate) {
+			errs = append(errs, field.Forbidden(path.Index(i), "claim templates are immutable except for their storage requests"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func claimTemplates(storage, mode string) []VolumeClaimTemplate {
+	return []VolumeClaimTemplate{{
+		Name: "data",
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.PersistentVolumeAccessMode(mode)},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+			},
+		},
+	}}
+}
+
+func TestValidateClaimTemplateUpdate(t *testing.T) {
+	path := field.NewPath("spec", "volumeClaimTemplates")
+	for _, tc := range []struct {
+		name    string
+		old     []VolumeClaimTemplate
+		updated []VolumeClaimTemplate
+		valid   bool
+	}{
+		{"unchanged", claimTemplates("1Gi", "ReadWriteOnce"), claimTemplates("1Gi", "ReadWriteOnce"), true},
+		{"grown", claimTemplates("1Gi", "ReadWriteOnce"), claimTemplates("2Gi", "ReadWriteOnce"), true},
+		{"shrunk", claimTemplates("2Gi", "ReadWriteOnce"), claimTemplates("1Gi", "ReadWriteOnce"), false},
+		{"other field changed", claimTemplates("1Gi", "ReadWriteOnce"), claimTemplates("1Gi", "ReadWriteMany"), false},
+		{"removed", claimTemplates("1Gi", "ReadWriteOnce"), nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := validateClaimTemplateUpdate(tc.old, tc.updated, path)
+			if valid := len(errs) == 0; valid != tc.valid {
+				t.Errorf("valid = %v, want %v: %v", valid, tc.valid, errs)
+			}
+		})
+	}
+}
+
+func TestTargetNamespaceAllowed(t *testing.T) {
+	defer func(saved []string) { allowedTargetNamespaces = saved }(allowedTargetNamespaces)
+	for _, tc := range []struct {
+		name    string
+		allowed []string
+		target  string
+		valid   bool
+	}{
+		{"own namespace", nil, "", true},
+		{"own namespace named", nil, "default", true},
+		{"none allowed", nil, "apps", false},
+		{"listed", []string{"tools", "apps"}, "apps", true},
+		{"not listed", []string{"tools"}, "apps", false},
+		{"wildcard", []string{"*"}, "apps", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			allowedTargetNamespaces = tc.allowed
+			podSet := &PodSet{Spec: PodSetSpec{TargetNamespace: tc.target}}
+			podSet.Namespace = "default"
+			if err := podSet.validate(); (err == nil) != tc.valid {
+				t.Errorf("validate() = %v, want valid %v", err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestValidatePodOverrides(t *testing.T) {
+	path := field.NewPath("spec", "podOverrides")
+	for _, tc := range []struct {
+		name     string
+		override string
+		spec     PodSetSpec
+		valid    bool
+	}{
+		{name: "container env", override: `{"spec":{"containers":[{"name":"app","env":[{"name":"A","value":"b"}]}]}}`, valid: true},
+		{name: "extra label", override: `{"metadata":{"labels":{"team":"a"}}}`, valid: true},
+		{name: "not a pod", override: `{"spec":{"containers":"app"}}`, valid: false},
+		{name: "owner references", override: `{"metadata":{"ownerReferences":[{"name":"x"}]}}`, valid: false},
+		{name: "default selector label", override: `{"metadata":{"labels":{"app":"other"}}}`, valid: false},
+		{name: "custom selector label", override: `{"metadata":{"labels":{"tier":"web"}}}`, valid: false,
+			spec: PodSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}}}},
+		{name: "owner label", override: `{"metadata":{"labels":{"podset.example.com/owner-uid":"x"}}}`, valid: false},
+		{name: "owner name label", override: `{"metadata":{"labels":{"podset.example.com/owner-name":"x"}}}`, valid: false,
+			spec: PodSetSpec{TargetNamespace: "pods"}},
+		{name: "container without name", override: `{"spec":{"containers":[{"image":"busybox"}]}}`, valid: false},
+		{name: "service account created", override: `{"spec":{"serviceAccountName":"other"}}`, valid: false,
+			spec: PodSetSpec{ServiceAccount: &ServiceAccountSpec{Create: true}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := tc.spec
+			spec.PodOverrides = &runtime.RawExtension{Raw: []byte(tc.override)}
+			errs := ValidatePodOverrides(&spec, path)
+			if valid := len(errs) == 0; valid != tc.valid {
+				t.Errorf("valid = %v, want %v: %v", valid, tc.valid, errs)
+			}
+		})
+	}
+}
+
+func TestValidateDelete(t *testing.T) {
+	podSet := &PodSet{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	if err := podSet.ValidateDelete(); err != nil {
+		t.Errorf("deleting an unprotected PodSet: %v", err)
+	}
+	podSet.Annotations = map[string]string{DeletionProtectedAnnotation: "true"}
+	if err := podSet.ValidateDelete(); err == nil {
+		t.Error("deleting a protected PodSet was allowed")
+	}
+	podSet.Annotations[DeletionProtectedAnnotation] = "false"
+	if err := podSet.ValidateDelete(); err != nil {
+		t.Errorf("deleting a PodSet whose protection is off: %v", err)
+	}
+}
+
+func TestScaleDownGuardCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		guard    ScaleDownGuard
+		old, new int32
+		allowed  bool
+	}{
+		{"disabled", ScaleDownGuard{}, 10, 0, true},
+		{"scale-up", ScaleDownGuard{MaxPods: 1}, 2, 10, true},
+		{"within pods", ScaleDownGuard{MaxPods: 3}, 10, 7, true},
+		{"beyond pods", ScaleDownGuard{MaxPods: 3}, 10, 6, false},
+		{"within percent", ScaleDownGuard{MaxPercent: 50}, 10, 5, true},
+		{"beyond percent", ScaleDownGuard{MaxPercent: 50}, 10, 4, false},
+		{"either bound", ScaleDownGuard{MaxPods: 3, MaxPercent: 90}, 10, 5, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.guard.check("default/web", tc.old, tc.new)
+			if allowed := err == nil; allowed != tc.allowed {
+				t.Errorf("allowed = %v, want %v: %v", allowed, tc.allowed, err)
+			}
+		})
+	}
+}
+
+func TestValidateUpdateScaleDownGuard(t *testing.T) {
+	defer func(guard ScaleDownGuard) { scaleDownGuard = guard }(scaleDownGuard)
+	scaleDownGuard = ScaleDownGuard{MaxPods: 2}
+
+	old := &PodSet{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Spec: PodSetSpec{Replicas: 10}}
+	podSet := old.DeepCopy()
+	podSet.Spec.Replicas = 5
+	if err := podSet.ValidateUpdate(old); err == nil {
+		t.Error("scaling down by 5 pods was allowed, want it rejected")
+	}
+	podSet.Annotations = map[string]string{ConfirmScaleDownAnnotation: "true"}
+	if err := podSet.ValidateUpdate(old); err != nil {
+		t.Errorf("confirmed scale-down: %v", err)
+	}
+
+	// A sharded PodSet is guarded on its total replicas.
+	old.Spec = PodSetSpec{Shards: 4, ReplicasPerShard: 2}
+	podSet = old.DeepCopy()
+	podSet.Spec.Shards = 2
+	if err := podSet.ValidateUpdate(old); err == nil {
+		t.Error("removing 2 shards of 2 pods was allowed, want it rejected")
+	}
+	podSet.Annotations = map[string]string{ConfirmScaleDownAnnotation: "true"}
+	if err := podSet.ValidateUpdate(old); err != nil {
+		t.Errorf("confirmed removal of 2 shards: %v", err)
+	}
+}
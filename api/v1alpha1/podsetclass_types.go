@@ -0,0 +1,72 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodSetClassSpec defines the pod defaults of a PodSetClass. They apply under
+// the PodSet's own values: anything the PodSet's podOverrides set wins.
+type PodSetClassSpec struct {
+	// Tolerations are given to the pods unless the PodSet sets its own.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// NodeSelector is merged under the pods' node selector.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// RuntimeClassName is the default RuntimeClass of the pods.
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+
+	// PriorityClassName is the default PriorityClass of the pods.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Resources are the default compute resources of every container of the
+	// pods, merged under each container's own.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// PodSetClass is the Schema for the podsetclasses API. PodSets select a
+// class by name with spec.className.
+type PodSetClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PodSetClassSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PodSetClassList contains a list of PodSetClass
+type PodSetClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PodSetClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PodSetClass{}, &PodSetClassList{})
+}
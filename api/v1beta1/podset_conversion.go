@@ -0,0 +1,166 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// v1alpha1SpecAnnotation holds the v1alpha1 spec fields that have no
+// counterpart in v1beta1, as JSON, so that they survive a PodSet being read
+// and written back as v1beta1.
+const v1alpha1SpecAnnotation = "podset.example.com/v1alpha1-spec"
+
+// v1alpha1StatusAnnotation does the same for the v1alpha1 status fields.
+const v1alpha1StatusAnnotation = "podset.example.com/v1alpha1-status"
+
+// popAnnotation unmarshals the JSON of the annotation into v and removes the
+// annotation.
+func popAnnotation(annotations *map[string]string, key string, v interface{}) error {
+	raw, ok := (*annotations)[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), v); err != nil {
+		return err
+	}
+	delete(*annotations, key)
+	if len(*annotations) == 0 {
+		*annotations = nil
+	}
+	return nil
+}
+
+// pushAnnotation sets the annotation to the JSON of v, unless v is empty.
+func pushAnnotation(annotations *map[string]string, key string, v, empty interface{}) error {
+	if equality.Semantic.DeepEqual(v, empty) {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if *annotations == nil {
+		*annotations = map[string]string{}
+	}
+	(*annotations)[key] = string(raw)
+	return nil
+}
+
+// ConvertTo converts this PodSet to the hub version, v1alpha1.
+func (src *PodSet) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.PodSet)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1alpha1.PodSetSpec{}
+	if err := popAnnotation(&dst.Annotations, v1alpha1SpecAnnotation, &dst.Spec); err != nil {
+		return err
+	}
+	dst.Status = v1alpha1.PodSetStatus{}
+	if err := popAnnotation(&dst.Annotations, v1alpha1StatusAnnotation, &dst.Status); err != nil {
+		return err
+	}
+
+	dst.Spec.Replicas = 1
+	if src.Spec.Replicas != nil {
+		dst.Spec.Replicas = *src.Spec.Replicas
+	}
+	dst.Spec.Selector = src.Spec.Selector.DeepCopy()
+	dst.Spec.Template = src.Spec.Template.DeepCopy()
+	dst.Spec.UpdateStrategy.Type = v1alpha1.PodSetUpdateStrategyType(src.Spec.Strategy.Type)
+	dst.Spec.UpdateStrategy.RollingUpdate = nil
+	if ru := src.Spec.Strategy.RollingUpdate; ru != nil {
+		dst.Spec.UpdateStrategy.RollingUpdate = &v1alpha1.RollingUpdatePodSetStrategy{
+			BatchSize:       ru.BatchSize,
+			RequireApproval: ru.RequireApproval,
+		}
+	}
+	dst.Spec.MinReadySeconds = src.Spec.MinReadySeconds
+	dst.Spec.Paused = src.Spec.Paused
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.DesiredReplicas = src.Status.DesiredReplicas
+	dst.Status.Replicas = src.Status.Replicas
+	dst.Status.AvailableReplicas = src.Status.AvailableReplicas
+	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
+	dst.Status.UpdatedReplicas = src.Status.UpdatedReplicas
+	dst.Status.Selector = src.Status.Selector
+	dst.Status.Conditions = src.Status.Conditions
+	return nil
+}
+
+// ConvertFrom converts from the hub version, v1alpha1, to this version.
+func (dst *PodSet) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.PodSet)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	replicas := src.Spec.Replicas
+	dst.Spec = PodSetSpec{
+		Replicas:        &replicas,
+		Selector:        src.Spec.Selector.DeepCopy(),
+		Template:        src.Spec.Template.DeepCopy(),
+		MinReadySeconds: src.Spec.MinReadySeconds,
+		Paused:          src.Spec.Paused,
+		Strategy: PodSetUpdateStrategy{
+			Type: PodSetUpdateStrategyType(src.Spec.UpdateStrategy.Type),
+		},
+	}
+	if ru := src.Spec.UpdateStrategy.RollingUpdate; ru != nil {
+		dst.Spec.Strategy.RollingUpdate = &RollingUpdatePodSetStrategy{
+			BatchSize:       ru.BatchSize,
+			RequireApproval: ru.RequireApproval,
+		}
+	}
+
+	// Keep whatever v1beta1 has no field for.
+	rest := src.Spec.DeepCopy()
+	rest.Replicas = 0
+	rest.Selector = nil
+	rest.Template = nil
+	rest.UpdateStrategy.Type = ""
+	rest.UpdateStrategy.RollingUpdate = nil
+	rest.MinReadySeconds = 0
+	rest.Paused = false
+	if err := pushAnnotation(&dst.Annotations, v1alpha1SpecAnnotation, *rest, v1alpha1.PodSetSpec{}); err != nil {
+		return err
+	}
+
+	dst.Status = PodSetStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+		DesiredReplicas:    src.Status.DesiredReplicas,
+		Replicas:           src.Status.Replicas,
+		AvailableReplicas:  src.Status.AvailableReplicas,
+		ReadyReplicas:      src.Status.ReadyReplicas,
+		UpdatedReplicas:    src.Status.UpdatedReplicas,
+		Selector:           src.Status.Selector,
+		Conditions:         src.Status.Conditions,
+	}
+	restStatus := src.Status.DeepCopy()
+	restStatus.ObservedGeneration = 0
+	restStatus.DesiredReplicas = 0
+	restStatus.Replicas = 0
+	restStatus.AvailableReplicas = 0
+	restStatus.ReadyReplicas = 0
+	restStatus.UpdatedReplicas = 0
+	restStatus.Selector = ""
+	restStatus.Conditions = nil
+	return pushAnnotation(&dst.Annotations, v1alpha1StatusAnnotation, *restStatus, v1alpha1.PodSetStatus{})
+}
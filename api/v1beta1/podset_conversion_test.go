@@ -0,0 +1,72 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestConversionRoundTrip(t *testing.T) {
+	hub := &v1alpha1.PodSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: v1alpha1.PodSetSpec{
+			Replicas:        0,
+			MinReadySeconds: 5,
+			TargetNamespace: "apps",
+		},
+		Status: v1alpha1.PodSetStatus{
+			PodNames:          []string{"web-0", "web-1"},
+			Replicas:          2,
+			AvailableReplicas: 1,
+			StuckPendingPods:  []string{"web-1"},
+		},
+	}
+
+	spoke := &PodSet{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.Replicas == nil || *spoke.Spec.Replicas != 0 {
+		t.Errorf("v1beta1 replicas = %v, want 0", spoke.Spec.Replicas)
+	}
+	if spoke.Status.Replicas != 2 || spoke.Status.AvailableReplicas != 1 {
+		t.Errorf("v1beta1 status = %+v, want the replica counts of v1alpha1", spoke.Status)
+	}
+
+	back := &v1alpha1.PodSet{}
+	if err := spoke.ConvertTo(back); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(hub, back) {
+		t.Errorf("round trip changed the PodSet:\n got %+v\nwant %+v", back, hub)
+	}
+}
+
+func TestConvertToDefaultsReplicas(t *testing.T) {
+	hub := &v1alpha1.PodSet{}
+	if err := (&PodSet{}).ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Spec.Replicas != 1 {
+		t.Errorf("replicas = %d, want the v1beta1 default of 1", hub.Spec.Replicas)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodSetUpdateStrategyType names how outdated pods are replaced.
+// +kubebuilder:validation:Enum=RollingUpdate;OnDelete
+type PodSetUpdateStrategyType string
+
+const (
+	// RollingUpdatePodSetStrategyType replaces outdated pods in batches, as
+	// configured by rollingUpdate.
+	RollingUpdatePodSetStrategyType PodSetUpdateStrategyType = "RollingUpdate"
+	// OnDeletePodSetStrategyType leaves outdated pods running until they
+	// are deleted.
+	OnDeletePodSetStrategyType PodSetUpdateStrategyType = "OnDelete"
+)
+
+// PodSetSpec defines the desired state of PodSet. The fields of v1alpha1
+// that have no counterpart here are kept when a PodSet is read and written
+// as v1beta1.
+// +kubebuilder:validation:XValidation:rule="has(self.selector) == has(oldSelf.selector)",message="selector cannot be added or removed"
+type PodSetSpec struct {
+	// Replicas is the number of pods to run. Defaults to 1.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Selector selects the PodSet's pods in place of the default app and
+	// version labels. The controller stamps its matchLabels, which must not
+	// be empty, on the pods it creates, and the template's labels must
+	// satisfy it. It cannot be added, removed or changed once the PodSet
+	// exists.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="selector is immutable"
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Template describes the pods that will be created. Its labels are
+	// merged with the labels the controller selects its pods by, which take
+	// precedence. Defaults to a single busybox container that sleeps.
+	// +optional
+	Template *corev1.PodTemplateSpec `json:"template,omitempty"`
+
+	// Strategy controls how pods created from an earlier version of the
+	// spec are replaced. By default they are replaced one at a time.
+	// +optional
+	Strategy PodSetUpdateStrategy `json:"strategy,omitempty"`
+
+	// MinReadySeconds is how long a pod must have been Ready before it
+	// counts as available. Defaults to 0, counting a pod as soon as it is
+	// Ready.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+
+	// Paused stops the controller from creating, deleting or changing the
+	// PodSet's pods while it is true. Status is still kept up to date.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// PodSetUpdateStrategy describes how outdated pods are replaced.
+type PodSetUpdateStrategy struct {
+	// Type is RollingUpdate, the default, to replace outdated pods or
+	// OnDelete to leave them running until they are deleted.
+	// +optional
+	// +kubebuilder:default=RollingUpdate
+	Type PodSetUpdateStrategyType `json:"type,omitempty"`
+
+	// RollingUpdate replaces outdated pods in batches. Defaults to batches
+	// of one pod.
+	// +optional
+	RollingUpdate *RollingUpdatePodSetStrategy `json:"rollingUpdate,omitempty"`
+}
+
+// RollingUpdatePodSetStrategy replaces outdated pods a batch at a time,
+// starting the next batch once every updated pod is Ready.
+type RollingUpdatePodSetStrategy struct {
+	// BatchSize is the number of outdated pods replaced at a time. Defaults
+	// to 1.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	BatchSize int32 `json:"batchSize,omitempty"`
+
+	// RequireApproval pauses the rollout after each batch until the
+	// podset.example.com/approve-batch annotation is set to a new value.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// PodSetStatus defines the observed state of PodSet. As with the spec, the
+// v1alpha1 status fields that have no counterpart here are kept when a
+// PodSet is read and written as v1beta1.
+type PodSetStatus struct {
+	// ObservedGeneration is the generation of the spec that the controller
+	// last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// DesiredReplicas is the number of pods the controller last aimed to
+	// run.
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+
+	// Replicas is the number of running and pending pods.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// AvailableReplicas is the number of pods that have been Ready for
+	// spec.minReadySeconds.
+	AvailableReplicas int32 `json:"availableReplicas"`
+
+	// ReadyReplicas is the number of pods that are Ready.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// UpdatedReplicas is the number of running and pending pods created from the
+	// current pod template.
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+
+	// Selector is the label selector of the PodSet's pods, in string form,
+	// for the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// Conditions represent the latest available observations of the
+	// PodSet's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+//+kubebuilder:resource:shortName=ps,categories=all
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredReplicas`,description="Number of pods the controller aims to run"
+//+kubebuilder:printcolumn:name="Available",type=integer,JSONPath=`.status.availableReplicas`,description="Number of pods Ready for minReadySeconds"
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`,priority=1,description="Number of Ready pods"
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PodSet is the Schema for the podsets API
+type PodSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PodSetSpec   `json:"spec,omitempty"`
+	Status PodSetStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PodSetList contains a list of PodSet
+type PodSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PodSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PodSet{}, &PodSetList{})
+}
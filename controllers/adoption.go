@@ -0,0 +1,98 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const reasonPodAdopted = "PodAdopted"
+
+// adoptPods makes the PodSet the controller of the pods in its namespace
+// that match its selector and have no controller, as a ReplicaSet does, and
+// reports whether it adopted any. Pods outside the PodSet's namespace cannot
+// carry an owner reference and are matched by their owner labels instead.
+func (r *PodSetReconciler) adoptPods(ctx context.Context, podSet *podsetv1alpha1.PodSet) (bool, error) {
+	log := ctrllog.FromContext(ctx)
+	if isCrossNamespace(podSet) {
+		return false, nil
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(podSet.Namespace), client.MatchingLabelsSelector{Selector: podSelector(podSet)}); err != nil {
+		return false, err
+	}
+	adopted := false
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || metav1.GetControllerOf(pod) != nil {
+			continue
+		}
+		// The optimistic lock keeps two controllers racing for the pod from
+		// both adopting it.
+		patch := client.MergeFromWithOptions(pod.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		if err := controllerutil.SetControllerReference(podSet, pod, r.Scheme); err != nil {
+			return false, err
+		}
+		log.Info("Adopting pod", "pod.name", pod.Name)
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			if errors.IsNotFound(err) || errors.IsConflict(err) {
+				continue
+			}
+			return false, err
+		}
+		r.expectations.expectCreate(types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}, pod.Name, time.Now())
+		r.Recorder.Event(podSet, corev1.EventTypeNormal, reasonPodAdopted, fmt.Sprintf("Adopted pod %s", pod.Name))
+		adopted = true
+	}
+	return adopted, nil
+}
+
+// podSetsForOrphanPod maps a pod without a controller to the PodSets in its
+// namespace whose selector matches it, so that they can adopt it.
+func (r *PodSetReconciler) podSetsForOrphanPod(obj client.Object) []reconcile.Request {
+	if metav1.GetControllerOf(obj) != nil {
+		return nil
+	}
+	podSets := &podsetv1alpha1.PodSetList{}
+	if err := r.List(context.Background(), podSets, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, podSet := range podSets.Items {
+		if isCrossNamespace(&podSet) || isObserveOnly(&podSet) {
+			continue
+		}
+		if podSelector(&podSet).Matches(labels.Set(obj.GetLabels())) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}})
+		}
+	}
+	return requests
+}
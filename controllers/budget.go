@@ -0,0 +1,115 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	reasonBudgetExceeded = "BudgetExceeded"
+	reasonBudgetTooSmall = "BudgetTooSmall"
+)
+
+// budgetLimit returns the number of pods with the given requests that fit in
+// the budget, or -1 if the budget does not limit them. A resource that is
+// not budgeted, or not requested, places no limit.
+func budgetLimit(budget *podsetv1alpha1.ResourceBudget, requests podResources) int64 {
+	limit := int64(-1)
+	if budget.CPU != nil && requests.milliCPU > 0 {
+		limit = budget.CPU.MilliValue() / requests.milliCPU
+	}
+	if budget.Memory != nil && requests.memory > 0 {
+		if n := budget.Memory.Value() / requests.memory; limit < 0 || n < limit {
+			limit = n
+		}
+	}
+	return limit
+}
+
+// checkResourceBudget returns the number of pods the PodSet should run: the
+// desired replicas, clamped to what spec.resourceBudget allows. A budget too
+// small for a single pod, or for one pod per shard of a sharded PodSet, is
+// rejected; it reports false and the PodSet is not scaled until the budget
+// is fixed. Either way the outcome is recorded in the
+// BudgetExceeded condition of status.
+func (r *PodSetReconciler) checkResourceBudget(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, inputs *templateInputs) (int32, bool) {
+	desired := desiredReplicas(podSet)
+	budget := podSet.Spec.ResourceBudget
+	if budget == nil {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionBudgetExceeded)
+		return desired, true
+	}
+	template, err := podTemplate(podSet, inputs)
+	if err != nil {
+		// The render error is reported when pods are created.
+		return desired, true
+	}
+	requests := podRequests(template)
+	limit := budgetLimit(budget, requests)
+
+	var reason, message string
+	switch {
+	case limit == 0:
+		reason = reasonBudgetTooSmall
+		message = fmt.Sprintf("The resource budget is smaller than the requests of one pod (%dm CPU, %d bytes of memory)",
+			requests.milliCPU, requests.memory)
+	case limit >= 0 && limit < int64(desired):
+		clamped := int32(limit)
+		if isSharded(podSet) {
+			// Keep the shards even; each loses the same number of pods.
+			clamped = clamped / podSet.Spec.Shards * podSet.Spec.Shards
+		}
+		if clamped == 0 {
+			// Not a scale to zero: the budget is rejected like one too
+			// small for a single pod.
+			reason = reasonBudgetTooSmall
+			message = fmt.Sprintf("The resource budget allows %d pods, fewer than one for each of the %d shards", limit, podSet.Spec.Shards)
+			break
+		}
+		reason = reasonBudgetExceeded
+		message = fmt.Sprintf("The resource budget allows %d of the %d desired pods", clamped, desired)
+		desired = clamped
+	default:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionBudgetExceeded,
+			Status:             metav1.ConditionFalse,
+			Reason:             "WithinBudget",
+			Message:            "The desired pods fit in the resource budget",
+			ObservedGeneration: podSet.Generation,
+		})
+		return desired, true
+	}
+
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionBudgetExceeded) {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reason, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionBudgetExceeded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return desired, reason != reasonBudgetTooSmall
+}
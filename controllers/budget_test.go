@@ -0,0 +1,74 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+func TestCheckResourceBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		replicas int32
+		shards   int32
+		budget   *podsetv1alpha1.ResourceBudget
+		desired  int32
+		ok       bool
+		reason   string
+	}{
+		{name: "no budget", replicas: 4, desired: 4, ok: true},
+		{name: "within budget", replicas: 4, budget: &podsetv1alpha1.ResourceBudget{CPU: quantity("4")}, desired: 4, ok: true, reason: "WithinBudget"},
+		{name: "clamped", replicas: 4, budget: &podsetv1alpha1.ResourceBudget{CPU: quantity("2500m")}, desired: 2, ok: true, reason: reasonBudgetExceeded},
+		{name: "memory unbudgeted", replicas: 4, budget: &podsetv1alpha1.ResourceBudget{Memory: quantity("1Gi")}, desired: 4, ok: true, reason: "WithinBudget"},
+		{name: "too small", replicas: 4, budget: &podsetv1alpha1.ResourceBudget{CPU: quantity("500m")}, desired: 4, reason: reasonBudgetTooSmall},
+		{name: "clamped evenly across shards", shards: 2, budget: &podsetv1alpha1.ResourceBudget{CPU: quantity("3")}, desired: 2, ok: true, reason: reasonBudgetExceeded},
+		{name: "too small for the shards", shards: 4, budget: &podsetv1alpha1.ResourceBudget{CPU: quantity("3")}, desired: 8, reason: reasonBudgetTooSmall},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			podSet := capacityTestPodSet(tc.replicas, "1")
+			podSet.Spec.Shards = tc.shards
+			if tc.shards > 0 {
+				podSet.Spec.ReplicasPerShard = 2
+			}
+			podSet.Spec.ResourceBudget = tc.budget
+			r := newTestReconciler(t)
+			status := &podsetv1alpha1.PodSetStatus{}
+
+			desired, ok := r.checkResourceBudget(podSet, status, nil)
+			if desired != tc.desired || ok != tc.ok {
+				t.Errorf("checkResourceBudget = %d, %v, want %d, %v", desired, ok, tc.desired, tc.ok)
+			}
+			cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionBudgetExceeded)
+			switch {
+			case tc.reason == "" && cond != nil:
+				t.Errorf("BudgetExceeded = %+v, want none", cond)
+			case tc.reason != "" && (cond == nil || cond.Reason != tc.reason):
+				t.Errorf("BudgetExceeded = %+v, want reason %s", cond, tc.reason)
+			}
+		})
+	}
+}
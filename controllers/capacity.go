@@ -0,0 +1,238 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// capacityRefreshInterval is how long a computed view of the cluster's
+	// free capacity is reused before nodes and pods are listed again.
+	capacityRefreshInterval = 30 * time.Second
+
+	reasonInsufficientCapacity = "InsufficientCapacity"
+)
+
+// podResources are the CPU and memory requests of a pod, or the free
+// capacity of a node.
+type podResources struct {
+	milliCPU int64
+	memory   int64
+}
+
+// capacityCache holds the free capacity of each schedulable node, as last
+// computed.
+type capacityCache struct {
+	mu         sync.Mutex
+	computedAt time.Time
+	free       map[string]podResources
+}
+
+// podRequests returns the CPU and memory the pod requests: the sum over its
+// containers, or the largest init container if that is more.
+func podRequests(pod *corev1.Pod) podResources {
+	var total podResources
+	for _, container := range pod.Spec.Containers {
+		total.milliCPU += container.Resources.Requests.Cpu().MilliValue()
+		total.memory += container.Resources.Requests.Memory().Value()
+	}
+	for _, container := range pod.Spec.InitContainers {
+		if cpu := container.Resources.Requests.Cpu().MilliValue(); cpu > total.milliCPU {
+			total.milliCPU = cpu
+		}
+		if memory := container.Resources.Requests.Memory().Value(); memory > total.memory {
+			total.memory = memory
+		}
+	}
+	return total
+}
+
+// freeCapacity returns the allocatable capacity left on each schedulable,
+// Ready node after the requests of the pods bound to it. The result is
+// reused for capacityRefreshInterval, as it lists every node and pod. With
+// a ScopedPodCache, the pods are listed from the API server, since the cache
+// misses those of other workloads.
+func (r *PodSetReconciler) freeCapacity(ctx context.Context) (map[string]podResources, error) {
+	r.capacity.mu.Lock()
+	defer r.capacity.mu.Unlock()
+	if r.capacity.free != nil && time.Since(r.capacity.computedAt) < capacityRefreshInterval {
+		return r.capacity.free, nil
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	free := map[string]podResources{}
+	for _, node := range nodes.Items {
+		ready := false
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == corev1.NodeReady {
+				ready = cond.Status == corev1.ConditionTrue
+			}
+		}
+		if node.Spec.Unschedulable || !ready {
+			continue
+		}
+		free[node.Name] = podResources{
+			milliCPU: node.Status.Allocatable.Cpu().MilliValue(),
+			memory:   node.Status.Allocatable.Memory().Value(),
+		}
+	}
+
+	var podReader client.Reader = r.Client
+	if r.ScopedPodCache && r.APIReader != nil {
+		podReader = r.APIReader
+	}
+	pods := &corev1.PodList{}
+	if err := podReader.List(ctx, pods); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		nodeFree, ok := free[pod.Spec.NodeName]
+		if !ok || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		requests := podRequests(pod)
+		nodeFree.milliCPU -= requests.milliCPU
+		nodeFree.memory -= requests.memory
+		free[pod.Spec.NodeName] = nodeFree
+	}
+
+	r.capacity.free = free
+	r.capacity.computedAt = time.Now()
+	return free, nil
+}
+
+// checkCapacity estimates how many new pods of the PodSet the cluster can
+// still fit and records a shortfall for the missing pods in the
+// InsufficientCapacity condition of status. It returns -1, placing no limit
+// on scale-up, when the check is disabled or cannot be made with confidence:
+// the pods request no resources, or the cluster cannot be listed.
+func (r *PodSetReconciler) checkCapacity(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) int {
+	log := ctrllog.FromContext(ctx)
+	if !r.CapacityCheck {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionInsufficientCapacity)
+		return -1
+	}
+	missing := int(state.desired) - len(state.available)
+	if missing <= 0 {
+		clearInsufficientCapacity(podSet, status)
+		return -1
+	}
+	template, err := podTemplate(podSet, &state.inputs)
+	if err != nil {
+		return -1
+	}
+	requests := podRequests(template)
+	if requests.milliCPU <= 0 && requests.memory <= 0 {
+		clearInsufficientCapacity(podSet, status)
+		return -1
+	}
+	free, err := r.freeCapacity(ctx)
+	if err != nil || len(free) == 0 {
+		log.Info("Skipping capacity check, cluster capacity is unknown", "error", err)
+		clearInsufficientCapacity(podSet, status)
+		return -1
+	}
+
+	nodes := state.usableNodes
+	if len(podSet.Spec.NodeNames) == 0 {
+		nodes = make([]string, 0, len(free))
+		for name := range free {
+			nodes = append(nodes, name)
+		}
+	}
+	fits := 0
+	for _, name := range nodes {
+		nodeFree := free[name]
+		n := -1
+		if requests.milliCPU > 0 {
+			n = int(nodeFree.milliCPU / requests.milliCPU)
+		}
+		if requests.memory > 0 {
+			if m := int(nodeFree.memory / requests.memory); n < 0 || m < n {
+				n = m
+			}
+		}
+		if n > 0 {
+			fits += n
+		}
+	}
+	// Pods of this PodSet that are still waiting for a node will take some
+	// of that room.
+	for _, pod := range state.available {
+		if pod.Spec.NodeName == "" {
+			fits--
+		}
+	}
+	if fits < 0 {
+		fits = 0
+	}
+
+	if fits >= missing {
+		clearInsufficientCapacity(podSet, status)
+		return -1
+	}
+	message := fmt.Sprintf("%d pods are missing but the cluster has room for about %d (each requests %dm CPU and %d bytes of memory)",
+		missing, fits, requests.milliCPU, requests.memory)
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionInsufficientCapacity) {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonInsufficientCapacity, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionInsufficientCapacity,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonInsufficientCapacity,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return fits
+}
+
+// clearInsufficientCapacity records in status that the missing pods fit, or
+// that the check could not tell.
+func clearInsufficientCapacity(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionInsufficientCapacity,
+		Status:             metav1.ConditionFalse,
+		Reason:             "CapacityAvailable",
+		Message:            "No capacity shortfall detected",
+		ObservedGeneration: podSet.Generation,
+	})
+}
+
+// limitToCapacity drops the new pods beyond the capacity estimated by
+// checkCapacity. A negative capacity places no limit.
+func limitToCapacity(capacity int, pods []*corev1.Pod) []*corev1.Pod {
+	if capacity >= 0 && len(pods) > capacity {
+		return pods[:capacity]
+	}
+	return pods
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func capacityTestNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func capacityTestPod(name, cpu string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName: "node-a",
+			Containers: []corev1.Container{{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+				},
+			}},
+		},
+	}
+}
+
+func TestFreeCapacitySubtractsPodRequests(t *testing.T) {
+	r := newTestReconciler(t, capacityTestNode(), capacityTestPod("a", "1"), capacityTestPod("b", "500m"))
+	free, err := r.freeCapacity(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := free["node-a"].milliCPU; got != 2500 {
+		t.Errorf("free CPU = %dm, want 2500m", got)
+	}
+}
+
+func TestFreeCapacityListsPodsFromAPIReaderWhenCacheIsScoped(t *testing.T) {
+	// The cache holds only the managed pod; the API server has both.
+	r := newTestReconciler(t, capacityTestNode(), capacityTestPod("managed", "1"))
+	r.APIReader = newTestReconciler(t, capacityTestPod("managed", "1"), capacityTestPod("other", "2")).Client
+	r.ScopedPodCache = true
+
+	free, err := r.freeCapacity(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := free["node-a"].milliCPU; got != 1000 {
+		t.Errorf("free CPU = %dm, want 1000m counting the pod outside the cache", got)
+	}
+}
+
+func TestLimitToCapacity(t *testing.T) {
+	pods := []*corev1.Pod{capacityTestPod("a", "1"), capacityTestPod("b", "1")}
+	for _, tc := range []struct {
+		capacity int
+		want     int
+	}{
+		{-1, 2},
+		{0, 0},
+		{1, 1},
+		{5, 2},
+	} {
+		if got := len(limitToCapacity(tc.capacity, pods)); got != tc.want {
+			t.Errorf("limitToCapacity(%d) kept %d pods, want %d", tc.capacity, got, tc.want)
+		}
+	}
+}
+
+func capacityTestPodSet(replicas int32, cpu string) *podsetv1alpha1.PodSet {
+	podSet := testPodSet(replicas)
+	podSet.Spec.Template = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name:  "app",
+			Image: "app",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+			},
+		}},
+	}}
+	return podSet
+}
+
+func TestReconcileCreatesOnlyPodsThatFit(t *testing.T) {
+	r := newTestReconciler(t, capacityTestNode(), capacityTestPodSet(3, "1500m"))
+	r.CapacityCheck = true
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if podSet.Status.Replicas != 2 {
+		t.Errorf("status has %d replicas, want the 2 pods that fit", podSet.Status.Replicas)
+	}
+	cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionInsufficientCapacity)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("InsufficientCapacity = %+v, want True", cond)
+	}
+}
+
+func TestReconcileRequeuesWithoutCapacity(t *testing.T) {
+	// Outside the PodSet's namespace, since the fake client cannot select
+	// pods by owner.
+	other := capacityTestPod("other", "4")
+	other.Namespace = "kube-system"
+	r := newTestReconciler(t, capacityTestNode(), other, capacityTestPodSet(1, "1"))
+	r.CapacityCheck = true
+
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != capacityRefreshInterval {
+		t.Errorf("result = %+v, want a retry after %s", result, capacityRefreshInterval)
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(context.Background(), pods, client.InNamespace("default")); err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("%d pods exist, want no new pods", len(pods.Items))
+	}
+}
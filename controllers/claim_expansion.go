@@ -0,0 +1,161 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	reasonClaimsResizing     = "Resizing"
+	reasonClaimNotExpandable = "ClaimNotExpandable"
+)
+
+// claimTemplate returns the template of spec.volumeClaimTemplates the claim
+// was created from, or nil.
+func claimTemplate(podSet *podsetv1alpha1.PodSet, claim *corev1.PersistentVolumeClaim) *podsetv1alpha1.VolumeClaimTemplate {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: claim.Labels[claimPodLabel]}}
+	for i := range podSet.Spec.VolumeClaimTemplates {
+		if claimName(&podSet.Spec.VolumeClaimTemplates[i], pod) == claim.Name {
+			return &podSet.Spec.VolumeClaimTemplates[i]
+		}
+	}
+	return nil
+}
+
+// claimResizing reports whether the claim has not yet reached the storage
+// it requests.
+func claimResizing(claim *corev1.PersistentVolumeClaim) bool {
+	for _, cond := range claim.Status.Conditions {
+		if (cond.Type == corev1.PersistentVolumeClaimResizing || cond.Type == corev1.PersistentVolumeClaimFileSystemResizePending) &&
+			cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	requested := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity, ok := claim.Status.Capacity[corev1.ResourceStorage]
+	return ok && capacity.Cmp(requested) < 0
+}
+
+// storageClassExpandable reports whether the storage class of the claim
+// allows volume expansion.
+func (r *PodSetReconciler) storageClassExpandable(ctx context.Context, claim *corev1.PersistentVolumeClaim) (bool, error) {
+	if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName == "" {
+		return false, nil
+	}
+	class := &storagev1.StorageClass{}
+	if err := r.Get(ctx, client.ObjectKey{Name: *claim.Spec.StorageClassName}, class); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return class.AllowVolumeExpansion != nil && *class.AllowVolumeExpansion, nil
+}
+
+// expandClaims raises the storage request of the PodSet's claims to that
+// of their template, never lowering it, when their storage class allows
+// volume expansion. Claims still resizing are reported in the
+// ClaimsResizing condition of status, and claims that cannot be expanded
+// in the Degraded condition, unless it is already raised for another
+// reason.
+func (r *PodSetReconciler) expandClaims(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) error {
+	log := ctrllog.FromContext(ctx)
+	if len(podSet.Spec.VolumeClaimTemplates) == 0 {
+		return nil
+	}
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(podNamespace(podSet)), client.HasLabels{claimPodLabel}, client.MatchingLabels(labelsForPodSet(podSet))); err != nil {
+		return err
+	}
+	var resizing, notExpandable []string
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		template := claimTemplate(podSet, claim)
+		if template == nil || claim.DeletionTimestamp != nil || !createdFor(podSet, claim) {
+			continue
+		}
+		want, ok := template.Spec.Resources.Requests[corev1.ResourceStorage]
+		have := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		if ok && want.Cmp(have) > 0 {
+			expandable, err := r.storageClassExpandable(ctx, claim)
+			if err != nil {
+				return err
+			}
+			if !expandable {
+				notExpandable = append(notExpandable, claim.Name)
+				continue
+			}
+			patch := client.MergeFrom(claim.DeepCopy())
+			if claim.Spec.Resources.Requests == nil {
+				claim.Spec.Resources.Requests = corev1.ResourceList{}
+			}
+			claim.Spec.Resources.Requests[corev1.ResourceStorage] = want
+			log.Info("Expanding claim", "claim.name", claim.Name, "from", have.String(), "to", want.String())
+			if err := r.Patch(ctx, claim, patch); err != nil {
+				return err
+			}
+		}
+		if claimResizing(claim) {
+			resizing = append(resizing, claim.Name)
+		}
+	}
+	sort.Strings(resizing)
+	sort.Strings(notExpandable)
+
+	if len(resizing) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionClaimsResizing)
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionClaimsResizing,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonClaimsResizing,
+			Message:            "Claims are resizing: " + strings.Join(resizing, ", "),
+			ObservedGeneration: podSet.Generation,
+		})
+	}
+
+	if len(notExpandable) == 0 {
+		clearDegraded(status, reasonClaimNotExpandable, podSet.Generation)
+		return nil
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason != reasonClaimNotExpandable {
+		return nil
+	}
+	message := fmt.Sprintf("The storage class of claims %s does not allow volume expansion", strings.Join(notExpandable, ", "))
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonClaimNotExpandable, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonClaimNotExpandable,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func claimTestPodSet(storage string) *podsetv1alpha1.PodSet {
+	podSet := &podsetv1alpha1.PodSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid-1"},
+		Spec: podsetv1alpha1.PodSetSpec{
+			VolumeClaimTemplates: []podsetv1alpha1.VolumeClaimTemplate{{
+				Name: "data",
+				Spec: corev1.PersistentVolumeClaimSpec{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+					},
+				},
+			}},
+		},
+	}
+	podSet.APIVersion = podsetv1alpha1.GroupVersion.String()
+	podSet.Kind = "PodSet"
+	return podSet
+}
+
+func claimTestClaim(podSet *podsetv1alpha1.PodSet, pod, storage, class string) *corev1.PersistentVolumeClaim {
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "data-" + pod,
+			Namespace: podSet.Namespace,
+			Labels:    labelsForPodSet(podSet),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: podSet.APIVersion, Kind: podSet.Kind, Name: podSet.Name, UID: podSet.UID,
+				Controller: pointer.Bool(true),
+			}},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: pointer.String(class),
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+		},
+	}
+	claim.Labels[claimPodLabel] = pod
+	return claim
+}
+
+func claimStorage(t *testing.T, r *PodSetReconciler, name string) resource.Quantity {
+	t.Helper()
+	claim := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, claim); err != nil {
+		t.Fatal(err)
+	}
+	return claim.Spec.Resources.Requests[corev1.ResourceStorage]
+}
+
+func TestExpandClaimsGrowsExpandableClaims(t *testing.T) {
+	podSet := claimTestPodSet("2Gi")
+	class := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}, AllowVolumeExpansion: pointer.Bool(true)}
+	r := newTestReconciler(t, class, claimTestClaim(podSet, "web-0", "1Gi", "fast"))
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	if err := r.expandClaims(context.Background(), podSet, status); err != nil {
+		t.Fatal(err)
+	}
+	if got := claimStorage(t, r, "data-web-0"); got.Cmp(resource.MustParse("2Gi")) != 0 {
+		t.Errorf("claim requests %s, want 2Gi", got.String())
+	}
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionClaimsResizing) {
+		t.Errorf("ClaimsResizing is not True while the claim's capacity is below its request")
+	}
+}
+
+func TestExpandClaimsNeverShrinks(t *testing.T) {
+	podSet := claimTestPodSet("1Gi")
+	class := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}, AllowVolumeExpansion: pointer.Bool(true)}
+	r := newTestReconciler(t, class, claimTestClaim(podSet, "web-0", "2Gi", "fast"))
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	if err := r.expandClaims(context.Background(), podSet, status); err != nil {
+		t.Fatal(err)
+	}
+	if got := claimStorage(t, r, "data-web-0"); got.Cmp(resource.MustParse("2Gi")) != 0 {
+		t.Errorf("claim requests %s, want it left at 2Gi", got.String())
+	}
+	if meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionClaimsResizing) != nil {
+		t.Errorf("ClaimsResizing is set although no claim is resizing")
+	}
+}
+
+func TestExpandClaimsReportsNotExpandable(t *testing.T) {
+	podSet := claimTestPodSet("2Gi")
+	class := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "slow"}}
+	r := newTestReconciler(t, class, claimTestClaim(podSet, "web-0", "1Gi", "slow"))
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	if err := r.expandClaims(context.Background(), podSet, status); err != nil {
+		t.Fatal(err)
+	}
+	if got := claimStorage(t, r, "data-web-0"); got.Cmp(resource.MustParse("1Gi")) != 0 {
+		t.Errorf("claim requests %s, want it left at 1Gi", got.String())
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != reasonClaimNotExpandable {
+		t.Errorf("Degraded = %+v, want True with reason %s", cond, reasonClaimNotExpandable)
+	}
+}
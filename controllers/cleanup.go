@@ -0,0 +1,179 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	defaultCleanupHookTimeout = 10 * time.Second
+
+	reasonCleanupFailed = "CleanupFailed"
+	reasonCleanupHook   = "CleanupHookSucceeded"
+)
+
+// runCleanup deletes the objects selected by spec.cleanup of a deleted PodSet
+// and then calls its hook. Objects are deleted only in a namespace the
+// PodSet's pods are allowed in, and the hook is called only if its host is
+// listed in CleanupHookHosts; a cleanup that is not allowed is skipped with
+// an event rather than holding up the deletion. A hook that keeps failing
+// holds the deletion until it succeeds or the PodSet is given the
+// force-delete annotation, which skips it.
+func (r *PodSetReconciler) runCleanup(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	cleanup := podSet.Spec.Cleanup
+	if cleanup == nil {
+		return nil
+	}
+	if len(cleanup.Resources) > 0 {
+		if !r.allowsPodNamespace(podSet) {
+			r.Recorder.Eventf(podSet, corev1.EventTypeWarning, reasonCleanupFailed,
+				"Not deleting resources in namespace %s, which the operator does not allow", podNamespace(podSet))
+		} else if err := r.deleteCleanupResources(ctx, podSet); err != nil {
+			r.Recorder.Eventf(podSet, corev1.EventTypeWarning, reasonCleanupFailed, "Failed to delete resources: %v", err)
+			return err
+		}
+	}
+	if cleanup.Hook != nil {
+		if podSet.Annotations[forceDeleteAnnotation] == "true" {
+			r.Recorder.Eventf(podSet, corev1.EventTypeWarning, reasonCleanupFailed,
+				"Not calling cleanup hook %s, as the PodSet is force-deleted", cleanup.Hook.URL)
+			return nil
+		}
+		if !r.allowsHookURL(cleanup.Hook.URL) {
+			r.Recorder.Eventf(podSet, corev1.EventTypeWarning, reasonCleanupFailed,
+				"Not calling cleanup hook %s, whose host the operator does not allow", cleanup.Hook.URL)
+			return nil
+		}
+		if err := callCleanupHook(ctx, podSet); err != nil {
+			r.Recorder.Eventf(podSet, corev1.EventTypeWarning, reasonCleanupFailed, "Cleanup hook failed: %v", err)
+			return err
+		}
+		r.Recorder.Event(podSet, corev1.EventTypeNormal, reasonCleanupHook, "Cleanup hook succeeded")
+	}
+	return nil
+}
+
+// deleteCleanupResources deletes the objects of spec.cleanup.resources in the
+// namespace of the pods that match spec.cleanup.selector.
+func (r *PodSetReconciler) deleteCleanupResources(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	log := ctrllog.FromContext(ctx)
+	selector, err := metav1.LabelSelectorAsSelector(podSet.Spec.Cleanup.Selector)
+	if err != nil {
+		return err
+	}
+	opts := []client.ListOption{client.InNamespace(podNamespace(podSet)), client.MatchingLabelsSelector{Selector: selector}}
+	for _, resource := range podSet.Spec.Cleanup.Resources {
+		var objects []client.Object
+		switch resource {
+		case podsetv1alpha1.ServicesCleanupResource:
+			list := &corev1.ServiceList{}
+			if err := r.List(ctx, list, opts...); err != nil {
+				return err
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+		case podsetv1alpha1.PersistentVolumeClaimsCleanupResource:
+			list := &corev1.PersistentVolumeClaimList{}
+			if err := r.List(ctx, list, opts...); err != nil {
+				return err
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+		}
+		for _, obj := range objects {
+			if obj.GetDeletionTimestamp() != nil {
+				continue
+			}
+			log.Info("Deleting object of deleted PodSet", "kind", resource, "name", obj.GetName())
+			if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allowsHookURL reports whether the host of the hook URL is listed in
+// CleanupHookHosts.
+func (r *PodSetReconciler) allowsHookURL(hookURL string) bool {
+	u, err := url.Parse(hookURL)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	for _, host := range r.CleanupHookHosts {
+		if host == "*" || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// callCleanupHook POSTs the PodSet to its cleanup hook and returns an error
+// unless the hook answers with a 2xx status. Redirects are not followed, so
+// that an allowed host cannot send the call elsewhere.
+func callCleanupHook(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	hook := podSet.Spec.Cleanup.Hook
+	timeout := defaultCleanupHookTimeout
+	if hook.TimeoutSeconds > 0 {
+		timeout = time.Duration(hook.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(podSet)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	httpClient := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("hook %s returned %s", hook.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// cleanupTestHook returns a hook server answering with status, and counts
+// the PodSets POSTed to it.
+func cleanupTestHook(t *testing.T, status int, calls *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		podSet := &podsetv1alpha1.PodSet{}
+		if req.Method != http.MethodPost || json.NewDecoder(req.Body).Decode(podSet) != nil || podSet.Name != "web" {
+			t.Errorf("hook called with %s and PodSet %q, want the PodSet POSTed", req.Method, podSet.Name)
+		}
+		atomic.AddInt32(calls, 1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func hookHost(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Hostname()
+}
+
+func cleanupTestPodSet(hookURL string) *podsetv1alpha1.PodSet {
+	podSet := testPodSet(1)
+	podSet.Spec.Cleanup = &podsetv1alpha1.CleanupSpec{Hook: &podsetv1alpha1.CleanupHook{URL: hookURL}}
+	return podSet
+}
+
+func TestRunCleanupDeletesSelectedResources(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.TargetNamespace = "pods"
+	podSet.Spec.Cleanup = &podsetv1alpha1.CleanupSpec{
+		Resources: []podsetv1alpha1.CleanupResourceType{podsetv1alpha1.ServicesCleanupResource, podsetv1alpha1.PersistentVolumeClaimsCleanupResource},
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"cleanup": "web"}},
+	}
+	selected := map[string]string{"cleanup": "web"}
+	objs := []client.Object{
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "pods", Labels: selected}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "pods"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: selected}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "pods", Labels: selected}},
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name    string
+		allowed []string
+		left    []string
+	}{
+		{"allowed namespace", []string{"pods"}, []string{"default/Service/web", "pods/Service/other"}},
+		{"disallowed namespace", nil, []string{"default/Service/web", "pods/PersistentVolumeClaim/cache", "pods/Service/other", "pods/Service/web"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var fresh []client.Object
+			for _, obj := range objs {
+				fresh = append(fresh, obj.DeepCopyObject().(client.Object))
+			}
+			r := newTestReconciler(t, fresh...)
+			r.AllowedTargetNamespaces = tc.allowed
+			if err := r.runCleanup(ctx, podSet); err != nil {
+				t.Fatal(err)
+			}
+
+			var left []string
+			services := &corev1.ServiceList{}
+			claims := &corev1.PersistentVolumeClaimList{}
+			if err := r.List(ctx, services); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.List(ctx, claims); err != nil {
+				t.Fatal(err)
+			}
+			for _, service := range services.Items {
+				left = append(left, service.Namespace+"/Service/"+service.Name)
+			}
+			for _, claim := range claims.Items {
+				left = append(left, claim.Namespace+"/PersistentVolumeClaim/"+claim.Name)
+			}
+			sort.Strings(left)
+			if !reflect.DeepEqual(left, tc.left) {
+				t.Errorf("objects left = %v, want %v", left, tc.left)
+			}
+		})
+	}
+}
+
+func TestRunCleanupHook(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		status      int
+		allowHost   bool
+		forceDelete bool
+		wantErr     bool
+		wantCalls   int32
+	}{
+		{name: "succeeds", status: http.StatusNoContent, allowHost: true, wantCalls: 1},
+		{name: "fails", status: http.StatusServiceUnavailable, allowHost: true, wantErr: true, wantCalls: 1},
+		{name: "disallowed host", status: http.StatusOK, wantCalls: 0},
+		{name: "force-deleted", status: http.StatusServiceUnavailable, allowHost: true, forceDelete: true, wantCalls: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			server := cleanupTestHook(t, tc.status, &calls)
+			podSet := cleanupTestPodSet(server.URL + "/cleanup")
+			if tc.forceDelete {
+				podSet.Annotations = map[string]string{forceDeleteAnnotation: "true"}
+			}
+			r := newTestReconciler(t)
+			r.CleanupHookHosts = []string{"hooks.example.com"}
+			if tc.allowHost {
+				r.CleanupHookHosts = append(r.CleanupHookHosts, hookHost(t, server))
+			}
+
+			err := r.runCleanup(context.Background(), podSet)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("runCleanup = %v, want an error %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("hook called %d times, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCallCleanupHookDoesNotFollowRedirects(t *testing.T) {
+	var calls int32
+	target := cleanupTestHook(t, http.StatusOK, &calls)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	if err := callCleanupHook(context.Background(), cleanupTestPodSet(redirect.URL)); err == nil {
+		t.Error("redirected hook succeeded, want the redirect treated as a failure")
+	}
+	if calls != 0 {
+		t.Errorf("redirect target called %d times, want never", calls)
+	}
+}
+
+func TestAllowsHookURL(t *testing.T) {
+	r := &PodSetReconciler{CleanupHookHosts: []string{"hooks.example.com"}}
+	for hookURL, want := range map[string]bool{
+		"https://hooks.example.com/cleanup":      true,
+		"https://HOOKS.example.com:8443/cleanup": true,
+		"https://evil.example.com/cleanup":       false,
+		"https://hooks.example.com.evil.io/":     false,
+		"not a url":                              false,
+	} {
+		if got := r.allowsHookURL(hookURL); got != want {
+			t.Errorf("allowsHookURL(%q) = %v, want %v", hookURL, got, want)
+		}
+	}
+	if r := (&PodSetReconciler{}); r.allowsHookURL("https://hooks.example.com/") {
+		t.Error("hook allowed without any allowed host")
+	}
+}
+
+func TestFinalizeForceDeleteSkipsFailingHook(t *testing.T) {
+	var calls int32
+	server := cleanupTestHook(t, http.StatusInternalServerError, &calls)
+	podSet := cleanupTestPodSet(server.URL)
+	podSet.Finalizers = []string{podSetFinalizer}
+	r := newTestReconciler(t, podSet)
+	r.CleanupHookHosts = []string{hookHost(t, server)}
+	ctx := context.Background()
+	key := client.ObjectKeyFromObject(podSet)
+
+	if err := r.Delete(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.finalize(ctx, podSet); err == nil {
+		t.Fatal("finalize succeeded with a failing hook, want it retried")
+	}
+	if err := r.Get(ctx, key, podSet); err != nil {
+		t.Fatalf("PodSet gone with its hook failing: %v", err)
+	}
+
+	podSet.Annotations = map[string]string{forceDeleteAnnotation: "true"}
+	if err := r.Update(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.finalize(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, podSet); !errors.IsNotFound(err) {
+		t.Errorf("get after force-delete = %v, want the PodSet gone", err)
+	}
+	if calls != 1 {
+		t.Errorf("hook called %d times, want only before the force-delete", calls)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// colocationIndex indexes PodSets by the PodSets named in their
+	// spec.colocateWith and spec.avoid, as namespace/name keys.
+	colocationIndex = "podset.example.com/colocation"
+
+	reasonColocationTargetMissing = "ColocationTargetMissing"
+
+	// colocationPreferenceWeight is the weight of preferred colocation
+	// terms.
+	colocationPreferenceWeight = 100
+)
+
+// resolveColocation turns the PodSet's spec.colocateWith and spec.avoid into
+// pod affinity terms that select the other PodSets' pods, recording in the
+// ColocationTargetMissing condition of status any PodSet that does not
+// exist. Terms naming a missing PodSet are left out.
+func (r *PodSetReconciler) resolveColocation(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) (*corev1.Affinity, error) {
+	if len(podSet.Spec.ColocateWith) == 0 && len(podSet.Spec.Avoid) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionColocationTargetMissing)
+		return nil, nil
+	}
+	var missing []string
+	resolve := func(terms []podsetv1alpha1.PodSetAffinityTerm) ([]corev1.PodAffinityTerm, []corev1.WeightedPodAffinityTerm, error) {
+		var (
+			required  []corev1.PodAffinityTerm
+			preferred []corev1.WeightedPodAffinityTerm
+		)
+		for _, term := range terms {
+			target := &podsetv1alpha1.PodSet{}
+			if err := r.Get(ctx, types.NamespacedName{Namespace: podSet.Namespace, Name: term.Name}, target); err != nil {
+				if errors.IsNotFound(err) {
+					missing = append(missing, term.Name)
+					continue
+				}
+				return nil, nil, err
+			}
+			topologyKey := term.TopologyKey
+			if topologyKey == "" {
+				topologyKey = corev1.LabelHostname
+			}
+			affinityTerm := corev1.PodAffinityTerm{
+				LabelSelector: selectorForPodSet(target),
+				Namespaces:    []string{podNamespace(target)},
+				TopologyKey:   topologyKey,
+			}
+			if term.Required {
+				required = append(required, affinityTerm)
+			} else {
+				preferred = append(preferred, corev1.WeightedPodAffinityTerm{Weight: colocationPreferenceWeight, PodAffinityTerm: affinityTerm})
+			}
+		}
+		return required, preferred, nil
+	}
+
+	affinity := &corev1.Affinity{}
+	required, preferred, err := resolve(podSet.Spec.ColocateWith)
+	if err != nil {
+		return nil, err
+	}
+	if len(required) > 0 || len(preferred) > 0 {
+		affinity.PodAffinity = &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+	required, preferred, err = resolve(podSet.Spec.Avoid)
+	if err != nil {
+		return nil, err
+	}
+	if len(required) > 0 || len(preferred) > 0 {
+		affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+
+	if len(missing) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionColocationTargetMissing,
+			Status:             metav1.ConditionFalse,
+			Reason:             "ColocationTargetsFound",
+			Message:            "All PodSets named by colocateWith and avoid exist",
+			ObservedGeneration: podSet.Generation,
+		})
+		return affinity, nil
+	}
+	message := fmt.Sprintf("PodSets do not exist in namespace %s and are ignored: %s", podSet.Namespace, strings.Join(missing, ", "))
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionColocationTargetMissing) {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonColocationTargetMissing, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionColocationTargetMissing,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonColocationTargetMissing,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return affinity, nil
+}
+
+// applyColocation adds the resolved colocation terms to the pod's affinity.
+func applyColocation(colocation *corev1.Affinity, pod *corev1.Pod) {
+	if colocation == nil || (colocation.PodAffinity == nil && colocation.PodAntiAffinity == nil) {
+		return
+	}
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	affinity := pod.Spec.Affinity
+	if terms := colocation.PodAffinity; terms != nil {
+		if affinity.PodAffinity == nil {
+			affinity.PodAffinity = &corev1.PodAffinity{}
+		}
+		affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution, terms.RequiredDuringSchedulingIgnoredDuringExecution...)
+		affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution, terms.PreferredDuringSchedulingIgnoredDuringExecution...)
+	}
+	if terms := colocation.PodAntiAffinity; terms != nil {
+		if affinity.PodAntiAffinity == nil {
+			affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, terms.RequiredDuringSchedulingIgnoredDuringExecution...)
+		affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, terms.PreferredDuringSchedulingIgnoredDuringExecution...)
+	}
+}
+
+// indexPodSetColocation is the colocationIndex extractor.
+func indexPodSetColocation(obj client.Object) []string {
+	podSet, ok := obj.(*podsetv1alpha1.PodSet)
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for _, terms := range [][]podsetv1alpha1.PodSetAffinityTerm{podSet.Spec.ColocateWith, podSet.Spec.Avoid} {
+		for _, term := range terms {
+			keys = append(keys, podSet.Namespace+"/"+term.Name)
+		}
+	}
+	return keys
+}
+
+// podSetsColocatedWith enqueues the PodSets whose colocateWith or avoid name
+// a PodSet, so that their pods follow changes to its pod labels.
+func (r *PodSetReconciler) podSetsColocatedWith(obj client.Object) []reconcile.Request {
+	podSets := &podsetv1alpha1.PodSetList{}
+	key := obj.GetNamespace() + "/" + obj.GetName()
+	if err := r.List(context.Background(), podSets, client.MatchingFields{colocationIndex: key}); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(podSets.Items))
+	for _, podSet := range podSets.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}})
+	}
+	return requests
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestResolveColocation(t *testing.T) {
+	cache := &podsetv1alpha1.PodSet{ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "default"}}
+	db := &podsetv1alpha1.PodSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}}
+	r := newTestReconciler(t, cache, db)
+	podSet := testPodSet(1)
+	podSet.Spec.ColocateWith = []podsetv1alpha1.PodSetAffinityTerm{{Name: "cache", Required: true}, {Name: "gone"}}
+	podSet.Spec.Avoid = []podsetv1alpha1.PodSetAffinityTerm{{Name: "db", TopologyKey: "topology.kubernetes.io/zone"}}
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	affinity, err := r.resolveColocation(context.Background(), podSet, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	required := affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(required) != 1 || required[0].TopologyKey != corev1.LabelHostname ||
+		!reflect.DeepEqual(required[0].LabelSelector, selectorForPodSet(cache)) || len(affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 0 {
+		t.Errorf("pod affinity = %+v, want one required term selecting cache's pods per host", affinity.PodAffinity)
+	}
+	preferred := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(preferred) != 1 || preferred[0].Weight != colocationPreferenceWeight || preferred[0].PodAffinityTerm.TopologyKey != "topology.kubernetes.io/zone" {
+		t.Errorf("pod anti-affinity = %+v, want one preferred term avoiding db's zone", affinity.PodAntiAffinity)
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionColocationTargetMissing)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Message != "PodSets do not exist in namespace default and are ignored: gone" {
+		t.Errorf("ColocationTargetMissing = %+v, want True naming gone", cond)
+	}
+}
+
+func TestApplyColocationKeepsTemplateAffinity(t *testing.T) {
+	own := corev1.PodAffinityTerm{TopologyKey: "rack"}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Affinity: &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{own},
+	}}}}
+	colocation := &corev1.Affinity{
+		PodAffinity:     &corev1.PodAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{TopologyKey: corev1.LabelHostname}}},
+		PodAntiAffinity: &corev1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{TopologyKey: corev1.LabelHostname}}},
+	}
+
+	applyColocation(colocation, pod)
+	if terms := pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution; len(terms) != 2 || terms[0].TopologyKey != "rack" {
+		t.Errorf("pod affinity terms = %+v, want the template's term followed by the colocation term", terms)
+	}
+	if anti := pod.Spec.Affinity.PodAntiAffinity; anti == nil || len(anti.RequiredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("pod anti-affinity = %+v, want the avoid term", anti)
+	}
+}
+
+func TestIndexPodSetColocation(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.ColocateWith = []podsetv1alpha1.PodSetAffinityTerm{{Name: "cache"}}
+	podSet.Spec.Avoid = []podsetv1alpha1.PodSetAffinityTerm{{Name: "db"}}
+	if keys := indexPodSetColocation(podSet); !reflect.DeepEqual(keys, []string{"default/cache", "default/db"}) {
+		t.Errorf("index keys = %v, want default/cache and default/db", keys)
+	}
+}
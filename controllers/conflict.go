@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// errPodSetChanged is returned by a mutate function of updatePodSet when the
+// freshly read PodSet no longer matches what the update was decided on, so
+// that it is given up and decided again on the next reconcile.
+var errPodSetChanged = errors.New("the PodSet changed since the update was decided")
+
+// updatePodSet applies mutate to the PodSet and updates it. When the update
+// conflicts with another writer, the PodSet is read again and mutate applied
+// to the fresh copy, a few times with backoff, so that a stale cache does not
+// fail the reconcile. podSet holds the PodSet as last read or written. A
+// mutate that depends on what the PodSet looked like when the update was
+// decided re-checks it and returns errPodSetChanged if it no longer holds.
+func (r *PodSetReconciler) updatePodSet(ctx context.Context, podSet *podsetv1alpha1.PodSet, mutate func(*podsetv1alpha1.PodSet) error) error {
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}
+	first := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			var reader client.Reader = r.Client
+			if r.APIReader != nil {
+				reader = r.APIReader
+			}
+			if err := reader.Get(ctx, key, podSet); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := mutate(podSet); err != nil {
+			return err
+		}
+		return r.Update(ctx, podSet)
+	})
+}
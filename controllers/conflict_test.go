@@ -0,0 +1,95 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestUpdatePodSetRetriesOnConflict(t *testing.T) {
+	ctx := context.Background()
+	r := newTestReconciler(t, &podsetv1alpha1.PodSet{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}})
+	stale := &podsetv1alpha1.PodSet{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web"}, stale); err != nil {
+		t.Fatal(err)
+	}
+	other := stale.DeepCopy()
+	other.Labels = map[string]string{"team": "a"}
+	if err := r.Update(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	if err := r.updatePodSet(ctx, stale, func(podSet *podsetv1alpha1.PodSet) error {
+		calls++
+		podSet.Spec.Paused = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("mutate called %d times, want 2", calls)
+	}
+	got := &podsetv1alpha1.PodSet{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Spec.Paused || got.Labels["team"] != "a" {
+		t.Errorf("PodSet = %+v, want both writes kept", got)
+	}
+}
+
+func TestUpdatePodSetGivesUpWhenChanged(t *testing.T) {
+	ctx := context.Background()
+	r := newTestReconciler(t, &podsetv1alpha1.PodSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       podsetv1alpha1.PodSetSpec{RollbackTo: &podsetv1alpha1.RollbackConfig{Revision: 2}},
+	})
+	stale := &podsetv1alpha1.PodSet{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web"}, stale); err != nil {
+		t.Fatal(err)
+	}
+	other := stale.DeepCopy()
+	other.Spec.RollbackTo.Revision = 3
+	if err := r.Update(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	err := r.updatePodSet(ctx, stale, func(podSet *podsetv1alpha1.PodSet) error {
+		if podSet.Spec.RollbackTo == nil || podSet.Spec.RollbackTo.Revision != 2 {
+			return errPodSetChanged
+		}
+		podSet.Spec.RollbackTo = nil
+		return nil
+	})
+	if err != errPodSetChanged {
+		t.Fatalf("updatePodSet() = %v, want errPodSetChanged", err)
+	}
+	got := &podsetv1alpha1.PodSet{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.RollbackTo == nil || got.Spec.RollbackTo.Revision != 3 {
+		t.Errorf("rollbackTo = %+v, want the concurrent request kept", got.Spec.RollbackTo)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// applyContainerEnv adds spec.containerEnv to the containers and init
+// containers of the pod it names, keeping the variables they already set.
+func applyContainerEnv(envs []podsetv1alpha1.ContainerEnvSpec, pod *corev1.Pod) {
+	for _, env := range envs {
+		for i := range pod.Spec.InitContainers {
+			addContainerEnv(env, &pod.Spec.InitContainers[i])
+		}
+		for i := range pod.Spec.Containers {
+			addContainerEnv(env, &pod.Spec.Containers[i])
+		}
+	}
+}
+
+// addContainerEnv adds env to the container if it names it.
+func addContainerEnv(env podsetv1alpha1.ContainerEnvSpec, container *corev1.Container) {
+	if env.ContainerName != "" && env.ContainerName != container.Name {
+		return
+	}
+	set := map[string]bool{}
+	for _, existing := range container.Env {
+		set[existing.Name] = true
+	}
+	for _, variable := range env.Env {
+		if !set[variable.Name] {
+			container.Env = append(container.Env, *variable.DeepCopy())
+			set[variable.Name] = true
+		}
+	}
+	for _, source := range env.EnvFrom {
+		container.EnvFrom = append(container.EnvFrom, *source.DeepCopy())
+	}
+}
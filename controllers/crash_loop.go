@@ -0,0 +1,100 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// crashLoopBackOff is the waiting reason of a container the kubelet
+	// holds back from restarting after repeated crashes.
+	crashLoopBackOff = "CrashLoopBackOff"
+
+	reasonCrashLooping = "CrashLooping"
+)
+
+// crashLoopingContainer returns the status of the first container, init
+// containers first, of the pod that is in CrashLoopBackOff, or nil.
+func crashLoopingContainer(pod *corev1.Pod) *corev1.ContainerStatus {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for i := range statuses {
+		if waiting := statuses[i].State.Waiting; waiting != nil && waiting.Reason == crashLoopBackOff {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// handleCrashLoops reports the available pods with a crash looping container
+// in the Degraded condition of status, unless it is already raised for
+// another reason, and, unless observeOnly, replaces those past
+// spec.crashLoopRestartLimit that the failure policy would replace.
+func (r *PodSetReconciler) handleCrashLoops(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState, observeOnly bool) error {
+	log := ctrllog.FromContext(ctx)
+	var looping []string
+	for _, pod := range append([]corev1.Pod(nil), state.available...) {
+		container := crashLoopingContainer(&pod)
+		if container == nil {
+			continue
+		}
+		limit := podSet.Spec.CrashLoopRestartLimit
+		if observeOnly || limit == nil || container.RestartCount < *limit ||
+			podFailureAction(podSet, &pod) != podsetv1alpha1.ReplacePodFailureAction {
+			looping = append(looping, fmt.Sprintf("pod %s: container %s restarted %d times", pod.Name, container.Name, container.RestartCount))
+			continue
+		}
+		log.Info("Replacing crash looping pod", "pod.name", pod.Name, "container", container.Name, "restarts", container.RestartCount)
+		if err := r.Delete(ctx, &pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+			r.podDeleteFailed(podSet, &pod, err)
+			return err
+		}
+		r.podDeleted(podSet, state, &pod, podsetv1alpha1.CrashLoopDeletion)
+		state.available = removePod(state.available, pod.Name)
+	}
+
+	if len(looping) == 0 {
+		clearDegraded(status, reasonCrashLooping, podSet.Generation)
+		return nil
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason != reasonCrashLooping {
+		return nil
+	}
+	message := "Pods are crash looping: " + strings.Join(looping, "; ")
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonCrashLooping, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonCrashLooping,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	defaultCreateFailureLimit = 5
+
+	reasonCreateFailed = "CreateFailed"
+)
+
+// createFailures are the consecutive failed attempts to create a PodSet's
+// pods at one generation of its spec.
+type createFailures struct {
+	generation int64
+	count      int
+	// last is the error of the most recent attempt.
+	last error
+}
+
+// createFailureTracker holds the createFailures of each PodSet.
+type createFailureTracker struct {
+	mu      sync.Mutex
+	podSets map[types.NamespacedName]createFailures
+}
+
+// record counts a failed attempt at generation, starting over when the
+// generation changed.
+func (t *createFailureTracker) record(key types.NamespacedName, generation int64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.podSets == nil {
+		t.podSets = map[types.NamespacedName]createFailures{}
+	}
+	failures := t.podSets[key]
+	if failures.generation != generation {
+		failures = createFailures{generation: generation}
+	}
+	failures.count++
+	failures.last = err
+	t.podSets[key] = failures
+}
+
+// get returns the failures recorded for key.
+func (t *createFailureTracker) get(key types.NamespacedName) createFailures {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.podSets[key]
+}
+
+// reset drops the failures of key after a successful attempt.
+func (t *createFailureTracker) reset(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.podSets, key)
+}
+
+// forget drops the failures of the PodSet once it is gone.
+func (t *createFailureTracker) forget(key types.NamespacedName) {
+	t.reset(key)
+}
+
+// checkReplicaFailure reports whether the ReplicaFailure condition of status
+// stops pods from being created. The condition is removed once the spec
+// has changed since it was raised.
+func checkReplicaFailure(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) bool {
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionReplicaFailure)
+	if cond == nil {
+		return false
+	}
+	if cond.ObservedGeneration < podSet.Generation {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionReplicaFailure)
+		return false
+	}
+	return cond.Status == metav1.ConditionTrue
+}
+
+// createFailureLimitReached returns the failed attempts at creating the
+// PodSet's pods, and reports whether there were CreateFailureLimit of them
+// in a row at its current generation.
+func (r *PodSetReconciler) createFailureLimitReached(podSet *podsetv1alpha1.PodSet) (createFailures, bool) {
+	limit := r.CreateFailureLimit
+	if limit <= 0 {
+		limit = defaultCreateFailureLimit
+	}
+	failures := r.createFailures.get(types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name})
+	return failures, failures.generation == podSet.Generation && failures.count >= limit
+}
+
+// reportReplicaFailure raises the ReplicaFailure condition of status, with
+// the error of the last attempt, once creating the PodSet's pods failed
+// CreateFailureLimit times in a row at its current generation. It reports
+// whether the condition is raised, in which case the controller stops
+// retrying until the spec changes.
+func (r *PodSetReconciler) reportReplicaFailure(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) bool {
+	if meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionReplicaFailure) {
+		return true
+	}
+	failures, reached := r.createFailureLimitReached(podSet)
+	if !reached {
+		return false
+	}
+	message := fmt.Sprintf("Creating pods failed %d times in a row: %v", failures.count, failures.last)
+	r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonCreateFailed, message)
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionReplicaFailure,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonCreateFailed,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return true
+}
@@ -0,0 +1,370 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// The per-item backoff of the controller's default rate limiter, which
+// requeues failed reconciles after 5ms, doubling up to 1000s.
+const (
+	defaultRetryBaseDelay = 5 * time.Millisecond
+	defaultRetryMaxDelay  = 1000 * time.Second
+)
+
+// reconcileRecord is what is remembered of a PodSet's last reconcile.
+type reconcileRecord struct {
+	time   time.Time
+	result ctrl.Result
+	err    error
+	// failures counts the consecutive reconciles that were requeued with
+	// backoff: those that failed or asked for a plain requeue.
+	failures int
+}
+
+// reconcileTracker holds the reconcileRecord of each PodSet.
+type reconcileTracker struct {
+	mu      sync.Mutex
+	podSets map[types.NamespacedName]reconcileRecord
+}
+
+// record notes the outcome of a reconcile of the PodSet.
+func (t *reconcileTracker) record(key types.NamespacedName, now time.Time, result ctrl.Result, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.podSets == nil {
+		t.podSets = map[types.NamespacedName]reconcileRecord{}
+	}
+	failures := 0
+	if err != nil || (result.Requeue && result.RequeueAfter == 0) {
+		failures = t.podSets[key].failures + 1
+	}
+	t.podSets[key] = reconcileRecord{time: now, result: result, err: err, failures: failures}
+}
+
+// get returns the last reconcile of the PodSet, if any.
+func (t *reconcileTracker) get(key types.NamespacedName) (reconcileRecord, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	record, ok := t.podSets[key]
+	return record, ok
+}
+
+// forget drops the record of the PodSet once it is gone.
+func (t *reconcileTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.podSets, key)
+}
+
+// backoff returns the delay the workqueue applies before the next requeue
+// after the given number of consecutive backed-off reconciles.
+func (r *PodSetReconciler) backoff(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+	base, limit := r.RetryBaseDelay, r.RetryMaxDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	if limit <= 0 {
+		limit = defaultRetryMaxDelay
+	}
+	delay := base
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// flapChanges returns the number of changes of the PodSet's scale direction
+// remembered by the tracker.
+func (t *flapTracker) flapChanges(key types.NamespacedName) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if history, ok := t.podSets[key]; ok {
+		return len(history.changes)
+	}
+	return 0
+}
+
+// DebugPodSet is the operator's view of a PodSet served by the debug
+// endpoint.
+type DebugPodSet struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// Desired is the number of pods the controller last aimed to run.
+	Desired int32 `json:"desired"`
+	// Observed and Ready count the running and pending pods in the cache,
+	// and those of them that are Ready.
+	Observed int32 `json:"observed"`
+	Ready    int32 `json:"ready"`
+
+	// Blocked lists the conditions that are True and hold back scaling,
+	// such as Degraded or Flapping.
+	Blocked []string `json:"blocked,omitempty"`
+	// FlapChanges is the number of recent changes of scale direction.
+	FlapChanges int `json:"flapChanges"`
+
+	// PendingCreates and PendingRemoves count the pods the controller
+	// created or removed that the cache does not show yet.
+	PendingCreates int `json:"pendingCreates"`
+	PendingRemoves int `json:"pendingRemoves"`
+	// CreateBreakerOpen is whether creating pods failed so many times in a
+	// row that the controller stopped trying until the spec changes.
+	CreateBreakerOpen bool `json:"createBreakerOpen"`
+
+	LastReconcile *DebugReconcile `json:"lastReconcile,omitempty"`
+}
+
+// DebugReconcile describes the last reconcile of a PodSet.
+type DebugReconcile struct {
+	Time         metav1.Time     `json:"time"`
+	Requeue      bool            `json:"requeue,omitempty"`
+	RequeueAfter metav1.Duration `json:"requeueAfter,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	// Failures counts the consecutive reconciles requeued with backoff, and
+	// Backoff is the delay before the next such requeue.
+	Failures int             `json:"failures,omitempty"`
+	Backoff  metav1.Duration `json:"backoff,omitempty"`
+}
+
+// blockingConditions are the conditions that, when True, hold back the
+// scaling of a PodSet.
+var blockingConditions = []string{
+	podsetv1alpha1.ConditionDegraded,
+	podsetv1alpha1.ConditionNodesUnavailable,
+	podsetv1alpha1.ConditionAwaitingApproval,
+	podsetv1alpha1.ConditionRolloutFailed,
+	podsetv1alpha1.ConditionHostPortsExhausted,
+	podsetv1alpha1.ConditionInsufficientCapacity,
+	podsetv1alpha1.ConditionBudgetExceeded,
+	podsetv1alpha1.ConditionMissingReference,
+	podsetv1alpha1.ConditionObserveOnly,
+	podsetv1alpha1.ConditionPaused,
+	podsetv1alpha1.ConditionInvalidPodTemplate,
+	podsetv1alpha1.ConditionReplicaFailure,
+	podsetv1alpha1.ConditionClassNotFound,
+	podsetv1alpha1.ConditionColocationTargetMissing,
+	podsetv1alpha1.ConditionScaleDownDeferred,
+	podsetv1alpha1.ConditionFlapping,
+}
+
+// DebugServer serves, on a loopback address, a JSON view of the PodSets
+// the reconciler manages, built from the cache and the reconciler's own
+// memory without calls to the API server:
+//
+//	GET /debug/podsets                   every PodSet
+//	GET /debug/podsets/<namespace>/<name> one PodSet
+//
+// With LogLevels set, it also serves the operator's log level, which a PUT
+// changes until the operator restarts:
+//
+//	GET, PUT /debug/loglevel           {"level": "debug"}
+//	GET, PUT /debug/loglevel/overrides {"<namespace>[/<name>]": "debug"}
+type DebugServer struct {
+	// Addr is the address to serve on. Its host must be a loopback
+	// address.
+	Addr string
+
+	// Reader reads from the manager's cache.
+	Reader     client.Reader
+	Reconciler *PodSetReconciler
+	LogLevels  *LogLevels
+}
+
+// Start implements manager.Runnable.
+func (s *DebugServer) Start(ctx context.Context) error {
+	log := ctrllog.FromContext(ctx).WithName("debug")
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("debug address %s is not a loopback address", s.Addr)
+	}
+
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Failed to shut down the debug server")
+		}
+	}()
+
+	log.Info("Serving debug endpoint", "address", s.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that every
+// replica serves its own view.
+func (s *DebugServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the handler of the debug endpoints.
+func (s *DebugServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/podsets", s.listPodSets)
+	mux.HandleFunc("/debug/podsets/", s.getPodSet)
+	if s.LogLevels != nil {
+		mux.Handle("/debug/loglevel", s.LogLevels.Level)
+		mux.HandleFunc("/debug/loglevel/overrides", s.LogLevels.ServeOverrides)
+	}
+	return mux
+}
+
+func (s *DebugServer) listPodSets(w http.ResponseWriter, req *http.Request) {
+	podSets := &podsetv1alpha1.PodSetList{}
+	if err := s.Reader.List(req.Context(), podSets); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(podSets.Items, func(i, j int) bool {
+		a, b := podSets.Items[i], podSets.Items[j]
+		return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+	})
+	views := []DebugPodSet{}
+	for i := range podSets.Items {
+		if !s.Reconciler.ownsObject(&podSets.Items[i]) {
+			continue
+		}
+		view, err := s.describe(req.Context(), &podSets.Items[i])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		views = append(views, view)
+	}
+	writeJSON(w, views)
+}
+
+func (s *DebugServer) getPodSet(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/debug/podsets/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "expected /debug/podsets/<namespace>/<name>", http.StatusBadRequest)
+		return
+	}
+	podSet := &podsetv1alpha1.PodSet{}
+	if err := s.Reader.Get(req.Context(), types.NamespacedName{Namespace: parts[0], Name: parts[1]}, podSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	view, err := s.describe(req.Context(), podSet)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, view)
+}
+
+// describe builds the debug view of the PodSet from the cache and the
+// reconciler's memory.
+func (s *DebugServer) describe(ctx context.Context, podSet *podsetv1alpha1.PodSet) (DebugPodSet, error) {
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}
+	view := DebugPodSet{
+		Namespace:   podSet.Namespace,
+		Name:        podSet.Name,
+		Desired:     podSet.Status.DesiredReplicas,
+		FlapChanges: s.Reconciler.flaps.flapChanges(key),
+	}
+	view.PendingCreates, view.PendingRemoves = s.Reconciler.expectations.pending(key)
+	_, reached := s.Reconciler.createFailureLimitReached(podSet)
+	view.CreateBreakerOpen = reached || checkReplicaFailure(podSet, podSet.Status.DeepCopy())
+
+	pods, err := listPodSetPods(ctx, s.Reader, podSet)
+	if err != nil {
+		return view, err
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || (pod.Status.Phase != corev1.PodRunning && pod.Status.Phase != corev1.PodPending) {
+			continue
+		}
+		view.Observed++
+		if isPodReady(pod) {
+			view.Ready++
+		}
+	}
+
+	for _, cond := range podSet.Status.Conditions {
+		for _, blocking := range blockingConditions {
+			if cond.Type == blocking && cond.Status == metav1.ConditionTrue {
+				view.Blocked = append(view.Blocked, cond.Type)
+			}
+		}
+	}
+
+	if record, ok := s.Reconciler.reconciles.get(key); ok {
+		view.LastReconcile = &DebugReconcile{
+			Time:         metav1.NewTime(record.time),
+			Requeue:      record.result.Requeue,
+			RequeueAfter: metav1.Duration{Duration: record.result.RequeueAfter},
+			Failures:     record.failures,
+			Backoff:      metav1.Duration{Duration: s.Reconciler.backoff(record.failures)},
+		}
+		if record.err != nil {
+			view.LastReconcile.Error = record.err.Error()
+		}
+	}
+	return view, nil
+}
+
+// writeJSON writes v as an indented JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
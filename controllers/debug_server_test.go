@@ -0,0 +1,148 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		base, max time.Duration
+		failures  int
+		want      time.Duration
+	}{
+		{name: "no failures", failures: 0, want: 0},
+		{name: "default first", failures: 1, want: 5 * time.Millisecond},
+		{name: "default doubled", failures: 3, want: 20 * time.Millisecond},
+		{name: "default capped", failures: 40, want: 1000 * time.Second},
+		{name: "configured first", base: time.Second, max: time.Minute, failures: 1, want: time.Second},
+		{name: "configured doubled", base: time.Second, max: time.Minute, failures: 4, want: 8 * time.Second},
+		{name: "configured capped", base: time.Second, max: time.Minute, failures: 10, want: time.Minute},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &PodSetReconciler{RetryBaseDelay: tc.base, RetryMaxDelay: tc.max}
+			if got := r.backoff(tc.failures); got != tc.want {
+				t.Errorf("backoff(%d) = %s, want %s", tc.failures, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReconcileTrackerCountsFailures(t *testing.T) {
+	var tracker reconcileTracker
+	key := types.NamespacedName{Namespace: "default", Name: "web"}
+	now := time.Now()
+	tracker.record(key, now, ctrl.Result{}, errors.New("boom"))
+	tracker.record(key, now, ctrl.Result{Requeue: true}, nil)
+	if record, _ := tracker.get(key); record.failures != 2 {
+		t.Errorf("failures = %d after an error and a requeue, want 2", record.failures)
+	}
+	tracker.record(key, now, ctrl.Result{RequeueAfter: time.Minute}, nil)
+	if record, _ := tracker.get(key); record.failures != 0 {
+		t.Errorf("failures = %d after a delayed requeue, want 0", record.failures)
+	}
+	tracker.forget(key)
+	if _, ok := tracker.get(key); ok {
+		t.Error("record kept after forgetting the PodSet")
+	}
+}
+
+func TestDebugServerDescribesPodSets(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Status.DesiredReplicas = 3
+	meta.SetStatusCondition(&podSet.Status.Conditions, metav1.Condition{
+		Type: podsetv1alpha1.ConditionDegraded, Status: metav1.ConditionTrue, Reason: reasonFailurePolicyHalt,
+	})
+	ready := leaderTestPod("web-a", time.Hour, true, false)
+	notReady := leaderTestPod("web-b", time.Hour, false, false)
+	failed := failedTestPod("web-c", "hash")
+	r := newTestReconciler(t, podSet, ready, notReady, failed)
+	key := types.NamespacedName{Namespace: "default", Name: "web"}
+	r.reconciles.record(key, time.Now(), ctrl.Result{}, errors.New("boom"))
+	r.expectations.expectCreate(key, "web-d", time.Now())
+	r.expectations.expectCreate(key, "web-e", time.Now())
+	r.expectations.expectRemove(key, "web-f", time.Now())
+	r.CreateFailureLimit = 2
+	for i := 0; i < 2; i++ {
+		r.createFailures.record(key, podSet.Generation, errors.New("quota exceeded"))
+	}
+	server := httptest.NewServer((&DebugServer{Reader: r.Client, Reconciler: r}).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/podsets/default/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var view DebugPodSet
+	if err := json.NewDecoder(resp.Body).Decode(&view); err != nil {
+		t.Fatal(err)
+	}
+	if view.Desired != 3 || view.Observed != 2 || view.Ready != 1 {
+		t.Errorf("desired %d, observed %d, ready %d, want 3, 2 and 1", view.Desired, view.Observed, view.Ready)
+	}
+	if want := []string{podsetv1alpha1.ConditionDegraded}; !reflect.DeepEqual(view.Blocked, want) {
+		t.Errorf("blocked = %v, want %v", view.Blocked, want)
+	}
+	if view.LastReconcile == nil || view.LastReconcile.Error != "boom" || view.LastReconcile.Failures != 1 {
+		t.Errorf("last reconcile = %+v, want the failure", view.LastReconcile)
+	}
+	if view.PendingCreates != 2 || view.PendingRemoves != 1 {
+		t.Errorf("pending creates %d and removes %d, want 2 and 1", view.PendingCreates, view.PendingRemoves)
+	}
+	if !view.CreateBreakerOpen {
+		t.Error("create breaker closed after reaching the failure limit, want it open")
+	}
+
+	for path, want := range map[string]int{
+		"/debug/podsets":                http.StatusOK,
+		"/debug/podsets/default/absent": http.StatusNotFound,
+		"/debug/podsets/default":        http.StatusBadRequest,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestDebugServerRequiresLoopback(t *testing.T) {
+	s := &DebugServer{Addr: "0.0.0.0:8082"}
+	if err := s.Start(context.Background()); err == nil {
+		t.Error("serving on 0.0.0.0 was allowed, want only loopback addresses")
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// recentlyDeletedLimit is the number of deleted pods kept in
+// status.recentlyDeleted.
+const recentlyDeletedLimit = 20
+
+// deletedPod returns the record of the pod deleted now for the reason.
+func deletedPod(name string, reason podsetv1alpha1.PodDeletionReason) podsetv1alpha1.DeletedPod {
+	return podsetv1alpha1.DeletedPod{Name: name, Time: metav1.Now(), Reason: reason}
+}
+
+// recordDeletions appends the deleted pods to status.recentlyDeleted and
+// trims it to the most recent recentlyDeletedLimit entries.
+func recordDeletions(status *podsetv1alpha1.PodSetStatus, deleted []podsetv1alpha1.DeletedPod) {
+	if len(deleted) == 0 {
+		return
+	}
+	recent := append(append([]podsetv1alpha1.DeletedPod(nil), status.RecentlyDeleted...), deleted...)
+	if len(recent) > recentlyDeletedLimit {
+		recent = recent[len(recent)-recentlyDeletedLimit:]
+	}
+	status.RecentlyDeleted = recent
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestRecordDeletionsKeepsMostRecent(t *testing.T) {
+	status := &podsetv1alpha1.PodSetStatus{}
+	for i := 0; i < recentlyDeletedLimit+5; i++ {
+		recordDeletions(status, []podsetv1alpha1.DeletedPod{deletedPod(fmt.Sprintf("web-%d", i), podsetv1alpha1.ScaleDownDeletion)})
+	}
+	recordDeletions(status, nil)
+	if len(status.RecentlyDeleted) != recentlyDeletedLimit {
+		t.Fatalf("%d pods recorded, want %d", len(status.RecentlyDeleted), recentlyDeletedLimit)
+	}
+	if first, last := status.RecentlyDeleted[0].Name, status.RecentlyDeleted[recentlyDeletedLimit-1].Name; first != "web-5" || last != "web-24" {
+		t.Errorf("recorded web-5 to web-24 expected, got %s to %s", first, last)
+	}
+}
+
+func TestReconcileRecordsScaleDownDeletions(t *testing.T) {
+	podSet := testPodSet(1)
+	hash, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs := []client.Object{podSet}
+	for _, name := range []string{"web-a", "web-b"} {
+		labels := labelsForPodSet(podSet)
+		labels[templateHashLabel] = hash
+		objs = append(objs, ownedTestPod(podSet, name, labels))
+	}
+	r := newTestReconciler(t, objs...)
+
+	podSet, err = reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(podSet.Status.RecentlyDeleted) != 1 {
+		t.Fatalf("recentlyDeleted = %+v, want the pod scaled down", podSet.Status.RecentlyDeleted)
+	}
+	for _, deleted := range podSet.Status.RecentlyDeleted {
+		if deleted.Reason != podsetv1alpha1.ScaleDownDeletion || deleted.Time.IsZero() || podExists(t, r, deleted.Name) {
+			t.Errorf("recorded %+v, want a deleted pod with reason %s and a time", deleted, podsetv1alpha1.ScaleDownDeletion)
+		}
+	}
+}
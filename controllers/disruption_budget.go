@@ -0,0 +1,69 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// ensureDisruptionBudget creates or updates the PodSet's PodDisruptionBudget,
+// in the namespace of its pods, or deletes it once spec.disruptionBudget is
+// unset. The budget is owned by the PodSet and garbage collected with it,
+// unless it lives in another namespace, in which case the finalizer removes
+// it.
+func (r *PodSetReconciler) ensureDisruptionBudget(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podSet.Name,
+			Namespace: podNamespace(podSet),
+		},
+	}
+	spec := podSet.Spec.DisruptionBudget
+	if spec == nil {
+		if err := r.Get(ctx, types.NamespacedName{Namespace: pdb.Namespace, Name: pdb.Name}, pdb); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !createdFor(podSet, pdb) {
+			return nil
+		}
+		if err := r.Delete(ctx, pdb); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, pdb, func() error {
+		pdb.Labels = labelsForPodSet(podSet)
+		pdb.Spec.Selector = selectorForPodSet(podSet)
+		pdb.Spec.MinAvailable = spec.MinAvailable
+		pdb.Spec.MaxUnavailable = spec.MaxUnavailable
+		if isCrossNamespace(podSet) {
+			// Cleaned up by the finalizer instead.
+			return nil
+		}
+		return controllerutil.SetControllerReference(podSet, pdb, r.Scheme)
+	})
+	return err
+}
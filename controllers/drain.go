@@ -0,0 +1,112 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// forceDeleteAnnotation, set to "true" on a PodSet, skips its deletion
+	// drain and its cleanup hook.
+	forceDeleteAnnotation = "podset.example.com/force-delete"
+
+	reasonDraining = "Draining"
+)
+
+// drains reports whether the deleted PodSet's pods are drained gradually.
+func drains(podSet *podsetv1alpha1.PodSet) bool {
+	return podSet.Spec.DeletionDrain != nil && podSet.Annotations[forceDeleteAnnotation] != "true" && !isObserveOnly(podSet)
+}
+
+// clock returns the clock deletion drains are paced by.
+func (r *PodSetReconciler) clock() clock.PassiveClock {
+	if r.Clock == nil {
+		return clock.RealClock{}
+	}
+	return r.Clock
+}
+
+// drain deletes the pods of a deleted PodSet, spec.deletionDrain.pods at a
+// time with spec.deletionDrain.interval between deletions, and reports
+// whether any pods remain. It returns the result to wait with while they do.
+func (r *PodSetReconciler) drain(ctx context.Context, podSet *podsetv1alpha1.PodSet) (bool, ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	pods, err := listPodSetPods(ctx, r, podSet)
+	if err != nil {
+		return true, ctrl.Result{}, err
+	}
+	if len(pods) == 0 {
+		return false, ctrl.Result{}, nil
+	}
+	var remaining []corev1.Pod
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			remaining = append(remaining, pod)
+		}
+	}
+	if len(remaining) == 0 {
+		// Wait for the last pods to terminate.
+		return true, ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	drain := podSet.Spec.DeletionDrain
+	status := podSet.Status.Drain
+	if status != nil && status.LastDeletionTime != nil {
+		if wait := drain.Interval.Duration - r.clock().Since(status.LastDeletionTime.Time); wait > 0 {
+			return true, ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	batch := preferNonLeader(remaining, podSet.Status.Leader)
+	if len(batch) > int(drain.Pods) {
+		batch = batch[:drain.Pods]
+	}
+	var deleted []podsetv1alpha1.DeletedPod
+	for _, pod := range batch {
+		log.Info("Draining pod of deleted PodSet", "pod.name", pod.Name)
+		if err := r.Delete(ctx, &pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+			return true, ctrl.Result{}, err
+		}
+		deleted = append(deleted, deletedPod(pod.Name, podsetv1alpha1.PodSetDeletedDeletion))
+	}
+	patch := client.MergeFrom(podSet.DeepCopy())
+	recordDeletions(&podSet.Status, deleted)
+	now := metav1.NewTime(r.clock().Now())
+	podSet.Status.Drain = &podsetv1alpha1.DrainStatus{
+		RemainingPods:    int32(len(remaining) - len(batch)),
+		LastDeletionTime: &now,
+	}
+	r.Recorder.Event(podSet, corev1.EventTypeNormal, reasonDraining,
+		fmt.Sprintf("Deleted %d pods, %d remaining", len(batch), len(remaining)-len(batch)))
+	if err := r.Status().Patch(ctx, podSet, patch); err != nil {
+		return true, ctrl.Result{}, err
+	}
+	return true, ctrl.Result{RequeueAfter: drain.Interval.Duration}, nil
+}
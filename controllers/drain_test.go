@@ -0,0 +1,175 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestDrain(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Spec.DeletionDrain = &podsetv1alpha1.DeletionDrain{Pods: 2, Interval: metav1.Duration{Duration: time.Minute}}
+	podSet.Status.Leader = "web-a"
+	r := newTestReconciler(t, podSet,
+		leaderTestPod("web-a", time.Hour, true, true),
+		leaderTestPod("web-b", time.Hour, true, false),
+		leaderTestPod("web-c", time.Hour, true, false),
+	)
+	clock := clocktesting.NewFakeClock(time.Now().Truncate(time.Second))
+	r.Clock = clock
+	ctx := context.Background()
+
+	pending, result, err := r.drain(ctx, podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending || result.RequeueAfter != time.Minute {
+		t.Errorf("drain = %v, %+v, want pods pending and a retry after the interval", pending, result)
+	}
+	if podExists(t, r, "web-b") || podExists(t, r, "web-c") || !podExists(t, r, "web-a") {
+		t.Error("want web-b and web-c drained first and the leader web-a kept")
+	}
+	if drain := podSet.Status.Drain; drain == nil || drain.RemainingPods != 1 || drain.LastDeletionTime == nil {
+		t.Errorf("drain status = %+v, want 1 pod remaining", drain)
+	}
+	if deleted := podSet.Status.RecentlyDeleted; len(deleted) != 2 || deleted[0].Reason != podsetv1alpha1.PodSetDeletedDeletion {
+		t.Errorf("recently deleted = %+v, want 2 %s", deleted, podsetv1alpha1.PodSetDeletedDeletion)
+	}
+
+	// The next batch waits for the interval.
+	clock.Step(20 * time.Second)
+	pending, result, err = r.drain(ctx, podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending || result.RequeueAfter != 40*time.Second || !podExists(t, r, "web-a") {
+		t.Errorf("drain = %v, %+v, want web-a kept for the rest of the interval", pending, result)
+	}
+
+	clock.Step(40 * time.Second)
+	pending, result, err = r.drain(ctx, podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending || result.RequeueAfter != time.Minute || podExists(t, r, "web-a") {
+		t.Errorf("drain = %v, %+v, want web-a drained once the interval passed", pending, result)
+	}
+	if drain := podSet.Status.Drain; drain.RemainingPods != 0 || !drain.LastDeletionTime.Time.Equal(clock.Now()) {
+		t.Errorf("drain status = %+v, want no pods remaining, deleted at %v", drain, clock.Now())
+	}
+	if pending, _, err := r.drain(ctx, podSet); err != nil || pending {
+		t.Errorf("drain = %v, %v, want no pods pending", pending, err)
+	}
+}
+
+func TestDrains(t *testing.T) {
+	podSet := testPodSet(1)
+	if drains(podSet) {
+		t.Error("drains without spec.deletionDrain")
+	}
+	podSet.Spec.DeletionDrain = &podsetv1alpha1.DeletionDrain{Pods: 1}
+	if !drains(podSet) {
+		t.Error("does not drain with spec.deletionDrain")
+	}
+	podSet.Annotations = map[string]string{forceDeleteAnnotation: "true"}
+	if drains(podSet) {
+		t.Error("drains with the force-delete annotation")
+	}
+}
+
+func TestDrainWaitsForTerminatingPods(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.DeletionDrain = &podsetv1alpha1.DeletionDrain{Pods: 1}
+	pod := leaderTestPod("web-a", time.Hour, true, false)
+	pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	pod.Finalizers = []string{"example.com/hold"}
+	r := newTestReconciler(t, podSet, pod)
+
+	pending, result, err := r.drain(context.Background(), podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending || result.RequeueAfter == 0 {
+		t.Errorf("drain = %v, %+v, want a wait for the terminating pod", pending, result)
+	}
+}
+
+func TestFinalizeForceDeleteSkipsDrain(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Spec.TargetNamespace = "pods"
+	podSet.Spec.DeletionDrain = &podsetv1alpha1.DeletionDrain{Pods: 1, Interval: metav1.Duration{Duration: time.Hour}}
+	podSet.Finalizers = []string{podSetFinalizer}
+	objs := []client.Object{podSet}
+	for _, name := range []string{"web-a", "web-b", "web-c"} {
+		pod := leaderTestPod(name, time.Hour, true, false)
+		pod.Namespace = "pods"
+		pod.Labels = labelsForPodSet(podSet)
+		objs = append(objs, pod)
+	}
+	r := newTestReconciler(t, objs...)
+	ctx := context.Background()
+	key := client.ObjectKeyFromObject(podSet)
+	remaining := func() int {
+		t.Helper()
+		pods := &corev1.PodList{}
+		if err := r.List(ctx, pods, client.InNamespace("pods")); err != nil {
+			t.Fatal(err)
+		}
+		return len(pods.Items)
+	}
+
+	if err := r.Delete(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, podSet); err != nil {
+		t.Fatal(err)
+	}
+	result, err := r.finalize(ctx, podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != time.Hour || remaining() != 2 {
+		t.Fatalf("finalize = %+v with %d pods left, want one pod drained and a wait for the interval", result, remaining())
+	}
+
+	podSet.Annotations = map[string]string{forceDeleteAnnotation: "true"}
+	if err := r.Update(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.finalize(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if n := remaining(); n != 0 {
+		t.Errorf("%d pods left after the force-delete, want all deleted without waiting for the interval", n)
+	}
+	if _, err := r.finalize(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, podSet); !errors.IsNotFound(err) {
+		t.Errorf("get after force-delete = %v, want the PodSet gone", err)
+	}
+}
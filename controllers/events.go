@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	reasonSuccessfulCreate = "SuccessfulCreate"
+	reasonFailedCreate     = "FailedCreate"
+	reasonSuccessfulDelete = "SuccessfulDelete"
+	reasonFailedDelete     = "FailedDelete"
+)
+
+// podDeleted records in state, and in an event, that the reconcile deleted
+// the PodSet's pod for the reason.
+func (r *PodSetReconciler) podDeleted(podSet *podsetv1alpha1.PodSet, state *podSetState, pod *corev1.Pod, reason podsetv1alpha1.PodDeletionReason) {
+	state.deleted = append(state.deleted, deletedPod(pod.Name, reason))
+	r.expectations.expectRemove(types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}, pod.Name, time.Now())
+	podSetPodsDeleted.WithLabelValues(podSet.Namespace, podSet.Name, string(reason)).Inc()
+	r.Recorder.Event(podSet, corev1.EventTypeNormal, reasonSuccessfulDelete,
+		fmt.Sprintf("Deleted pod %s: %s", pod.Name, reason))
+}
+
+// podDeleteFailed reports in an event that deleting the PodSet's pod failed.
+func (r *PodSetReconciler) podDeleteFailed(podSet *podsetv1alpha1.PodSet, pod *corev1.Pod, err error) {
+	r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonFailedDelete,
+		fmt.Sprintf("Error deleting pod %s: %v", pod.Name, err))
+}
+
+// recordScaling reports in an event that the PodSet scales from one number
+// of pods towards another.
+func (r *PodSetReconciler) recordScaling(podSet *podsetv1alpha1.PodSet, from, to int32) {
+	reason := reasonScalingUp
+	if to < from {
+		reason = reasonScalingDown
+	}
+	r.Recorder.Event(podSet, corev1.EventTypeNormal, reason, fmt.Sprintf("Scaling from %d to %d pods", from, to))
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// usesEvictionAPI reports whether the PodSet's pods are evicted rather than
+// deleted on scale-down.
+func usesEvictionAPI(podSet *podsetv1alpha1.PodSet) bool {
+	return podSet.Spec.ScaleDown != nil && podSet.Spec.ScaleDown.UseEvictionAPI
+}
+
+// podDeleteOptions returns the options the PodSet's pods are deleted with.
+func podDeleteOptions(podSet *podsetv1alpha1.PodSet) []client.DeleteOption {
+	if gracePeriod := podSet.Spec.TerminationGracePeriodSeconds; gracePeriod != nil {
+		return []client.DeleteOption{client.GracePeriodSeconds(*gracePeriod)}
+	}
+	return nil
+}
+
+// scaleDownPod removes a pod of the PodSet on scale-down, evicting it if the
+// PodSet uses the Eviction API. It reports false, with no error, when a
+// PodDisruptionBudget refuses the eviction.
+func (r *PodSetReconciler) scaleDownPod(ctx context.Context, podSet *podsetv1alpha1.PodSet, pod *corev1.Pod) (bool, error) {
+	if !usesEvictionAPI(podSet) {
+		if err := r.Delete(ctx, pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		return true, nil
+	}
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	}
+	if gracePeriod := podSet.Spec.TerminationGracePeriodSeconds; gracePeriod != nil {
+		eviction.DeleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: gracePeriod}
+	}
+	err := r.Pods.Pods(pod.Namespace).EvictV1(ctx, eviction)
+	switch {
+	case err == nil, errors.IsNotFound(err):
+		return true, nil
+	case errors.IsTooManyRequests(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// scaleDownPods removes up to count of the candidate pods, in order, skipping
+// those a PodDisruptionBudget protects. Pods are orphaned rather than
+// deleted while the state has orphans pending. It returns the pods removed
+// and whether any were skipped.
+func (r *PodSetReconciler) scaleDownPods(ctx context.Context, podSet *podsetv1alpha1.PodSet, state *podSetState, candidates []corev1.Pod, count int) ([]corev1.Pod, bool, error) {
+	log := ctrllog.FromContext(ctx)
+	var (
+		removed  []corev1.Pod
+		orphaned []string
+		blocked  bool
+	)
+	defer func() { r.recordOrphans(podSet, orphaned) }()
+	for i := range candidates {
+		if len(removed) == count {
+			break
+		}
+		pod := &candidates[i]
+		if state.orphans > 0 {
+			if err := r.orphanPod(ctx, podSet, pod); err != nil {
+				log.Error(err, "Failed to orphan pod", "pod.name", pod.Name)
+				return removed, blocked, err
+			}
+			log.Info("Orphaned pod", "pod.name", pod.Name)
+			state.orphans--
+			orphaned = append(orphaned, pod.Name)
+			removed = append(removed, *pod)
+			continue
+		}
+		ok, err := r.scaleDownPod(ctx, podSet, pod)
+		if err != nil {
+			log.Error(err, "Failed to delete pod", "pod.name", pod.Name)
+			r.podDeleteFailed(podSet, pod, err)
+			return removed, blocked, err
+		}
+		if !ok {
+			log.Info("Eviction refused by a PodDisruptionBudget, trying the next pod", "pod.name", pod.Name)
+			blocked = true
+			continue
+		}
+		r.podDeleted(podSet, state, pod, podsetv1alpha1.ScaleDownDeletion)
+		removed = append(removed, *pod)
+	}
+	return removed, blocked, nil
+}
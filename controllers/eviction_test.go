@@ -0,0 +1,108 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// fakeEvictions returns a pods client that records the pods it is asked to
+// evict, refusing those in protected as a PodDisruptionBudget would.
+func fakeEvictions(evicted *[]string, protected ...string) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(clienttesting.CreateAction).GetObject().(*policyv1.Eviction)
+		for _, name := range protected {
+			if eviction.Name == name {
+				return true, nil, errors.NewTooManyRequests("disruption budget", 10)
+			}
+		}
+		*evicted = append(*evicted, eviction.Name)
+		return true, nil, nil
+	})
+	return clientset
+}
+
+func TestScaleDownPodsEvicts(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.ScaleDown = &podsetv1alpha1.ScaleDownSpec{UseEvictionAPI: true}
+	candidates := rolloutTestPods("hash", "web-a", "web-b", "web-c")
+	r := rolloutTestReconciler(t, podSet, candidates)
+	var evicted []string
+	r.Pods = fakeEvictions(&evicted, "web-a").CoreV1()
+	state := &podSetState{}
+
+	removed, blocked, err := r.scaleDownPods(context.Background(), podSet, state, candidates, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"web-b", "web-c"}; !reflect.DeepEqual(evicted, want) || len(removed) != 2 || !blocked {
+		t.Errorf("evicted %v, removed %d and blocked = %v, want %v evicted past the protected web-a", evicted, len(removed), blocked, want)
+	}
+	// Evicted pods are left for the eviction to delete.
+	if !podExists(t, r, "web-b") {
+		t.Error("web-b was deleted directly, want it evicted")
+	}
+	if len(state.deleted) != 2 || state.deleted[0].Reason != podsetv1alpha1.ScaleDownDeletion {
+		t.Errorf("recorded deletions = %+v, want 2 %s", state.deleted, podsetv1alpha1.ScaleDownDeletion)
+	}
+}
+
+func TestScaleDownPodsDeletesWithoutEvictionAPI(t *testing.T) {
+	podSet := testPodSet(1)
+	candidates := rolloutTestPods("hash", "web-a", "web-b")
+	r := rolloutTestReconciler(t, podSet, candidates)
+	var evicted []string
+	r.Pods = fakeEvictions(&evicted).CoreV1()
+
+	removed, blocked, err := r.scaleDownPods(context.Background(), podSet, &podSetState{}, candidates, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || blocked || len(evicted) != 0 || podExists(t, r, "web-a") {
+		t.Errorf("removed %d, blocked = %v and evicted %v, want web-a deleted", len(removed), blocked, evicted)
+	}
+}
+
+func TestPodDeleteOptions(t *testing.T) {
+	podSet := testPodSet(1)
+	if opts := podDeleteOptions(podSet); len(opts) != 0 {
+		t.Errorf("options = %v, want none", opts)
+	}
+	grace := int64(time.Minute / time.Second)
+	podSet.Spec.TerminationGracePeriodSeconds = &grace
+	deleteOpts := &client.DeleteOptions{}
+	deleteOpts.ApplyOptions(podDeleteOptions(podSet))
+	if deleteOpts.GracePeriodSeconds == nil || *deleteOpts.GracePeriodSeconds != 60 {
+		t.Errorf("grace period = %v, want 60 seconds", deleteOpts.GracePeriodSeconds)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// expectationsTimeout is how long the controller waits for the cache to
+// reflect its own creates and removals before it gives up on them, in case
+// one is never observed.
+const expectationsTimeout = 5 * time.Minute
+
+// podSetExpectations are the pods a PodSet's reconciles created or removed
+// and the cache has not yet caught up with, by name, with when they were
+// expected.
+type podSetExpectations struct {
+	creates map[string]time.Time
+	removes map[string]time.Time
+}
+
+// expectationsTracker holds the podSetExpectations of each PodSet, so that a
+// reconcile working from a cache that lags behind the controller's own
+// writes neither creates pods a second time nor removes more than it should.
+type expectationsTracker struct {
+	mu      sync.Mutex
+	podSets map[types.NamespacedName]*podSetExpectations
+}
+
+// forget drops the expectations of the PodSet once it is gone.
+func (t *expectationsTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.podSets, key)
+}
+
+// get returns the expectations of the PodSet, creating them. t.mu must be
+// held.
+func (t *expectationsTracker) get(key types.NamespacedName) *podSetExpectations {
+	if t.podSets == nil {
+		t.podSets = map[types.NamespacedName]*podSetExpectations{}
+	}
+	e, ok := t.podSets[key]
+	if !ok {
+		e = &podSetExpectations{creates: map[string]time.Time{}, removes: map[string]time.Time{}}
+		t.podSets[key] = e
+	}
+	return e
+}
+
+// expectCreate records that the pod was created for the PodSet.
+func (t *expectationsTracker) expectCreate(key types.NamespacedName, name string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(key).creates[name] = now
+}
+
+// expectRemove records that the pod was deleted or released from the
+// PodSet.
+func (t *expectationsTracker) expectRemove(key types.NamespacedName, name string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(key).removes[name] = now
+}
+
+// pending returns the number of creates and removals of the PodSet's pods
+// the cache has yet to show, as of the last observe.
+func (t *expectationsTracker) pending(key types.NamespacedName) (creates, removes int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.podSets[key]; ok {
+		return len(e.creates), len(e.removes)
+	}
+	return 0, 0
+}
+
+// observe checks the expectations of the PodSet against its listed pods,
+// dropping those that are met or have timed out. A create is met once the
+// pod is listed, and a removal once it is not, or is being deleted. It
+// returns how long until the oldest unmet expectation times out, or zero if
+// all are met.
+func (t *expectationsTracker) observe(key types.NamespacedName, pods []corev1.Pod, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.podSets[key]
+	if !ok {
+		return 0
+	}
+	listed := map[string]*corev1.Pod{}
+	for i := range pods {
+		listed[pods[i].Name] = &pods[i]
+	}
+	var wait time.Duration
+	pending := func(expected time.Time) bool {
+		remaining := expectationsTimeout - now.Sub(expected)
+		if remaining <= 0 {
+			return false
+		}
+		if wait == 0 || remaining < wait {
+			wait = remaining
+		}
+		return true
+	}
+	for name, expected := range e.creates {
+		if _, ok := listed[name]; ok || !pending(expected) {
+			delete(e.creates, name)
+		}
+	}
+	for name, expected := range e.removes {
+		if pod, ok := listed[name]; !ok || pod.DeletionTimestamp != nil || !pending(expected) {
+			delete(e.removes, name)
+		}
+	}
+	if len(e.creates) == 0 && len(e.removes) == 0 {
+		delete(t.podSets, key)
+	}
+	return wait
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestExpectationsObserve(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	terminating := leaderTestPod("web-a", time.Hour, true, false)
+	terminating.DeletionTimestamp = &metav1.Time{Time: start}
+	for _, tc := range []struct {
+		name    string
+		creates map[string]time.Time
+		removes map[string]time.Time
+		pods    []corev1.Pod
+		now     time.Time
+		want    time.Duration
+		// wantCreates and wantRemoves are the expectations left unmet.
+		wantCreates, wantRemoves int
+	}{
+		{
+			name:        "create not listed",
+			creates:     map[string]time.Time{"web-a": start},
+			now:         start.Add(time.Minute),
+			want:        expectationsTimeout - time.Minute,
+			wantCreates: 1,
+		},
+		{
+			name:    "create listed",
+			creates: map[string]time.Time{"web-a": start},
+			pods:    []corev1.Pod{*leaderTestPod("web-a", 0, false, false)},
+			now:     start.Add(time.Second),
+		},
+		{
+			name:        "removal still listed",
+			removes:     map[string]time.Time{"web-a": start},
+			pods:        []corev1.Pod{*leaderTestPod("web-a", time.Hour, true, false)},
+			now:         start.Add(time.Second),
+			want:        expectationsTimeout - time.Second,
+			wantRemoves: 1,
+		},
+		{
+			name:    "removal met by a deletion timestamp",
+			removes: map[string]time.Time{"web-a": start},
+			pods:    []corev1.Pod{*terminating},
+			now:     start.Add(time.Second),
+		},
+		{
+			name:    "removal not listed",
+			removes: map[string]time.Time{"web-a": start},
+			now:     start.Add(time.Second),
+		},
+		{
+			name:    "create timed out",
+			creates: map[string]time.Time{"web-a": start},
+			now:     start.Add(expectationsTimeout),
+		},
+		{
+			name:        "oldest unmet expectation times out first",
+			creates:     map[string]time.Time{"web-a": start, "web-b": start.Add(time.Minute)},
+			removes:     map[string]time.Time{"web-c": start.Add(2 * time.Minute)},
+			pods:        []corev1.Pod{*leaderTestPod("web-c", time.Hour, true, false)},
+			now:         start.Add(3 * time.Minute),
+			want:        expectationsTimeout - 3*time.Minute,
+			wantCreates: 2,
+			wantRemoves: 1,
+		},
+		{
+			name:        "timed out expectation dropped, the rest kept",
+			creates:     map[string]time.Time{"web-a": start, "web-b": start.Add(time.Minute)},
+			now:         start.Add(expectationsTimeout),
+			want:        time.Minute,
+			wantCreates: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var tracker expectationsTracker
+			key := types.NamespacedName{Namespace: "default", Name: "web"}
+			for name, at := range tc.creates {
+				tracker.expectCreate(key, name, at)
+			}
+			for name, at := range tc.removes {
+				tracker.expectRemove(key, name, at)
+			}
+			if got := tracker.observe(key, tc.pods, tc.now); got != tc.want {
+				t.Errorf("observe = %s, want %s", got, tc.want)
+			}
+			if creates, removes := tracker.pending(key); creates != tc.wantCreates || removes != tc.wantRemoves {
+				t.Errorf("pending creates %d and removes %d, want %d and %d", creates, removes, tc.wantCreates, tc.wantRemoves)
+			}
+		})
+	}
+}
+
+// stalePodLists lists no pods, like a cache that has not caught up with
+// the creates, and counts the pods created other than in a dry run.
+type stalePodLists struct {
+	client.Client
+	creates *int32
+}
+
+func (c stalePodLists) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if _, ok := list.(*corev1.PodList); ok {
+		return nil
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c stalePodLists) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	if _, ok := obj.(*corev1.Pod); ok && len(createOpts.DryRun) == 0 {
+		atomic.AddInt32(c.creates, 1)
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestReconcileWaitsForCreatesInCache(t *testing.T) {
+	r := newTestReconciler(t, testPodSet(2))
+	var creates int32
+	r.Client = stalePodLists{Client: r.Client, creates: &creates}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if creates != 2 {
+		t.Fatalf("created %d pods, want 2", creates)
+	}
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creates != 2 {
+		t.Errorf("created %d pods in all, want none more while the cache does not show the first 2", creates)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > expectationsTimeout {
+		t.Errorf("result = %+v, want a wait of at most %s for the cache", result, expectationsTimeout)
+	}
+}
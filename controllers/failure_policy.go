@@ -0,0 +1,241 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// failureAcknowledgedAnnotation marks a failed pod whose failure was
+	// acknowledged by editing the PodSet spec, so it no longer halts the
+	// PodSet under the Halt failure policy.
+	failureAcknowledgedAnnotation = "podset.example.com/failure-acknowledged"
+
+	reasonFailurePolicyHalt = "FailurePolicyHalt"
+	reasonAsExpected        = "AsExpected"
+)
+
+// applyFailurePolicy reports whether the PodSet's failure policy forbids
+// replacing failed pods, and records the outcome in the Degraded condition of
+// status. It also returns the failed pods that the pod failure policy counts
+// as done.
+//
+// Under the Halt policy the PodSet stays halted until the failed pods are
+// deleted or the spec is edited. Editing the spec acknowledges the failures
+// seen so far, which is recorded on the failed pods themselves so they do not
+// halt the PodSet again.
+func (r *PodSetReconciler) applyFailurePolicy(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, failed []corev1.Pod) (bool, []corev1.Pod, error) {
+	var unacknowledged, ignored []corev1.Pod
+	for _, pod := range failed {
+		switch podFailureAction(podSet, &pod) {
+		case podsetv1alpha1.IgnorePodFailureAction:
+			ignored = append(ignored, pod)
+		case podsetv1alpha1.HaltPodFailureAction:
+			if pod.Annotations[failureAcknowledgedAnnotation] != "true" {
+				unacknowledged = append(unacknowledged, pod)
+			}
+		}
+	}
+	if len(unacknowledged) == 0 {
+		clearDegraded(status, reasonFailurePolicyHalt, podSet.Generation)
+		return false, ignored, nil
+	}
+
+	generation := podSet.Generation
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason == reasonFailurePolicyHalt {
+		if cond.ObservedGeneration < podSet.Generation {
+			// The spec was edited while halted.
+			for i := range unacknowledged {
+				pod := &unacknowledged[i]
+				patch := client.MergeFrom(pod.DeepCopy())
+				metav1.SetMetaDataAnnotation(&pod.ObjectMeta, failureAcknowledgedAnnotation, "true")
+				if err := r.Patch(ctx, pod, patch); err != nil {
+					return false, nil, err
+				}
+			}
+			clearDegraded(status, reasonFailurePolicyHalt, podSet.Generation)
+			return false, ignored, nil
+		}
+		// Keep the generation we halted at so a later edit is noticed.
+		generation = cond.ObservedGeneration
+	}
+
+	var failures []string
+	for _, pod := range unacknowledged {
+		failures = append(failures, podFailureMessage(&pod))
+	}
+	message := "Not replacing failed pods until they are deleted or the spec is edited: " + strings.Join(failures, "; ")
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != reasonFailurePolicyHalt {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonFailurePolicyHalt, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonFailurePolicyHalt,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+	return true, ignored, nil
+}
+
+// deleteReplacedFailures deletes the failed pods that the failure policy
+// replaces, whatever the PodSet's pod management, so that they do not linger
+// beside their replacements. Failed pods of a rollout under verification are
+// kept until it is decided, as they count against it. The deleted pods are
+// marked as terminating in state.pods so later steps leave them alone.
+func (r *PodSetReconciler) deleteReplacedFailures(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) error {
+	log := ctrllog.FromContext(ctx)
+	rollout := status.Rollout
+	now := metav1.Now()
+	for i := range state.pods {
+		pod := &state.pods[i]
+		if pod.Status.Phase != corev1.PodFailed || pod.DeletionTimestamp != nil ||
+			podFailureAction(podSet, pod) != podsetv1alpha1.ReplacePodFailureAction {
+			continue
+		}
+		if rollout != nil && rollout.ObservationStartTime != nil && pod.Labels[templateHashLabel] == rollout.TemplateHash {
+			continue
+		}
+		log.Info("Deleting failed pod", "pod.name", pod.Name)
+		if err := r.Delete(ctx, pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+			r.podDeleteFailed(podSet, pod, err)
+			return err
+		}
+		r.podDeleted(podSet, state, pod, podsetv1alpha1.FailedPodCleanupDeletion)
+		pod.DeletionTimestamp = &now
+	}
+	return nil
+}
+
+// podFailureAction returns what to do with a failed pod: the action of the
+// first pod failure policy rule it matches, or without a pod failure policy,
+// the action of spec.failurePolicy.
+func podFailureAction(podSet *podsetv1alpha1.PodSet, pod *corev1.Pod) podsetv1alpha1.PodFailureAction {
+	policy := podSet.Spec.PodFailurePolicy
+	if policy == nil {
+		if podSet.Spec.FailurePolicy == podsetv1alpha1.HaltFailurePolicy {
+			return podsetv1alpha1.HaltPodFailureAction
+		}
+		return podsetv1alpha1.ReplacePodFailureAction
+	}
+	for _, rule := range policy.Rules {
+		if podFailureRuleMatches(&rule, pod) {
+			return rule.Action
+		}
+	}
+	if policy.DefaultAction == "" {
+		return podsetv1alpha1.ReplacePodFailureAction
+	}
+	return policy.DefaultAction
+}
+
+// podFailureRuleMatches reports whether the failed pod matches each of the
+// rule's criteria. A rule without criteria matches every pod.
+func podFailureRuleMatches(rule *podsetv1alpha1.PodFailurePolicyRule, pod *corev1.Pod) bool {
+	if len(rule.ExitCodes) > 0 && !hasExitCode(pod, rule.ContainerName, rule.ExitCodes) {
+		return false
+	}
+	if len(rule.Reasons) > 0 && !hasFailureReason(pod, rule.Reasons) {
+		return false
+	}
+	return true
+}
+
+// hasExitCode reports whether a container of the pod, or the named container
+// only, last terminated with one of the exit codes.
+func hasExitCode(pod *corev1.Pod, containerName string, codes []int32) bool {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if containerName != "" && cs.Name != containerName {
+			continue
+		}
+		terminated := cs.State.Terminated
+		if terminated == nil {
+			terminated = cs.LastTerminationState.Terminated
+		}
+		if terminated == nil {
+			continue
+		}
+		for _, code := range codes {
+			if terminated.ExitCode == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasFailureReason reports whether the pod's status reason, or the reason of
+// one of its conditions, is among reasons.
+func hasFailureReason(pod *corev1.Pod, reasons []string) bool {
+	for _, reason := range reasons {
+		if pod.Status.Reason == reason {
+			return true
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Reason == reason {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clearDegraded marks the Degraded condition False if it is currently True
+// for the given reason, leaving Degraded conditions raised for other reasons
+// alone.
+func clearDegraded(status *podsetv1alpha1.PodSetStatus, reason string, generation int64) {
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != reason {
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonAsExpected,
+		ObservedGeneration: generation,
+	})
+}
+
+// podFailureMessage describes why a failed pod failed, preferring the pod's
+// own reason and falling back to the first container, init containers
+// first, that terminated with an error.
+func podFailureMessage(pod *corev1.Pod) string {
+	if pod.Status.Reason != "" || pod.Status.Message != "" {
+		return fmt.Sprintf("pod %s failed: %s", pod.Name, strings.TrimSpace(pod.Status.Reason+" "+pod.Status.Message))
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			return fmt.Sprintf("pod %s failed: container %s exited with code %d (%s)", pod.Name, cs.Name, t.ExitCode, t.Reason)
+		}
+	}
+	return fmt.Sprintf("pod %s failed", pod.Name)
+}
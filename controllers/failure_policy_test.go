@@ -0,0 +1,216 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func failedTestPod(name, hash string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{templateHashLabel: hash}},
+		Status:     corev1.PodStatus{Phase: corev1.PodFailed},
+	}
+}
+
+func podExists(t *testing.T, r *PodSetReconciler, name string) bool {
+	t.Helper()
+	err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, &corev1.Pod{})
+	if err != nil && !errors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestDeleteReplacedFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    podsetv1alpha1.PodSetSpec
+		rollout *podsetv1alpha1.RolloutStatus
+		deleted bool
+	}{
+		{name: "Replace", spec: podsetv1alpha1.PodSetSpec{FailurePolicy: podsetv1alpha1.ReplaceFailurePolicy}, deleted: true},
+		{name: "Replace, Ordered", spec: podsetv1alpha1.PodSetSpec{
+			FailurePolicy:       podsetv1alpha1.ReplaceFailurePolicy,
+			PodManagementPolicy: podsetv1alpha1.OrderedPodManagement,
+		}, deleted: true},
+		{name: "Halt", spec: podsetv1alpha1.PodSetSpec{FailurePolicy: podsetv1alpha1.HaltFailurePolicy}, deleted: false},
+		{name: "Ignore rule", spec: podsetv1alpha1.PodSetSpec{PodFailurePolicy: &podsetv1alpha1.PodFailurePolicy{
+			Rules: []podsetv1alpha1.PodFailurePolicyRule{{Action: podsetv1alpha1.IgnorePodFailureAction}},
+		}}, deleted: false},
+		{name: "Replace, rollout under verification", spec: podsetv1alpha1.PodSetSpec{FailurePolicy: podsetv1alpha1.ReplaceFailurePolicy},
+			rollout: &podsetv1alpha1.RolloutStatus{TemplateHash: "new", ObservationStartTime: &metav1.Time{}}, deleted: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := failedTestPod("web-0", "new")
+			r := newTestReconciler(t, pod)
+			podSet := &podsetv1alpha1.PodSet{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Spec: tc.spec}
+			state := &podSetState{pods: []corev1.Pod{*pod}}
+			status := &podsetv1alpha1.PodSetStatus{Rollout: tc.rollout}
+
+			if err := r.deleteReplacedFailures(context.Background(), podSet, status, state); err != nil {
+				t.Fatal(err)
+			}
+			if exists := podExists(t, r, "web-0"); exists == tc.deleted {
+				t.Errorf("failed pod exists = %v, want %v", exists, !tc.deleted)
+			}
+			if marked := state.pods[0].DeletionTimestamp != nil; marked != tc.deleted {
+				t.Errorf("pod marked as terminating in state = %v, want %v", marked, tc.deleted)
+			}
+			if tc.deleted && (len(state.deleted) != 1 || state.deleted[0].Reason != podsetv1alpha1.FailedPodCleanupDeletion) {
+				t.Errorf("recorded deletions = %+v, want one %s", state.deleted, podsetv1alpha1.FailedPodCleanupDeletion)
+			}
+		})
+	}
+}
+
+func TestApplyFailurePolicyHaltAndResume(t *testing.T) {
+	pod := failedTestPod("web-0", "old")
+	r := newTestReconciler(t, pod)
+	podSet := testPodSet(1)
+	podSet.Spec.FailurePolicy = podsetv1alpha1.HaltFailurePolicy
+	status := &podsetv1alpha1.PodSetStatus{}
+	ctx := context.Background()
+
+	halted, _, err := r.applyFailurePolicy(ctx, podSet, status, []corev1.Pod{*pod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if !halted || cond == nil || cond.Reason != reasonFailurePolicyHalt {
+		t.Fatalf("halted = %v with Degraded %+v, want halted with reason %s", halted, cond, reasonFailurePolicyHalt)
+	}
+
+	// Still halted while the spec is unchanged.
+	if halted, _, err = r.applyFailurePolicy(ctx, podSet, status, []corev1.Pod{*pod}); err != nil || !halted {
+		t.Fatalf("halted = %v, %v on the next reconcile, want still halted", halted, err)
+	}
+
+	// Editing the spec resumes, and acknowledges the failure on the pod.
+	podSet.Generation++
+	if halted, _, err = r.applyFailurePolicy(ctx, podSet, status, []corev1.Pod{*pod}); err != nil || halted {
+		t.Fatalf("halted = %v, %v after a spec edit, want resumed", halted, err)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded); cond != nil && cond.Status == metav1.ConditionTrue {
+		t.Errorf("Degraded = %+v after resuming, want it cleared", cond)
+	}
+	acknowledged := &corev1.Pod{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pod), acknowledged); err != nil {
+		t.Fatal(err)
+	}
+	if acknowledged.Annotations[failureAcknowledgedAnnotation] != "true" {
+		t.Fatalf("failed pod annotations = %v, want the failure acknowledged", acknowledged.Annotations)
+	}
+	if halted, _, err = r.applyFailurePolicy(ctx, podSet, status, []corev1.Pod{*acknowledged}); err != nil || halted {
+		t.Errorf("halted = %v, %v by an acknowledged failure, want not halted", halted, err)
+	}
+}
+
+func TestPodFailureAction(t *testing.T) {
+	pod := failedTestPod("web-0", "new")
+	podSet := testPodSet(1)
+	if action := podFailureAction(podSet, pod); action != podsetv1alpha1.ReplacePodFailureAction {
+		t.Errorf("default action = %s, want %s", action, podsetv1alpha1.ReplacePodFailureAction)
+	}
+	podSet.Spec.FailurePolicy = podsetv1alpha1.HaltFailurePolicy
+	if action := podFailureAction(podSet, pod); action != podsetv1alpha1.HaltPodFailureAction {
+		t.Errorf("Halt policy action = %s, want %s", action, podsetv1alpha1.HaltPodFailureAction)
+	}
+}
+
+// exitedTestPod returns a failed pod whose container app terminated with the
+// exit code, and which failed for reason.
+func exitedTestPod(name string, exitCode int32, reason string) *corev1.Pod {
+	pod := failedTestPod(name, "new")
+	pod.Status.Reason = reason
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "sidecar", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}},
+		{Name: "app", LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode}}},
+	}
+	return pod
+}
+
+func TestPodFailureRules(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.PodFailurePolicy = &podsetv1alpha1.PodFailurePolicy{
+		Rules: []podsetv1alpha1.PodFailurePolicyRule{
+			{Action: podsetv1alpha1.IgnorePodFailureAction, ContainerName: "app", ExitCodes: []int32{0, 42}},
+			{Action: podsetv1alpha1.HaltPodFailureAction, Reasons: []string{"Evicted"}, ExitCodes: []int32{137}},
+			{Action: podsetv1alpha1.ReplacePodFailureAction, Reasons: []string{"DeadlineExceeded"}},
+		},
+		DefaultAction: podsetv1alpha1.HaltPodFailureAction,
+	}
+	for _, tc := range []struct {
+		name string
+		pod  *corev1.Pod
+		want podsetv1alpha1.PodFailureAction
+	}{
+		{"exit code of the named container", exitedTestPod("web-0", 42, ""), podsetv1alpha1.IgnorePodFailureAction},
+		{"exit code of another container", exitedTestPod("web-0", 1, ""), podsetv1alpha1.HaltPodFailureAction},
+		{"every criterion", exitedTestPod("web-0", 137, "Evicted"), podsetv1alpha1.HaltPodFailureAction},
+		{"reason only", exitedTestPod("web-0", 137, "DeadlineExceeded"), podsetv1alpha1.ReplacePodFailureAction},
+		{"no rule", exitedTestPod("web-0", 1, "OOMKilled"), podsetv1alpha1.HaltPodFailureAction},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if action := podFailureAction(podSet, tc.pod); action != tc.want {
+				t.Errorf("action = %s, want %s", action, tc.want)
+			}
+		})
+	}
+
+	// A condition's reason matches as the pod's own does.
+	pod := exitedTestPod("web-0", 1, "")
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Reason: "DeadlineExceeded"}}
+	if action := podFailureAction(podSet, pod); action != podsetv1alpha1.ReplacePodFailureAction {
+		t.Errorf("action for a condition reason = %s, want %s", action, podsetv1alpha1.ReplacePodFailureAction)
+	}
+}
+
+func TestApplyFailurePolicyIgnores(t *testing.T) {
+	podSet := testPodSet(2)
+	podSet.Spec.PodFailurePolicy = &podsetv1alpha1.PodFailurePolicy{
+		Rules:         []podsetv1alpha1.PodFailurePolicyRule{{Action: podsetv1alpha1.IgnorePodFailureAction, ExitCodes: []int32{42}}},
+		DefaultAction: podsetv1alpha1.HaltPodFailureAction,
+	}
+	r := newTestReconciler(t, podSet)
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	halted, ignored, err := r.applyFailurePolicy(context.Background(), podSet, status, []corev1.Pod{*exitedTestPod("web-0", 42, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if halted || len(ignored) != 1 {
+		t.Errorf("halted = %v with %d ignored, want the pod ignored without halting", halted, len(ignored))
+	}
+
+	halted, _, err = r.applyFailurePolicy(context.Background(), podSet, status, []corev1.Pod{*exitedTestPod("web-1", 1, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !halted || !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionDegraded) {
+		t.Errorf("halted = %v with conditions %+v, want the default action to halt", halted, status.Conditions)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// podSetFinalizer holds a deleted PodSet until the controller has cleaned
+	// up what garbage collection cannot.
+	podSetFinalizer = "podset.example.com/finalizer"
+
+	reasonDeletionProtected = "DeletionProtected"
+)
+
+// needsFinalizer reports whether deleting the PodSet requires cleanup beyond
+// garbage collection of owned objects, or must be held back.
+func needsFinalizer(podSet *podsetv1alpha1.PodSet) bool {
+	return isCrossNamespace(podSet) || podSet.IsDeletionProtected() || podSet.Spec.DeletionDrain != nil ||
+		podSet.Spec.Cleanup != nil || retainsClaimsWhenDeleted(podSet)
+}
+
+// finalize cleans up after a deleted PodSet and then removes its finalizer.
+// Objects outside the PodSet's namespace are found by their owner label and
+// deleted; the finalizer stays until all such pods are gone. With
+// spec.deletionDrain set, all of the pods are first deleted at the configured
+// pace. Once the pods are gone, spec.cleanup is run. A PodSet that is still
+// deletion-protected, which the webhook would have refused to delete, is
+// left terminating with its pods untouched until the annotation is removed.
+func (r *PodSetReconciler) finalize(ctx context.Context, podSet *podsetv1alpha1.PodSet) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(podSet, podSetFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if podSet.IsDeletionProtected() {
+		message := fmt.Sprintf("PodSet is deletion-protected; remove the %s annotation to let the deletion finish", podsetv1alpha1.DeletionProtectedAnnotation)
+		if !meta.IsStatusConditionTrue(podSet.Status.Conditions, podsetv1alpha1.ConditionDeletionBlocked) {
+			log.Info("Refusing to finalize deletion-protected PodSet")
+			r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonDeletionProtected, message)
+			patch := client.MergeFrom(podSet.DeepCopy())
+			meta.SetStatusCondition(&podSet.Status.Conditions, metav1.Condition{
+				Type:               podsetv1alpha1.ConditionDeletionBlocked,
+				Status:             metav1.ConditionTrue,
+				Reason:             reasonDeletionProtected,
+				Message:            message,
+				ObservedGeneration: podSet.Generation,
+			})
+			return ctrl.Result{}, r.Status().Patch(ctx, podSet, patch)
+		}
+		return ctrl.Result{}, nil
+	}
+	if meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDeletionBlocked) != nil {
+		patch := client.MergeFrom(podSet.DeepCopy())
+		meta.RemoveStatusCondition(&podSet.Status.Conditions, podsetv1alpha1.ConditionDeletionBlocked)
+		if err := r.Status().Patch(ctx, podSet, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if drains(podSet) {
+		if pending, result, err := r.drain(ctx, podSet); err != nil || pending {
+			return result, err
+		}
+	}
+
+	owned := client.MatchingLabels{ownerUIDLabel: string(podSet.UID)}
+	// Pods of an ObserveOnly PodSet belong to whatever manages them.
+	if !isObserveOnly(podSet) {
+		pods := &corev1.PodList{}
+		if err := r.List(ctx, pods, owned); err != nil {
+			return ctrl.Result{}, err
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			log.Info("Deleting pod of deleted PodSet", "pod.namespace", pod.Namespace, "pod.name", pod.Name)
+			if err := r.Delete(ctx, pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+		}
+		if len(pods.Items) > 0 {
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+	}
+
+	sas := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, sas, owned); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range sas.Items {
+		if err := r.Delete(ctx, &sas.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, owned); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range services.Items {
+		if err := r.Delete(ctx, &services.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+
+	pdbs := &policyv1.PodDisruptionBudgetList{}
+	if err := r.List(ctx, pdbs, owned); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range pdbs.Items {
+		if err := r.Delete(ctx, &pdbs.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+
+	policies := &networkingv1.NetworkPolicyList{}
+	if err := r.List(ctx, policies, owned); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range policies.Items {
+		if err := r.Delete(ctx, &policies.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.deletePodMonitors(ctx, owned); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if retainsClaimsWhenDeleted(podSet) {
+		if err := r.releaseClaims(ctx, podSet); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		claims := &corev1.PersistentVolumeClaimList{}
+		if err := r.List(ctx, claims, owned, client.HasLabels{claimPodLabel}); err != nil {
+			return ctrl.Result{}, err
+		}
+		for i := range claims.Items {
+			if err := r.Delete(ctx, &claims.Items[i]); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	if err := r.runCleanup(ctx, podSet); err != nil {
+		log.Error(err, "Failed to clean up deleted PodSet")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.updatePodSet(ctx, podSet, func(podSet *podsetv1alpha1.PodSet) error {
+		controllerutil.RemoveFinalizer(podSet, podSetFinalizer)
+		return nil
+	})
+}
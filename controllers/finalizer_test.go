@@ -0,0 +1,69 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestReconcileHoldsDeletionProtectedPodSet(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Annotations = map[string]string{podsetv1alpha1.DeletionProtectedAnnotation: "true"}
+	r := newTestReconciler(t, podSet)
+	ctx := context.Background()
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(podSet, podSetFinalizer) {
+		t.Fatalf("finalizers = %v, want %s on a protected PodSet", podSet.Finalizers, podSetFinalizer)
+	}
+
+	if err := r.Delete(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	podSet, err = reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDeletionBlocked)
+	if cond == nil || cond.Reason != reasonDeletionProtected || !controllerutil.ContainsFinalizer(podSet, podSetFinalizer) {
+		t.Fatalf("DeletionBlocked = %+v with finalizers %v, want the deletion held", cond, podSet.Finalizers)
+	}
+
+	delete(podSet.Annotations, podsetv1alpha1.DeletionProtectedAnnotation)
+	if err := r.Update(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	key := client.ObjectKeyFromObject(podSet)
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, &podsetv1alpha1.PodSet{}); !errors.IsNotFound(err) {
+		t.Errorf("get after the annotation was removed = %v, want the PodSet gone", err)
+	}
+}
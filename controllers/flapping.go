@@ -0,0 +1,143 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	defaultFlapWindow    = time.Hour
+	defaultFlapThreshold = 6
+
+	reasonFlapping = "Flapping"
+)
+
+// flapHistory is what is remembered of a PodSet's desired count to detect
+// flapping.
+type flapHistory struct {
+	desired int32
+	// direction is 1 or -1 for the direction of the last change of the
+	// desired count, or 0 before the first.
+	direction int
+	// changes are the times the direction changed, oldest first.
+	changes []time.Time
+}
+
+// flapTracker holds the flapHistory of each PodSet.
+type flapTracker struct {
+	mu      sync.Mutex
+	podSets map[types.NamespacedName]*flapHistory
+}
+
+// forget drops the history of the PodSet once it is gone.
+func (t *flapTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.podSets, key)
+}
+
+// observe records the PodSet's desired count at now and returns the changes
+// of direction within window, oldest first.
+func (t *flapTracker) observe(key types.NamespacedName, desired int32, now time.Time, window time.Duration) []time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.podSets == nil {
+		t.podSets = map[types.NamespacedName]*flapHistory{}
+	}
+	history, ok := t.podSets[key]
+	if !ok {
+		t.podSets[key] = &flapHistory{desired: desired}
+		return nil
+	}
+	if desired != history.desired {
+		direction := 1
+		if desired < history.desired {
+			direction = -1
+		}
+		// The first change sets a direction; only reversals count.
+		if history.direction != 0 && direction != history.direction {
+			history.changes = append(history.changes, now)
+		}
+		history.direction = direction
+		history.desired = desired
+	}
+	for len(history.changes) > 0 && now.Sub(history.changes[0]) > window {
+		history.changes = history.changes[1:]
+	}
+	return append([]time.Time(nil), history.changes...)
+}
+
+// checkFlapping counts the recent reversals of the PodSet's scale direction
+// and records in the Flapping condition of status whether they exceed the
+// operator's threshold. While the PodSet flaps, and FlapStabilization is set,
+// scale-downs are held off until the direction has been stable for that
+// long.
+func (r *PodSetReconciler) checkFlapping(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) {
+	log := ctrllog.FromContext(ctx)
+	window := r.FlapWindow
+	if window <= 0 {
+		window = defaultFlapWindow
+	}
+	threshold := r.FlapThreshold
+	if threshold <= 0 {
+		threshold = defaultFlapThreshold
+	}
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}
+	changes := r.flaps.observe(key, state.desired, time.Now(), window)
+
+	if len(changes) <= threshold {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionFlapping,
+			Status:             metav1.ConditionFalse,
+			Reason:             "Stable",
+			Message:            fmt.Sprintf("%d scale direction changes in the last %s", len(changes), window),
+			ObservedGeneration: podSet.Generation,
+		})
+		return
+	}
+	message := fmt.Sprintf("%d scale direction changes in the last %s, more than %d", len(changes), window, threshold)
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionFlapping) {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonFlapping, message)
+		podSetFlapping.WithLabelValues(podSet.Namespace, podSet.Name).Inc()
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionFlapping,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonFlapping,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+
+	stable := time.Since(changes[len(changes)-1])
+	if r.FlapStabilization > 0 && stable < r.FlapStabilization && int(state.desired) < len(state.available) {
+		log.Info("Holding off scale-down of flapping PodSet", "Stable for", stable, "Stabilization", r.FlapStabilization)
+		state.desired = int32(len(state.available))
+		state.flapHold = r.FlapStabilization - stable
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestFlapTrackerCountsReversals(t *testing.T) {
+	var tracker flapTracker
+	key := types.NamespacedName{Namespace: "default", Name: "web"}
+	start := time.Now()
+
+	// Scaling up twice sets a direction without reversing it.
+	for i, desired := range []int32{1, 2, 3} {
+		if changes := tracker.observe(key, desired, start.Add(time.Duration(i)*time.Minute), time.Hour); len(changes) != 0 {
+			t.Fatalf("changes = %v after scaling up to %d, want none", changes, desired)
+		}
+	}
+	tracker.observe(key, 1, start.Add(3*time.Minute), time.Hour)
+	tracker.observe(key, 1, start.Add(4*time.Minute), time.Hour)
+	if changes := tracker.observe(key, 4, start.Add(5*time.Minute), time.Hour); len(changes) != 2 {
+		t.Errorf("changes = %v after scaling down then up, want 2 reversals", changes)
+	}
+	// Reversals age out of the window.
+	if changes := tracker.observe(key, 4, start.Add(64*time.Minute), time.Hour); len(changes) != 1 {
+		t.Errorf("changes = %v an hour after the first reversal, want 1", changes)
+	}
+
+	tracker.forget(key)
+	if changes := tracker.observe(key, 1, start.Add(65*time.Minute), time.Hour); len(changes) != 0 {
+		t.Errorf("changes = %v after forgetting the PodSet, want none", changes)
+	}
+}
+
+func TestCheckFlappingHoldsScaleDown(t *testing.T) {
+	podSet := testPodSet(1)
+	r := newTestReconciler(t, podSet)
+	r.FlapThreshold = 2
+	r.FlapStabilization = time.Minute
+	status := &podsetv1alpha1.PodSetStatus{}
+	pods := rolloutTestPods("hash", "web-a", "web-b", "web-c")
+
+	var state *podSetState
+	for _, desired := range []int32{1, 3, 1, 3, 1} {
+		state = &podSetState{available: pods, desired: desired}
+		r.checkFlapping(context.Background(), podSet, status, state)
+	}
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionFlapping) {
+		t.Fatalf("conditions = %+v after 3 reversals, want Flapping", status.Conditions)
+	}
+	if state.desired != 3 || state.flapHold <= 0 || state.flapHold > time.Minute {
+		t.Errorf("desired = %d with hold %s, want the scale-down to 1 held at 3 for up to a minute", state.desired, state.flapHold)
+	}
+}
+
+func TestCheckFlappingStable(t *testing.T) {
+	podSet := testPodSet(1)
+	r := newTestReconciler(t, podSet)
+	r.FlapThreshold = 2
+	r.FlapStabilization = time.Minute
+	status := &podsetv1alpha1.PodSetStatus{}
+	pods := rolloutTestPods("hash", "web-a", "web-b", "web-c")
+
+	var state *podSetState
+	for _, desired := range []int32{3, 2, 1} {
+		state = &podSetState{available: pods, desired: desired}
+		r.checkFlapping(context.Background(), podSet, status, state)
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionFlapping)
+	if cond == nil || cond.Reason != "Stable" {
+		t.Errorf("condition = %+v, want Stable", cond)
+	}
+	if state.desired != 1 || state.flapHold != 0 {
+		t.Errorf("desired = %d with hold %s, want the scale-down to 1 let through", state.desired, state.flapHold)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// hostPortAnnotation records the host port assigned to a pod.
+	hostPortAnnotation = "podset.example.com/host-port"
+
+	hostPortEnv      = "HOST_PORT"
+	hostPortPortName = "host-port"
+)
+
+// podHostPort returns the host port assigned to the pod, or zero if it has
+// none.
+func podHostPort(pod *corev1.Pod) int32 {
+	port, err := strconv.ParseInt(pod.Annotations[hostPortAnnotation], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(port)
+}
+
+// checkHostPorts returns the ports of spec.hostPortRange not held by any of
+// the PodSet's pods, and records in the HostPortsExhausted condition of
+// status whether there are enough of them for the missing pods. Pods that are
+// being deleted keep their port until they are gone; Failed and Succeeded
+// pods release it.
+func checkHostPorts(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) []int32 {
+	portRange := podSet.Spec.HostPortRange
+	if portRange == nil {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionHostPortsExhausted)
+		return nil
+	}
+
+	used := map[int32]bool{}
+	for i := range state.pods {
+		pod := &state.pods[i]
+		if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		used[podHostPort(pod)] = true
+	}
+	var free []int32
+	for port := portRange.Start; port <= portRange.End; port++ {
+		if !used[port] {
+			free = append(free, port)
+		}
+	}
+
+	missing := int(state.desired) - len(state.available)
+	if missing > len(free) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionHostPortsExhausted,
+			Status:             metav1.ConditionTrue,
+			Reason:             "NoFreeHostPorts",
+			Message:            fmt.Sprintf("%d pods are missing but only %d host ports in %d-%d are free", missing, len(free), portRange.Start, portRange.End),
+			ObservedGeneration: podSet.Generation,
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionHostPortsExhausted,
+			Status:             metav1.ConditionFalse,
+			Reason:             "HostPortsAvailable",
+			Message:            fmt.Sprintf("%d host ports in %d-%d are free", len(free), portRange.Start, portRange.End),
+			ObservedGeneration: podSet.Generation,
+		})
+	}
+	return free
+}
+
+// assignHostPorts gives each new pod one of the free host ports, exposing it
+// on the first container and in the HOST_PORT environment variable. Pods
+// beyond the number of free ports are dropped rather than created with a
+// conflicting port.
+func assignHostPorts(podSet *podsetv1alpha1.PodSet, free []int32, pods []*corev1.Pod) []*corev1.Pod {
+	if podSet.Spec.HostPortRange == nil {
+		return pods
+	}
+	if len(pods) > len(free) {
+		pods = pods[:len(free)]
+	}
+	for i, pod := range pods {
+		port := free[i]
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[hostPortAnnotation] = strconv.Itoa(int(port))
+		containerPort := podSet.Spec.HostPortRange.ContainerPort
+		if containerPort == 0 {
+			containerPort = port
+		}
+		for j := range pod.Spec.Containers {
+			container := &pod.Spec.Containers[j]
+			if j == 0 {
+				container.Ports = append(container.Ports, corev1.ContainerPort{
+					Name:          hostPortPortName,
+					ContainerPort: containerPort,
+					HostPort:      port,
+					Protocol:      corev1.ProtocolTCP,
+				})
+			}
+			container.Env = append(container.Env, corev1.EnvVar{Name: hostPortEnv, Value: strconv.Itoa(int(port))})
+		}
+	}
+	return pods
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func hostPortTestPod(port string, phase corev1.PodPhase) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{hostPortAnnotation: port}},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestCheckHostPorts(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Spec.HostPortRange = &podsetv1alpha1.HostPortRange{Start: 8000, End: 8003}
+	terminating := hostPortTestPod("8002", corev1.PodRunning)
+	terminating.DeletionTimestamp = &metav1.Time{}
+	state := &podSetState{
+		pods: []corev1.Pod{
+			hostPortTestPod("8000", corev1.PodRunning),
+			hostPortTestPod("8001", corev1.PodFailed),
+			terminating,
+		},
+		available: []corev1.Pod{hostPortTestPod("8000", corev1.PodRunning)},
+		desired:   3,
+	}
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	free := checkHostPorts(podSet, status, state)
+	if want := []int32{8001, 8003}; !reflect.DeepEqual(free, want) {
+		t.Errorf("free ports = %v, want %v", free, want)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionHostPortsExhausted); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("HostPortsExhausted = %+v, want False", cond)
+	}
+
+	state.desired = 4
+	checkHostPorts(podSet, status, state)
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionHostPortsExhausted); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("HostPortsExhausted = %+v with 3 pods missing and 2 ports free, want True", cond)
+	}
+
+	podSet.Spec.HostPortRange = nil
+	if free := checkHostPorts(podSet, status, state); free != nil || len(status.Conditions) != 0 {
+		t.Errorf("free ports %v and conditions %v without a range, want none", free, status.Conditions)
+	}
+}
+
+func TestAssignHostPorts(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Spec.HostPortRange = &podsetv1alpha1.HostPortRange{Start: 8000, End: 8001, ContainerPort: 80}
+	var pods []*corev1.Pod
+	for i := 0; i < 3; i++ {
+		pod, err := newPodForCR(podSet, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pods = append(pods, pod)
+	}
+
+	assigned := assignHostPorts(podSet, []int32{8000, 8001}, pods)
+	if len(assigned) != 2 {
+		t.Fatalf("assigned ports to %d pods, want 2, one per free port", len(assigned))
+	}
+	pod := assigned[1]
+	if podHostPort(pod) != 8001 {
+		t.Errorf("host port annotation = %q, want 8001", pod.Annotations[hostPortAnnotation])
+	}
+	ports := pod.Spec.Containers[0].Ports
+	if len(ports) != 1 || ports[0].HostPort != 8001 || ports[0].ContainerPort != 80 {
+		t.Errorf("container ports = %+v, want host port 8001 on container port 80", ports)
+	}
+	env := pod.Spec.Containers[0].Env
+	if last := env[len(env)-1]; last.Name != hostPortEnv || last.Value != "8001" {
+		t.Errorf("env = %v, want HOST_PORT 8001", env)
+	}
+}
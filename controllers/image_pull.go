@@ -0,0 +1,82 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const reasonImagePullFailed = "ImagePullFailed"
+
+// imagePullFailures are the waiting reasons of a container whose image the
+// kubelet could not pull.
+var imagePullFailures = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// imagePullFailure describes the first container, init containers first, of
+// the pod whose image could not be pulled, or returns "".
+func imagePullFailure(pod *corev1.Pod) string {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if waiting := cs.State.Waiting; waiting != nil && imagePullFailures[waiting.Reason] {
+			return fmt.Sprintf("pod %s: container %s image %s: %s", pod.Name, cs.Name, cs.Image, waiting.Reason)
+		}
+	}
+	return ""
+}
+
+// checkImagePulls reports the pods whose images could not be pulled in the
+// Degraded condition of status, unless it is already raised for another
+// reason.
+func (r *PodSetReconciler) checkImagePulls(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, pods []corev1.Pod) {
+	var failures []string
+	for i := range pods {
+		if failure := imagePullFailure(&pods[i]); failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+	if len(failures) == 0 {
+		clearDegraded(status, reasonImagePullFailed, podSet.Generation)
+		return
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason != reasonImagePullFailed {
+		return
+	}
+	message := "Images could not be pulled: " + strings.Join(failures, "; ")
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonImagePullFailed, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonImagePullFailed,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+}
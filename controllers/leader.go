@@ -0,0 +1,132 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// roleLabel marks the pod elected leader of its PodSet.
+	roleLabel  = "podset.example.com/role"
+	roleLeader = "leader"
+)
+
+// reconcileLeader keeps the leader label on exactly one Ready pod and returns
+// its name. The current leader keeps the label while it stays Ready;
+// otherwise the oldest Ready pod is promoted. Stale labels are removed before
+// a new one is added, so at most one pod is ever labeled, at the cost of a
+// brief window with none.
+func (r *PodSetReconciler) reconcileLeader(ctx context.Context, podSet *podsetv1alpha1.PodSet, pods, available []corev1.Pod) (string, error) {
+	log := ctrllog.FromContext(ctx)
+
+	var current *corev1.Pod
+	if podSet.Spec.ElectLeader {
+		for i := range available {
+			pod := &available[i]
+			if isLeader(pod) && isPodReady(pod) && (current == nil || olderPod(pod, current)) {
+				current = pod
+			}
+		}
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if !isLeader(pod) || (current != nil && pod.Name == current.Name) {
+			continue
+		}
+		log.Info("Demoting leader pod", "pod.name", pod.Name)
+		if err := r.setLeaderLabel(ctx, pod, false); err != nil {
+			return "", err
+		}
+	}
+	if !podSet.Spec.ElectLeader {
+		return "", nil
+	}
+	if current != nil {
+		return current.Name, nil
+	}
+
+	var candidates []*corev1.Pod
+	for i := range available {
+		if isPodReady(&available[i]) {
+			candidates = append(candidates, &available[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	sort.Slice(candidates, func(i, j int) bool { return olderPod(candidates[i], candidates[j]) })
+	log.Info("Promoting leader pod", "pod.name", candidates[0].Name)
+	if err := r.setLeaderLabel(ctx, candidates[0], true); err != nil {
+		return "", err
+	}
+	return candidates[0].Name, nil
+}
+
+// setLeaderLabel adds or removes the leader label on the pod.
+func (r *PodSetReconciler) setLeaderLabel(ctx context.Context, pod *corev1.Pod, leader bool) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	if leader {
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		pod.Labels[roleLabel] = roleLeader
+	} else {
+		delete(pod.Labels, roleLabel)
+	}
+	err := r.Patch(ctx, pod, patch)
+	if errors.IsNotFound(err) && !leader {
+		return nil
+	}
+	return err
+}
+
+func isLeader(pod *corev1.Pod) bool {
+	return pod.Labels[roleLabel] == roleLeader
+}
+
+// olderPod reports whether a was created before b, breaking ties by name.
+func olderPod(a, b *corev1.Pod) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// preferNonLeader returns pods ordered for scale-down, with the leader moved
+// to the end so it is only chosen when nothing else is left.
+func preferNonLeader(pods []corev1.Pod, leader string) []corev1.Pod {
+	ordered := make([]corev1.Pod, 0, len(pods))
+	var last []corev1.Pod
+	for _, pod := range pods {
+		if leader != "" && pod.Name == leader {
+			last = append(last, pod)
+			continue
+		}
+		ordered = append(ordered, pod)
+	}
+	return append(ordered, last...)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func leaderTestPod(name string, age time.Duration, ready, leader bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            map[string]string{},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age).Truncate(time.Second)),
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if ready {
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	}
+	if leader {
+		pod.Labels[roleLabel] = roleLeader
+	}
+	return pod
+}
+
+func leaderLabeled(t *testing.T, r *PodSetReconciler, name string) bool {
+	t.Helper()
+	pod := &corev1.Pod{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, pod); err != nil {
+		t.Fatal(err)
+	}
+	return isLeader(pod)
+}
+
+func TestReconcileLeader(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		pods       []*corev1.Pod
+		elect      bool
+		wantLeader string
+	}{
+		{
+			name: "promotes the oldest ready pod",
+			pods: []*corev1.Pod{
+				leaderTestPod("young", time.Minute, true, false),
+				leaderTestPod("old", time.Hour, true, false),
+				leaderTestPod("oldest-unready", 2*time.Hour, false, false),
+			},
+			elect:      true,
+			wantLeader: "old",
+		},
+		{
+			name: "keeps a ready leader",
+			pods: []*corev1.Pod{
+				leaderTestPod("young", time.Minute, true, true),
+				leaderTestPod("old", time.Hour, true, false),
+			},
+			elect:      true,
+			wantLeader: "young",
+		},
+		{
+			name: "replaces an unready leader",
+			pods: []*corev1.Pod{
+				leaderTestPod("young", time.Minute, true, false),
+				leaderTestPod("old", time.Hour, false, true),
+			},
+			elect:      true,
+			wantLeader: "young",
+		},
+		{
+			name: "demotes when election is off",
+			pods: []*corev1.Pod{
+				leaderTestPod("old", time.Hour, true, true),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			podSet := testPodSet(int32(len(tc.pods)))
+			podSet.Spec.ElectLeader = tc.elect
+			var objs []client.Object
+			var pods []corev1.Pod
+			for _, pod := range tc.pods {
+				objs = append(objs, pod)
+				pods = append(pods, *pod)
+			}
+			r := newTestReconciler(t, objs...)
+
+			leader, err := r.reconcileLeader(context.Background(), podSet, pods, pods)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if leader != tc.wantLeader {
+				t.Errorf("leader = %q, want %q", leader, tc.wantLeader)
+			}
+			for _, pod := range tc.pods {
+				if labeled := leaderLabeled(t, r, pod.Name); labeled != (pod.Name == tc.wantLeader) {
+					t.Errorf("pod %s has leader label = %v, want %v", pod.Name, labeled, !labeled)
+				}
+			}
+		})
+	}
+}
+
+func TestPreferNonLeader(t *testing.T) {
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c"}},
+	}
+	ordered := preferNonLeader(pods, "a")
+	if ordered[0].Name != "b" || ordered[1].Name != "c" || ordered[2].Name != "a" {
+		t.Errorf("order = %s %s %s, want the leader a last", ordered[0].Name, ordered[1].Name, ordered[2].Name)
+	}
+}
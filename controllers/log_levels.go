@@ -0,0 +1,135 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// LogLevels holds the operator's log level, which can be changed while it
+// runs, and verbosity overrides for the reconciles of single namespaces or
+// PodSets.
+type LogLevels struct {
+	// Level is the level of the operator's logger.
+	Level zap.AtomicLevel
+
+	// NewLogger builds a logger like the operator's, logging at the given
+	// level. It is used for the reconciles of overridden PodSets.
+	NewLogger func(level zapcore.LevelEnabler) logr.Logger
+
+	mu sync.Mutex
+	// overrides maps a namespace, or a namespace/name of a PodSet, to the
+	// level of its reconciles.
+	overrides map[string]zapcore.Level
+	loggers   map[zapcore.Level]logr.Logger
+}
+
+// reconcileContext returns ctx with the logger of a reconcile of the
+// PodSet at its override level, if it has one. An override for the PodSet
+// wins over one for its namespace.
+func (l *LogLevels) reconcileContext(ctx context.Context, req ctrl.Request) context.Context {
+	if l == nil || l.NewLogger == nil {
+		return ctx
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	level, ok := l.overrides[req.NamespacedName.String()]
+	if !ok {
+		level, ok = l.overrides[req.Namespace]
+	}
+	if !ok {
+		return ctx
+	}
+	if l.loggers == nil {
+		l.loggers = map[zapcore.Level]logr.Logger{}
+	}
+	logger, ok := l.loggers[level]
+	if !ok {
+		logger = l.NewLogger(level)
+		l.loggers[level] = logger
+	}
+	log := logger.WithName("controller").WithName("podset").WithValues("PodSet", req.NamespacedName)
+	return ctrllog.IntoContext(ctx, log)
+}
+
+// parseLogLevel parses a level name, such as debug, or a positive logr
+// verbosity, as the --zap-log-level flag does.
+func parseLogLevel(value string) (zapcore.Level, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(value)); err == nil {
+		return level, nil
+	}
+	verbosity, err := strconv.Atoi(value)
+	if err != nil || verbosity <= 0 || verbosity > 127 {
+		return 0, fmt.Errorf("invalid log level %q", value)
+	}
+	return zapcore.Level(-verbosity), nil
+}
+
+// ServeOverrides serves the verbosity overrides as a JSON object that maps
+// namespaces and namespace/name keys to levels. GET returns them and PUT
+// replaces them.
+func (l *LogLevels) ServeOverrides(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var values map[string]string
+		if err := json.NewDecoder(req.Body).Decode(&values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		overrides := map[string]zapcore.Level{}
+		for key, value := range values {
+			if key == "" || strings.Count(key, "/") > 1 {
+				http.Error(w, fmt.Sprintf("invalid key %q, expected a namespace or namespace/name", key), http.StatusBadRequest)
+				return
+			}
+			level, err := parseLogLevel(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			overrides[key] = level
+		}
+		l.mu.Lock()
+		l.overrides = overrides
+		l.mu.Unlock()
+	default:
+		http.Error(w, "only GET and PUT are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	l.mu.Lock()
+	values := map[string]string{}
+	for key, level := range l.overrides {
+		values[key] = level.String()
+	}
+	l.mu.Unlock()
+	writeJSON(w, values)
+}
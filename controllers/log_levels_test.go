@@ -0,0 +1,119 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  zapcore.Level
+		valid bool
+	}{
+		{"debug", zapcore.DebugLevel, true},
+		{"error", zapcore.ErrorLevel, true},
+		{"3", zapcore.Level(-3), true},
+		{"0", 0, false},
+		{"128", 0, false},
+		{"loud", 0, false},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			level, err := parseLogLevel(tc.value)
+			if valid := err == nil; valid != tc.valid || level != tc.want {
+				t.Errorf("parseLogLevel(%q) = %v, %v, want %v (valid %v)", tc.value, level, err, tc.want, tc.valid)
+			}
+		})
+	}
+}
+
+func TestLogLevelsReconcileContext(t *testing.T) {
+	var built []zapcore.Level
+	levels := &LogLevels{NewLogger: func(level zapcore.LevelEnabler) logr.Logger {
+		built = append(built, level.(zapcore.Level))
+		return logr.Discard()
+	}}
+	levels.overrides = map[string]zapcore.Level{"default": zapcore.InfoLevel, "default/web": zapcore.DebugLevel}
+	ctx := context.Background()
+
+	for _, req := range []ctrl.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}},
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "api"}},
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}},
+	} {
+		if levels.reconcileContext(ctx, req) == ctx {
+			t.Errorf("%s reconciles without its override", req)
+		}
+	}
+	// Loggers are built once per level, the PodSet's override first.
+	if want := []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel}; !reflect.DeepEqual(built, want) {
+		t.Errorf("built loggers at %v, want %v", built, want)
+	}
+	if levels.reconcileContext(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "other", Name: "web"}}) != ctx {
+		t.Error("PodSet without an override reconciles with another logger")
+	}
+}
+
+func TestDebugServerLogLevels(t *testing.T) {
+	levels := &LogLevels{Level: zap.NewAtomicLevelAt(zapcore.InfoLevel)}
+	server := httptest.NewServer((&DebugServer{LogLevels: levels}).Handler())
+	defer server.Close()
+
+	put := func(path, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPut, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := put("/debug/loglevel", `{"level": "debug"}`); code != http.StatusOK || levels.Level.Level() != zapcore.DebugLevel {
+		t.Errorf("PUT level = %d, level %s, want debug", code, levels.Level.Level())
+	}
+	if code := put("/debug/loglevel/overrides", `{"default/web": "debug", "kube-system": "2"}`); code != http.StatusOK {
+		t.Errorf("PUT overrides = %d, want %d", code, http.StatusOK)
+	}
+	if want := map[string]zapcore.Level{"default/web": zapcore.DebugLevel, "kube-system": zapcore.Level(-2)}; !reflect.DeepEqual(levels.overrides, want) {
+		t.Errorf("overrides = %v, want %v", levels.overrides, want)
+	}
+	for _, body := range []string{`{"a/b/c": "debug"}`, `{"default": "loud"}`, `not json`} {
+		if code := put("/debug/loglevel/overrides", body); code != http.StatusBadRequest {
+			t.Errorf("PUT overrides %s = %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+	if len(levels.overrides) != 2 {
+		t.Errorf("overrides = %v after rejected updates, want them unchanged", levels.overrides)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// isObserveOnly reports whether the controller must leave the PodSet's pods
+// alone.
+func isObserveOnly(podSet *podsetv1alpha1.PodSet) bool {
+	return podSet.Spec.ManagementPolicy == podsetv1alpha1.ObserveOnlyManagementPolicy
+}
+
+// isPaused reports whether spec.paused holds the PodSet's pods as they are.
+func isPaused(podSet *podsetv1alpha1.PodSet) bool {
+	return podSet.Spec.Paused
+}
+
+// checkManagementPolicy records in the ObserveOnly and Paused conditions of
+// status whether the controller only observes the PodSet's pods, and reports
+// it.
+func checkManagementPolicy(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) bool {
+	if !isPaused(podSet) {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionPaused)
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionPaused,
+			Status:             metav1.ConditionTrue,
+			Reason:             "SpecPaused",
+			Message:            "spec.paused is set; the controller does not change the pods",
+			ObservedGeneration: podSet.Generation,
+		})
+	}
+	if !isObserveOnly(podSet) {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionObserveOnly)
+		return isPaused(podSet)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionObserveOnly,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ManagementPolicyObserveOnly",
+		Message:            "Pods are managed externally; the controller only reports on them",
+		ObservedGeneration: podSet.Generation,
+	})
+	return true
+}
+
+// observedLeader returns the oldest available pod that already carries the
+// leader label, without electing one.
+func observedLeader(available []corev1.Pod) string {
+	var leader *corev1.Pod
+	for i := range available {
+		pod := &available[i]
+		if isLeader(pod) && (leader == nil || olderPod(pod, leader)) {
+			leader = pod
+		}
+	}
+	if leader == nil {
+		return ""
+	}
+	return leader.Name
+}
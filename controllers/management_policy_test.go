@@ -0,0 +1,71 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestReconcileObserveOnly(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Spec.ManagementPolicy = podsetv1alpha1.ObserveOnlyManagementPolicy
+	// Created by something else, carrying the PodSet's labels but no owner.
+	external := leaderTestPod("external", time.Hour, true, true)
+	for key, value := range labelsForPodSet(podSet) {
+		external.Labels[key] = value
+	}
+	r := newTestReconciler(t, podSet, external)
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(context.Background(), pods); err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 {
+		t.Errorf("%d pods exist, want only the external one", len(pods.Items))
+	}
+	status := podSet.Status
+	if status.Replicas != 1 || status.ReadyReplicas != 1 || status.Leader != "external" {
+		t.Errorf("status has %d replicas, %d ready and leader %q, want the external pod reported", status.Replicas, status.ReadyReplicas, status.Leader)
+	}
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionObserveOnly) {
+		t.Errorf("conditions = %+v, want ObserveOnly", status.Conditions)
+	}
+}
+
+func TestCheckManagementPolicyClearsConditions(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.ManagementPolicy = podsetv1alpha1.ObserveOnlyManagementPolicy
+	status := &podsetv1alpha1.PodSetStatus{}
+	if !checkManagementPolicy(podSet, status) || len(status.Conditions) != 1 {
+		t.Fatalf("conditions = %+v, want ObserveOnly", status.Conditions)
+	}
+	podSet.Spec.ManagementPolicy = podsetv1alpha1.FullManagementPolicy
+	if checkManagementPolicy(podSet, status) || len(status.Conditions) != 0 {
+		t.Errorf("conditions = %+v, want none once fully managed again", status.Conditions)
+	}
+}
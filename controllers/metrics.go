@@ -0,0 +1,182 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+var (
+	podSchedulingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "podset_pod_scheduling_duration_seconds",
+		Help:    "Time from the creation of a PodSet's pod until it was scheduled.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"namespace", "name"})
+
+	podReadinessDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "podset_pod_readiness_duration_seconds",
+		Help:    "Time from a PodSet's pod being scheduled until it became Ready.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"namespace", "name"})
+
+	podCreatesThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podset_pod_creates_throttled_total",
+		Help: "Number of scale-ups of a PodSet that were cut short by the operator-wide pod create rate limit.",
+	}, []string{"namespace", "name"})
+
+	podSetFlapping = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podset_flapping_total",
+		Help: "Number of times a PodSet started flapping between scaling up and down.",
+	}, []string{"namespace", "name"})
+
+	podSetDesiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "podset_desired_replicas",
+		Help: "Number of pods the controller last aimed to run for a PodSet.",
+	}, []string{"namespace", "name"})
+
+	podSetAvailableReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "podset_available_replicas",
+		Help: "Number of pods of a PodSet that have been Ready for minReadySeconds.",
+	}, []string{"namespace", "name"})
+
+	podSetPodsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podset_pods_created_total",
+		Help: "Number of pods created for a PodSet.",
+	}, []string{"namespace", "name"})
+
+	podSetPodsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podset_pods_deleted_total",
+		Help: "Number of a PodSet's pods deleted by the controller, by the reason they were deleted.",
+	}, []string{"namespace", "name", "reason"})
+
+	podSetReconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podset_reconcile_errors_total",
+		Help: "Number of reconciles of a PodSet that failed.",
+	}, []string{"namespace", "name"})
+
+	leakedPods = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "podset_leaked_pods",
+		Help: "Number of managed pods whose PodSet no longer exists, as of the last sweep.",
+	}, []string{"namespace"})
+
+	leakedPodsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "podset_leaked_pods_deleted_total",
+		Help: "Number of managed pods deleted by the sweeper because their PodSet no longer exists.",
+	}, []string{"namespace"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(podSchedulingDuration, podReadinessDuration, podCreatesThrottled, podSetFlapping,
+		podSetDesiredReplicas, podSetAvailableReplicas, podSetPodsCreated, podSetPodsDeleted, podSetReconcileErrors,
+		leakedPods, leakedPodsDeleted)
+}
+
+// forgetPodSetMetrics deletes the metrics of a PodSet once it is gone.
+func forgetPodSetMetrics(key types.NamespacedName) {
+	podSchedulingDuration.DeleteLabelValues(key.Namespace, key.Name)
+	podReadinessDuration.DeleteLabelValues(key.Namespace, key.Name)
+	podCreatesThrottled.DeleteLabelValues(key.Namespace, key.Name)
+	podSetFlapping.DeleteLabelValues(key.Namespace, key.Name)
+	podSetDesiredReplicas.DeleteLabelValues(key.Namespace, key.Name)
+	podSetAvailableReplicas.DeleteLabelValues(key.Namespace, key.Name)
+	podSetPodsCreated.DeleteLabelValues(key.Namespace, key.Name)
+	for _, reason := range []podsetv1alpha1.PodDeletionReason{
+		podsetv1alpha1.ScaleDownDeletion,
+		podsetv1alpha1.TemplateRolloutDeletion,
+		podsetv1alpha1.DriftReplacementDeletion,
+		podsetv1alpha1.PodSetDeletedDeletion,
+	} {
+		podSetPodsDeleted.DeleteLabelValues(key.Namespace, key.Name, string(reason))
+	}
+	podSetReconcileErrors.DeleteLabelValues(key.Namespace, key.Name)
+}
+
+// latencyTracker remembers, per PodSet, the pods whose startup latencies
+// have been recorded.
+type latencyTracker struct {
+	mu       sync.Mutex
+	observed map[types.NamespacedName]map[types.UID]bool
+}
+
+// podConditionTime returns when the pod's condition of the given type last
+// became True, or nil if it is not True.
+func podConditionTime(pod *corev1.Pod, conditionType corev1.PodConditionType) *metav1.Time {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == conditionType && cond.Status == corev1.ConditionTrue {
+			return &cond.LastTransitionTime
+		}
+	}
+	return nil
+}
+
+// observePodLatencies records the scheduling and readiness latencies of the
+// PodSet's pods that became Ready since the last reconcile, and reports the
+// latest in status. Pods already Ready when a PodSet is first seen, such as
+// after a restart of the operator, are remembered without being recorded.
+func (r *PodSetReconciler) observePodLatencies(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, pods []corev1.Pod) {
+	r.latencies.mu.Lock()
+	defer r.latencies.mu.Unlock()
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}
+	previous, seen := r.latencies.observed[key]
+	observed := map[types.UID]bool{}
+	var latest *corev1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		ready := podConditionTime(pod, corev1.PodReady)
+		scheduled := podConditionTime(pod, corev1.PodScheduled)
+		if ready == nil || scheduled == nil {
+			continue
+		}
+		observed[pod.UID] = true
+		if !seen || previous[pod.UID] {
+			continue
+		}
+		podSchedulingDuration.WithLabelValues(podSet.Namespace, podSet.Name).Observe(scheduled.Sub(pod.CreationTimestamp.Time).Seconds())
+		podReadinessDuration.WithLabelValues(podSet.Namespace, podSet.Name).Observe(ready.Sub(scheduled.Time).Seconds())
+		if latest == nil || podConditionTime(latest, corev1.PodReady).Before(ready) {
+			latest = pod
+		}
+	}
+	if r.latencies.observed == nil {
+		r.latencies.observed = map[types.NamespacedName]map[types.UID]bool{}
+	}
+	r.latencies.observed[key] = observed
+
+	if latest != nil {
+		scheduled := podConditionTime(latest, corev1.PodScheduled)
+		status.PodLatency = &podsetv1alpha1.PodLatencyStatus{
+			Pod:        latest.Name,
+			Scheduling: metav1.Duration{Duration: scheduled.Sub(latest.CreationTimestamp.Time)},
+			Readiness:  metav1.Duration{Duration: podConditionTime(latest, corev1.PodReady).Sub(scheduled.Time)},
+		}
+	}
+}
+
+// forget drops what is remembered about the PodSet once it is gone.
+func (t *latencyTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.observed, key)
+}
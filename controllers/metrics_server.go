@@ -0,0 +1,157 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// SecureMetricsServer serves the metrics registry over TLS to clients that
+// present a bearer token allowed to get the /metrics path, checked with a
+// TokenReview and a SubjectAccessReview. It replaces the plaintext endpoint
+// of the manager, which must then be disabled.
+type SecureMetricsServer struct {
+	// BindAddress is the address to serve on.
+	BindAddress string
+
+	// CertDir holds the tls.crt and tls.key to serve with. They are
+	// reloaded when they change.
+	CertDir string
+
+	TokenReviews         authenticationv1client.TokenReviewsGetter
+	SubjectAccessReviews authorizationv1client.SubjectAccessReviewsGetter
+}
+
+// Start implements manager.Runnable.
+func (s *SecureMetricsServer) Start(ctx context.Context) error {
+	log := ctrllog.FromContext(ctx).WithName("metrics")
+
+	watcher, err := certwatcher.New(filepath.Join(s.CertDir, "tls.crt"), filepath.Join(s.CertDir, "tls.key"))
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := watcher.Start(ctx); err != nil {
+			log.Error(err, "Certificate watcher stopped")
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.authorize(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+	server := &http.Server{
+		Addr:              s.BindAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: watcher.GetCertificate,
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Failed to shut down the metrics server")
+		}
+	}()
+
+	log.Info("Serving metrics over TLS", "address", s.BindAddress)
+	if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that every
+// replica serves its metrics.
+func (s *SecureMetricsServer) NeedLeaderElection() bool {
+	return false
+}
+
+// authorize wraps next so that it serves only requests whose bearer token
+// authenticates as a user allowed to get the request path.
+func (s *SecureMetricsServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		log := ctrllog.FromContext(req.Context()).WithName("metrics")
+
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == req.Header.Get("Authorization") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		review, err := s.TokenReviews.TokenReviews().Create(req.Context(), &authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: token},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			log.Error(err, "Failed to review a metrics client token")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !review.Status.Authenticated {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user := review.Status.User
+		extra := map[string]authorizationv1.ExtraValue{}
+		for k, v := range user.Extra {
+			extra[k] = authorizationv1.ExtraValue(v)
+		}
+		access, err := s.SubjectAccessReviews.SubjectAccessReviews().Create(req.Context(), &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+					Path: req.URL.Path,
+					Verb: strings.ToLower(req.Method),
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			log.Error(err, "Failed to review a metrics client's access")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !access.Status.Allowed {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// fakeReviews returns a clientset that authenticates the token "valid" as
+// the user metrics-reader and allows that user to get /metrics only.
+func fakeReviews() *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "valid" {
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "metrics-reader"},
+			}
+		}
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := review.Spec.NonResourceAttributes
+		review.Status.Allowed = review.Spec.User == "metrics-reader" && attrs != nil && attrs.Path == "/metrics" && attrs.Verb == "get"
+		return true, review, nil
+	})
+	return clientset
+}
+
+func TestSecureMetricsServerAuthorize(t *testing.T) {
+	clientset := fakeReviews()
+	s := &SecureMetricsServer{TokenReviews: clientset.AuthenticationV1(), SubjectAccessReviews: clientset.AuthorizationV1()}
+	handler := s.authorize(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range []struct {
+		name          string
+		method, path  string
+		authorization string
+		want          int
+	}{
+		{"no token", http.MethodGet, "/metrics", "", http.StatusUnauthorized},
+		{"not a bearer token", http.MethodGet, "/metrics", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/metrics", "Bearer invalid", http.StatusUnauthorized},
+		{"not allowed", http.MethodPost, "/metrics", "Bearer valid", http.StatusForbidden},
+		{"allowed", http.MethodGet, "/metrics", "Bearer valid", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
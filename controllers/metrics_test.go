@@ -0,0 +1,92 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// histogramCount returns the number of observations of the PodSet's series
+// of the histogram.
+func histogramCount(t *testing.T, histogram *prometheus.HistogramVec, podSet *podsetv1alpha1.PodSet) uint64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	if err := histogram.WithLabelValues(podSet.Namespace, podSet.Name).(prometheus.Metric).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func latencyTestPod(uid string, created time.Time, scheduledAfter, readyAfter time.Duration) corev1.Pod {
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-" + uid, UID: types.UID(uid), CreationTimestamp: metav1.NewTime(created)}}
+	scheduled := created.Add(scheduledAfter)
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(scheduled)}}
+	if readyAfter > 0 {
+		pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{
+			Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(scheduled.Add(readyAfter)),
+		})
+	}
+	return pod
+}
+
+func TestObservePodLatencies(t *testing.T) {
+	podSet := testPodSet(2)
+	podSet.Name = "latency"
+	r := &PodSetReconciler{}
+	defer r.latencies.forget(types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name})
+	created := time.Now().Add(-time.Hour)
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	// Pods already Ready when the PodSet is first seen are not recorded.
+	pods := []corev1.Pod{latencyTestPod("a", created, time.Second, time.Second)}
+	r.observePodLatencies(podSet, status, pods)
+	if n := histogramCount(t, podSchedulingDuration, podSet); n != 0 || status.PodLatency != nil {
+		t.Fatalf("recorded %d latencies with status %+v, want none for pods ready before the PodSet was seen", n, status.PodLatency)
+	}
+
+	pods = append(pods, latencyTestPod("b", created, 2*time.Second, 5*time.Second), latencyTestPod("c", created, time.Second, 0))
+	r.observePodLatencies(podSet, status, pods)
+	if n := histogramCount(t, podSchedulingDuration, podSet); n != 1 {
+		t.Errorf("recorded %d scheduling latencies, want 1 for the newly ready pod", n)
+	}
+	if n := histogramCount(t, podReadinessDuration, podSet); n != 1 {
+		t.Errorf("recorded %d readiness latencies, want 1 for the newly ready pod", n)
+	}
+	want := &podsetv1alpha1.PodLatencyStatus{
+		Pod:        "web-b",
+		Scheduling: metav1.Duration{Duration: 2 * time.Second},
+		Readiness:  metav1.Duration{Duration: 5 * time.Second},
+	}
+	if got := status.PodLatency; got == nil || *got != *want {
+		t.Errorf("pod latency = %+v, want %+v", got, want)
+	}
+
+	// Each pod is recorded once.
+	r.observePodLatencies(podSet, status, pods)
+	if n := histogramCount(t, podSchedulingDuration, podSet); n != 1 {
+		t.Errorf("recorded %d scheduling latencies, want web-b recorded only once", n)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// minPodAge returns how old pods must be to be chosen for scale-down.
+func minPodAge(podSet *podsetv1alpha1.PodSet) time.Duration {
+	if podSet.Spec.ScaleDown == nil {
+		return 0
+	}
+	return time.Duration(podSet.Spec.ScaleDown.MinPodAgeSeconds) * time.Second
+}
+
+// matureCandidates returns, in order, the candidates old enough to be chosen
+// for scale-down, and how long until the first of the others is, or zero if
+// there are none.
+func matureCandidates(podSet *podsetv1alpha1.PodSet, candidates []corev1.Pod) ([]corev1.Pod, time.Duration) {
+	age := minPodAge(podSet)
+	if age <= 0 {
+		return candidates, 0
+	}
+	var (
+		mature   []corev1.Pod
+		matureIn time.Duration
+	)
+	for _, pod := range candidates {
+		remaining := age - time.Since(pod.CreationTimestamp.Time)
+		if remaining <= 0 {
+			mature = append(mature, pod)
+			continue
+		}
+		if matureIn == 0 || remaining < matureIn {
+			matureIn = remaining
+		}
+	}
+	return mature, matureIn
+}
+
+// recordScaleDownDeferral records in the ScaleDownDeferred condition of
+// status whether the scale-down is waiting for pods to reach the minimum age.
+func recordScaleDownDeferral(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) {
+	if minPodAge(podSet) <= 0 {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionScaleDownDeferred)
+		return
+	}
+	if state.scaleDownDeferral <= 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionScaleDownDeferred,
+			Status:             metav1.ConditionFalse,
+			Reason:             "NoDeferral",
+			Message:            "No scale-down is waiting for pods to reach the minimum age",
+			ObservedGeneration: podSet.Generation,
+		})
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:   podsetv1alpha1.ConditionScaleDownDeferred,
+		Status: metav1.ConditionTrue,
+		Reason: "PodsTooYoung",
+		Message: fmt.Sprintf("Pods to scale down are younger than %s; the next one is old enough in %s",
+			minPodAge(podSet), state.scaleDownDeferral.Round(time.Second)),
+		ObservedGeneration: podSet.Generation,
+	})
+}
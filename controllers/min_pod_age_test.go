@@ -0,0 +1,72 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestMatureCandidates(t *testing.T) {
+	candidates := []corev1.Pod{
+		*leaderTestPod("web-old", time.Hour, true, false),
+		*leaderTestPod("web-young", 20*time.Second, true, false),
+		*leaderTestPod("web-new", 5*time.Second, true, false),
+	}
+
+	podSet := testPodSet(1)
+	if mature, wait := matureCandidates(podSet, candidates); len(mature) != 3 || wait != 0 {
+		t.Errorf("without a minimum age: %d mature, wait %s, want all 3 and no wait", len(mature), wait)
+	}
+
+	podSet.Spec.ScaleDown = &podsetv1alpha1.ScaleDownSpec{MinPodAgeSeconds: 60}
+	mature, wait := matureCandidates(podSet, candidates)
+	if len(mature) != 1 || mature[0].Name != "web-old" {
+		t.Errorf("%d mature, want only web-old", len(mature))
+	}
+	// web-young is the first to come of age, in about 40s.
+	if wait <= 35*time.Second || wait > 41*time.Second {
+		t.Errorf("wait = %s, want about 40s", wait)
+	}
+}
+
+func TestRecordScaleDownDeferral(t *testing.T) {
+	podSet := testPodSet(1)
+	status := &podsetv1alpha1.PodSetStatus{}
+	recordScaleDownDeferral(podSet, status, &podSetState{})
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionScaleDownDeferred); cond != nil {
+		t.Errorf("condition = %+v without a minimum age, want none", cond)
+	}
+
+	podSet.Spec.ScaleDown = &podsetv1alpha1.ScaleDownSpec{MinPodAgeSeconds: 60}
+	recordScaleDownDeferral(podSet, status, &podSetState{scaleDownDeferral: 30 * time.Second})
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionScaleDownDeferred)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != "PodsTooYoung" {
+		t.Errorf("condition = %+v, want True PodsTooYoung", cond)
+	}
+
+	recordScaleDownDeferral(podSet, status, &podSetState{})
+	if meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionScaleDownDeferred) {
+		t.Error("condition still True with nothing deferred, want False")
+	}
+}
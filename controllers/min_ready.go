@@ -0,0 +1,65 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// minReady returns spec.minReadySeconds as a duration.
+func minReady(podSet *podsetv1alpha1.PodSet) time.Duration {
+	return time.Duration(podSet.Spec.MinReadySeconds) * time.Second
+}
+
+// podAvailableIn returns how long until the pod has been Ready for
+// minReady: zero if it already has, and a negative duration if it is not
+// Ready.
+func podAvailableIn(pod *corev1.Pod, minReady time.Duration, now time.Time) time.Duration {
+	if !isPodReady(pod) {
+		return -1
+	}
+	ready := podConditionTime(pod, corev1.PodReady)
+	if minReady == 0 || ready == nil {
+		return 0
+	}
+	if wait := ready.Add(minReady).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// isPodAvailable reports whether the pod has been Ready for minReady.
+func isPodAvailable(pod *corev1.Pod, minReady time.Duration, now time.Time) bool {
+	return podAvailableIn(pod, minReady, now) == 0
+}
+
+// nextAvailable returns how long until the next of the Ready pods that
+// have not yet been Ready for minReady becomes available, or zero if there
+// is none.
+func nextAvailable(pods []corev1.Pod, minReady time.Duration, now time.Time) time.Duration {
+	var next time.Duration
+	for i := range pods {
+		if wait := podAvailableIn(&pods[i], minReady, now); wait > 0 && (next == 0 || wait < next) {
+			next = wait
+		}
+	}
+	return next
+}
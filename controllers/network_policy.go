@@ -0,0 +1,106 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// namespaceNameLabel is set on every namespace to its name.
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// ensureNetworkPolicy creates or updates the PodSet's NetworkPolicy, in the
+// namespace of its pods, or deletes it once spec.networkPolicy is unset. The
+// policy is owned by the PodSet and garbage collected with it, unless it
+// lives in another namespace, in which case the finalizer removes it.
+func (r *PodSetReconciler) ensureNetworkPolicy(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podSet.Name,
+			Namespace: podNamespace(podSet),
+		},
+	}
+	spec := podSet.Spec.NetworkPolicy
+	if spec == nil {
+		if err := r.Get(ctx, types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}, policy); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !createdFor(podSet, policy) {
+			return nil
+		}
+		if err := r.Delete(ctx, policy); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, policy, func() error {
+		policy.Labels = labelsForPodSet(podSet)
+		policy.Spec = networkPolicySpec(podSet)
+		if isCrossNamespace(podSet) {
+			// Cleaned up by the finalizer instead.
+			return nil
+		}
+		return controllerutil.SetControllerReference(podSet, policy, r.Scheme)
+	})
+	return err
+}
+
+// networkPolicySpec renders spec.networkPolicy.
+func networkPolicySpec(podSet *podsetv1alpha1.PodSet) networkingv1.NetworkPolicySpec {
+	spec := podSet.Spec.NetworkPolicy
+	policy := networkingv1.NetworkPolicySpec{
+		PodSelector: *selectorForPodSet(podSet),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}
+	if spec.AllowFromSameSet {
+		policy.Ingress = append(policy.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{{PodSelector: selectorForPodSet(podSet)}},
+		})
+	}
+	if len(spec.AllowFromNamespaces) > 0 {
+		policy.Ingress = append(policy.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{{
+						Key:      namespaceNameLabel,
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   append([]string(nil), spec.AllowFromNamespaces...),
+					}},
+				},
+			}},
+		})
+	}
+	for _, rule := range spec.Ingress {
+		policy.Ingress = append(policy.Ingress, *rule.DeepCopy())
+	}
+	if len(spec.Egress) > 0 {
+		policy.PolicyTypes = append(policy.PolicyTypes, networkingv1.PolicyTypeEgress)
+		for _, rule := range spec.Egress {
+			policy.Egress = append(policy.Egress, *rule.DeepCopy())
+		}
+	}
+	return policy
+}
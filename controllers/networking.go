@@ -0,0 +1,43 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// applyNetworking renders the PodSet's host network and DNS fields into the
+// pod. The DNS policy and configuration are used when the template sets
+// none; a pod that spec.hostNetwork puts on the host network without a DNS
+// policy resolves names with ClusterFirstWithHostNet, so that it still finds
+// cluster services.
+func applyNetworking(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) {
+	if cr.Spec.HostNetwork {
+		pod.Spec.HostNetwork = true
+	}
+	if pod.Spec.DNSPolicy == "" {
+		pod.Spec.DNSPolicy = cr.Spec.DNSPolicy
+	}
+	if pod.Spec.DNSPolicy == "" && cr.Spec.HostNetwork {
+		pod.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+	if pod.Spec.DNSConfig == nil && cr.Spec.DNSConfig != nil {
+		pod.Spec.DNSConfig = cr.Spec.DNSConfig.DeepCopy()
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// checkNodeNames returns the nodes from spec.nodeNames that exist and are
+// schedulable, and records the ones that are not in the NodesUnavailable
+// condition of status.
+func (r *PodSetReconciler) checkNodeNames(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) ([]string, error) {
+	if len(podSet.Spec.NodeNames) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionNodesUnavailable)
+		return nil, nil
+	}
+
+	var usable, problems []string
+	for _, name := range podSet.Spec.NodeNames {
+		node := &corev1.Node{}
+		err := r.Get(ctx, client.ObjectKey{Name: name}, node)
+		switch {
+		case errors.IsNotFound(err):
+			problems = append(problems, fmt.Sprintf("node %s does not exist", name))
+		case err != nil:
+			return nil, err
+		case node.Spec.Unschedulable:
+			problems = append(problems, fmt.Sprintf("node %s is unschedulable", name))
+		default:
+			usable = append(usable, name)
+		}
+	}
+
+	if len(problems) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionNodesUnavailable,
+			Status:             metav1.ConditionFalse,
+			Reason:             "NodesAvailable",
+			Message:            "All listed nodes are schedulable",
+			ObservedGeneration: podSet.Generation,
+		})
+		return usable, nil
+	}
+	reason := "SomeNodesUnavailable"
+	if len(usable) == 0 {
+		reason = "NoNodesAvailable"
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionNodesUnavailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            strings.Join(problems, "; "),
+		ObservedGeneration: podSet.Generation,
+	})
+	return usable, nil
+}
+
+// misplacedPods returns the pods running on nodes that are not listed in
+// spec.nodeNames.
+func misplacedPods(podSet *podsetv1alpha1.PodSet, pods []corev1.Pod) []corev1.Pod {
+	if len(podSet.Spec.NodeNames) == 0 {
+		return nil
+	}
+	listed := map[string]bool{}
+	for _, name := range podSet.Spec.NodeNames {
+		listed[name] = true
+	}
+	var misplaced []corev1.Pod
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" && !listed[pod.Spec.NodeName] {
+			misplaced = append(misplaced, pod)
+		}
+	}
+	return misplaced
+}
+
+// assignNodes pins each new pod to the usable node currently running the
+// fewest of the PodSet's pods, ties going to the node listed first. When
+// spec.nodeNames is set but none of its nodes are usable no pods are
+// returned, as they could never run.
+func assignNodes(podSet *podsetv1alpha1.PodSet, usable []string, existing []corev1.Pod, pods []*corev1.Pod) []*corev1.Pod {
+	if len(podSet.Spec.NodeNames) == 0 {
+		return pods
+	}
+	if len(usable) == 0 {
+		return nil
+	}
+	load := map[string]int{}
+	for _, pod := range existing {
+		load[pod.Spec.NodeName]++
+	}
+	for _, pod := range pods {
+		best := usable[0]
+		for _, name := range usable[1:] {
+			if load[name] < load[best] {
+				best = name
+			}
+		}
+		pod.Spec.NodeName = best
+		load[best]++
+	}
+	return pods
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestCheckNodeNames(t *testing.T) {
+	r := newTestReconciler(t,
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Spec: corev1.NodeSpec{Unschedulable: true}},
+	)
+	for _, tc := range []struct {
+		nodes  []string
+		usable []string
+		reason string
+	}{
+		{nodes: []string{"a"}, usable: []string{"a"}, reason: "NodesAvailable"},
+		{nodes: []string{"a", "b", "c"}, usable: []string{"a"}, reason: "SomeNodesUnavailable"},
+		{nodes: []string{"b", "c"}, reason: "NoNodesAvailable"},
+		{},
+	} {
+		podSet := testPodSet(1)
+		podSet.Spec.NodeNames = tc.nodes
+		status := &podsetv1alpha1.PodSetStatus{}
+		usable, err := r.checkNodeNames(context.Background(), podSet, status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(usable, tc.usable) {
+			t.Errorf("nodes %v: usable = %v, want %v", tc.nodes, usable, tc.usable)
+		}
+		cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionNodesUnavailable)
+		switch {
+		case tc.reason == "" && cond != nil:
+			t.Errorf("nodes %v: NodesUnavailable = %+v, want none", tc.nodes, cond)
+		case tc.reason != "" && (cond == nil || cond.Reason != tc.reason):
+			t.Errorf("nodes %v: NodesUnavailable = %+v, want reason %s", tc.nodes, cond, tc.reason)
+		}
+	}
+}
+
+func TestAssignNodes(t *testing.T) {
+	podSet := testPodSet(4)
+	podSet.Spec.NodeNames = []string{"a", "b", "c"}
+	existing := []corev1.Pod{
+		{Spec: corev1.PodSpec{NodeName: "a"}},
+		{Spec: corev1.PodSpec{NodeName: "a"}},
+		{Spec: corev1.PodSpec{NodeName: "b"}},
+	}
+	pods := []*corev1.Pod{{}, {}, {}}
+
+	assigned := assignNodes(podSet, []string{"a", "b", "c"}, existing, pods)
+	var nodes []string
+	for _, pod := range assigned {
+		nodes = append(nodes, pod.Spec.NodeName)
+	}
+	if want := []string{"c", "b", "c"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("assigned nodes = %v, want %v", nodes, want)
+	}
+
+	if assigned := assignNodes(podSet, nil, existing, []*corev1.Pod{{}}); len(assigned) != 0 {
+		t.Errorf("assigned %d pods with no usable nodes, want none", len(assigned))
+	}
+}
+
+func TestMisplacedPods(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Spec.NodeNames = []string{"a"}
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "on-a"}, Spec: corev1.PodSpec{NodeName: "a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "on-b"}, Spec: corev1.PodSpec{NodeName: "b"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unscheduled"}},
+	}
+	misplaced := misplacedPods(podSet, pods)
+	if len(misplaced) != 1 || misplaced[0].Name != "on-b" {
+		t.Errorf("misplaced pods = %v, want on-b", misplaced)
+	}
+}
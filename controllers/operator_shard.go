@@ -0,0 +1,37 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"hash/fnv"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ownsObject reports whether this replica of the operator reconciles the
+// object, a PodSet, by hashing its UID into one of ShardTotal shards. As the
+// hash only depends on the UID and the shard count, replicas agree on the
+// split without coordinating, and a change of shard count moves PodSets
+// between replicas by the same rule.
+func (r *PodSetReconciler) ownsObject(obj client.Object) bool {
+	if r.ShardTotal <= 1 {
+		return true
+	}
+	hasher := fnv.New32a()
+	hasher.Write([]byte(obj.GetUID()))
+	return int(hasher.Sum32()%uint32(r.ShardTotal)) == r.ShardIndex
+}
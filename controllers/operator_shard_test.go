@@ -0,0 +1,174 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestOwnsObjectSplitsPodSets(t *testing.T) {
+	const total = 3
+	replicas := make([]*PodSetReconciler, total)
+	for i := range replicas {
+		replicas[i] = &PodSetReconciler{ShardIndex: i, ShardTotal: total}
+	}
+	perShard := make([]int, total)
+	for i := 0; i < 300; i++ {
+		obj := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{UID: types.UID(fmt.Sprintf("uid-%d", i))}}
+		owners := 0
+		for shard, r := range replicas {
+			if r.ownsObject(obj) {
+				owners++
+				perShard[shard]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("%s is owned by %d replicas, want exactly 1", obj.UID, owners)
+		}
+	}
+	for shard, n := range perShard {
+		if n == 0 {
+			t.Errorf("shard %d owns none of 300 PodSets, want a share", shard)
+		}
+	}
+
+	unsharded := &PodSetReconciler{}
+	if !unsharded.ownsObject(&metav1.PartialObjectMetadata{}) {
+		t.Error("an unsharded operator does not own the PodSet, want it to own every PodSet")
+	}
+}
+
+// shardWrites records, by namespace, the pods a reconciler creates and the
+// PodSets whose status it writes.
+type shardWrites struct {
+	client.Client
+	mu       *sync.Mutex
+	pods     map[string]int
+	statuses map[string]int
+}
+
+func (c shardWrites) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	if _, ok := obj.(*corev1.Pod); ok && len(createOpts.DryRun) == 0 {
+		c.mu.Lock()
+		c.pods[obj.GetNamespace()]++
+		c.mu.Unlock()
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c shardWrites) Status() client.StatusWriter {
+	return shardStatusWrites{StatusWriter: c.Client.Status(), writes: c}
+}
+
+type shardStatusWrites struct {
+	client.StatusWriter
+	writes shardWrites
+}
+
+func (w shardStatusWrites) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	w.writes.mu.Lock()
+	w.writes.statuses[obj.GetNamespace()]++
+	w.writes.mu.Unlock()
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func (w shardStatusWrites) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	w.writes.mu.Lock()
+	w.writes.statuses[obj.GetNamespace()]++
+	w.writes.mu.Unlock()
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func TestShardedReconcilersSplitPodSets(t *testing.T) {
+	const podSets = 8
+	var objs []client.Object
+	for i := 0; i < podSets; i++ {
+		podSet := testPodSet(1)
+		// The fake client ignores the pod owner index, so each PodSet gets
+		// a namespace of its own to keep their pods apart.
+		podSet.Namespace = fmt.Sprintf("ns-%d", i)
+		podSet.UID = types.UID(fmt.Sprintf("uid-%d", i))
+		objs = append(objs, podSet)
+	}
+	shared := newTestReconciler(t, objs...)
+	replicas := make([]*PodSetReconciler, 2)
+	writes := make([]shardWrites, 2)
+	for i := range replicas {
+		writes[i] = shardWrites{Client: shared.Client, mu: &sync.Mutex{}, pods: map[string]int{}, statuses: map[string]int{}}
+		replicas[i] = &PodSetReconciler{
+			Client:     writes[i],
+			Scheme:     shared.Scheme,
+			Recorder:   record.NewFakeRecorder(100),
+			ShardIndex: i,
+			ShardTotal: 2,
+		}
+	}
+
+	ctx := context.Background()
+	for i := 0; i < podSets; i++ {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: fmt.Sprintf("ns-%d", i), Name: "web"}}
+		for _, r := range replicas {
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	perShard := make([]int, len(replicas))
+	for i := 0; i < podSets; i++ {
+		namespace := fmt.Sprintf("ns-%d", i)
+		writers := 0
+		for shard := range replicas {
+			pods, statuses := writes[shard].pods[namespace], writes[shard].statuses[namespace]
+			if pods == 0 && statuses == 0 {
+				continue
+			}
+			writers++
+			perShard[shard]++
+			if pods != 1 || statuses == 0 {
+				t.Errorf("shard %d created %d pods and wrote status %d times for %s, want 1 pod and its status", shard, pods, statuses, namespace)
+			}
+		}
+		if writers != 1 {
+			t.Errorf("%s was written by %d shards, want exactly 1", namespace, writers)
+		}
+		pods := &corev1.PodList{}
+		if err := shared.List(ctx, pods, client.InNamespace(namespace)); err != nil {
+			t.Fatal(err)
+		}
+		if len(pods.Items) != 1 {
+			t.Errorf("%s has %d pods, want 1", namespace, len(pods.Items))
+		}
+	}
+	for shard, n := range perShard {
+		if n == 0 {
+			t.Errorf("shard %d wrote none of %d PodSets, want a share", shard, podSets)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// isOrdered reports whether the PodSet's pods have stable ordinal names.
+func isOrdered(podSet *podsetv1alpha1.PodSet) bool {
+	return podSet.Spec.PodManagementPolicy == podsetv1alpha1.OrderedPodManagement
+}
+
+// ordinalPodName returns the name of the PodSet's pod with the ordinal.
+func ordinalPodName(podSet *podsetv1alpha1.PodSet, ordinal int) string {
+	return podSet.Name + "-" + strconv.Itoa(ordinal)
+}
+
+// podOrdinal returns the ordinal of the PodSet's pod from its name, and
+// false for a pod that has none, such as an adopted pod.
+func podOrdinal(podSet *podsetv1alpha1.PodSet, pod *corev1.Pod) (int, bool) {
+	return nameOrdinal(podSet, pod.Name)
+}
+
+// nameOrdinal returns the ordinal in the name of a pod of the PodSet, and
+// false for a name that has none.
+func nameOrdinal(podSet *podsetv1alpha1.PodSet, name string) (int, bool) {
+	suffix := strings.TrimPrefix(name, podSet.Name+"-")
+	if suffix == name {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || ordinal < 0 || strconv.Itoa(ordinal) != suffix {
+		return 0, false
+	}
+	return ordinal, true
+}
+
+// scaleDownRank orders the pods of an Ordered PodSet for scale-down, highest
+// first: by ordinal, with pods without one above all others.
+func scaleDownRank(podSet *podsetv1alpha1.PodSet, pod *corev1.Pod) int {
+	if ordinal, ok := podOrdinal(podSet, pod); ok {
+		return ordinal
+	}
+	return math.MaxInt32
+}
+
+// freeOrdinals returns the lowest of count ordinals that no available pod,
+// nor failed pod counted as done, holds, for the pods to create. A failed pod
+// holding one of them is deleted so that it can be recreated under its
+// name; its ordinal, like that of a pod still terminating, is left for a
+// later pass, which the pod's deletion triggers.
+func (r *PodSetReconciler) freeOrdinals(ctx context.Context, podSet *podsetv1alpha1.PodSet, state *podSetState, count int) ([]int, error) {
+	log := ctrllog.FromContext(ctx)
+	held := map[int]bool{}
+	for _, pods := range [][]corev1.Pod{state.available, state.ignoredFailures} {
+		for i := range pods {
+			if ordinal, ok := podOrdinal(podSet, &pods[i]); ok {
+				held[ordinal] = true
+			}
+		}
+	}
+	existing := map[string]*corev1.Pod{}
+	for i := range state.pods {
+		existing[state.pods[i].Name] = &state.pods[i]
+	}
+
+	var free []int
+	for ordinal, claimed := 0, 0; claimed < count; ordinal++ {
+		if held[ordinal] {
+			continue
+		}
+		claimed++
+		pod, ok := existing[ordinalPodName(podSet, ordinal)]
+		if !ok {
+			free = append(free, ordinal)
+			continue
+		}
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		log.Info("Deleting pod to recreate it under its name", "pod.name", pod.Name, "pod.phase", pod.Status.Phase)
+		if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+			r.podDeleteFailed(podSet, pod, err)
+			return nil, err
+		}
+		r.podDeleted(podSet, state, pod, podsetv1alpha1.FailedPodReplacementDeletion)
+	}
+	return free, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const reasonOrphaned = "Orphaned"
+
+// orphansOnScaleDown reports whether the PodSet releases the pods it scales
+// down instead of deleting them.
+func orphansOnScaleDown(podSet *podsetv1alpha1.PodSet) bool {
+	return podSet.Spec.ScaleDown != nil && podSet.Spec.ScaleDown.Action == podsetv1alpha1.OrphanScaleDownAction
+}
+
+// pendingOrphans returns how many excess pods may still be orphaned: those
+// left over from earlier drops of the desired count plus the drop since the
+// last reconcile, but never more than the pods in excess. Excess that does
+// not come from such a drop is deleted instead, so that the same workload is
+// not orphaned over and over.
+func pendingOrphans(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) int {
+	if !orphansOnScaleDown(podSet) {
+		return 0
+	}
+	pending := int(status.PendingOrphans)
+	if drop := int(status.DesiredReplicas - state.desired); status.DesiredReplicas > 0 && drop > 0 {
+		pending += drop
+	}
+	if excess := len(state.available) - int(state.desired); pending > excess {
+		pending = excess
+	}
+	if pending < 0 {
+		pending = 0
+	}
+	return pending
+}
+
+// orphanPod releases the pod from the PodSet: it loses its owner reference
+// to the PodSet and the labels the controller selects and manages it by, so
+// that the controller never counts or touches it again.
+func (r *PodSetReconciler) orphanPod(ctx context.Context, podSet *podsetv1alpha1.PodSet, pod *corev1.Pod) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	var refs []metav1.OwnerReference
+	for _, ref := range pod.OwnerReferences {
+		if ref.UID != podSet.UID {
+			refs = append(refs, ref)
+		}
+	}
+	pod.OwnerReferences = refs
+	for key := range labelsForPodSet(podSet) {
+		delete(pod.Labels, key)
+	}
+	for _, key := range []string{templateHashLabel, roleLabel, shardLabel, drainingLabel} {
+		delete(pod.Labels, key)
+	}
+	if err := r.Patch(ctx, pod, patch); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	r.expectations.expectRemove(types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}, pod.Name, time.Now())
+	return nil
+}
+
+// recordOrphans emits an event naming the pods released from the PodSet.
+func (r *PodSetReconciler) recordOrphans(podSet *podsetv1alpha1.PodSet, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	r.Recorder.Event(podSet, corev1.EventTypeNormal, reasonOrphaned,
+		fmt.Sprintf("Released %d pods from the PodSet: %s", len(names), strings.Join(names, ", ")))
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func orphaningTestPodSet(replicas int32) *podsetv1alpha1.PodSet {
+	podSet := testPodSet(replicas)
+	podSet.Spec.ScaleDown = &podsetv1alpha1.ScaleDownSpec{Action: podsetv1alpha1.OrphanScaleDownAction}
+	return podSet
+}
+
+func TestPendingOrphans(t *testing.T) {
+	pods := rolloutTestPods("hash", "web-a", "web-b", "web-c", "web-d")
+	for _, tc := range []struct {
+		name           string
+		podSet         *podsetv1alpha1.PodSet
+		lastDesired    int32
+		pendingOrphans int32
+		desired        int32
+		want           int
+	}{
+		{name: "deleting", podSet: testPodSet(2), lastDesired: 4, desired: 2, want: 0},
+		{name: "replicas dropped", podSet: orphaningTestPodSet(2), lastDesired: 4, desired: 2, want: 2},
+		{name: "first reconcile", podSet: orphaningTestPodSet(2), desired: 2, want: 0},
+		{name: "excess not from a drop", podSet: orphaningTestPodSet(2), lastDesired: 2, desired: 2, want: 0},
+		{name: "left over", podSet: orphaningTestPodSet(3), lastDesired: 3, pendingOrphans: 1, desired: 3, want: 1},
+		{name: "capped at the excess", podSet: orphaningTestPodSet(3), lastDesired: 4, pendingOrphans: 2, desired: 3, want: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status := &podsetv1alpha1.PodSetStatus{DesiredReplicas: tc.lastDesired, PendingOrphans: tc.pendingOrphans}
+			state := &podSetState{available: pods, desired: tc.desired}
+			if got := pendingOrphans(tc.podSet, status, state); got != tc.want {
+				t.Errorf("pendingOrphans = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScaleDownPodsOrphans(t *testing.T) {
+	podSet := orphaningTestPodSet(1)
+	candidates := rolloutTestPods("hash", "web-a", "web-b")
+	for i := range candidates {
+		pod := &candidates[i]
+		for key, value := range labelsForPodSet(podSet) {
+			pod.Labels[key] = value
+		}
+		pod.Labels["team"] = "search"
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: podsetv1alpha1.GroupVersion.String(),
+			Kind:       "PodSet",
+			Name:       podSet.Name,
+			UID:        podSet.UID,
+			Controller: pointer.Bool(true),
+		}}
+	}
+	r := rolloutTestReconciler(t, podSet, candidates)
+	state := &podSetState{orphans: 1}
+
+	removed, _, err := r.scaleDownPods(context.Background(), podSet, state, candidates, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || state.orphans != 0 {
+		t.Fatalf("removed %d pods with %d orphans left, want 2 and 0", len(removed), state.orphans)
+	}
+
+	// The first pod is released and keeps running, the second is deleted
+	// as the orphans ran out.
+	pod := &corev1.Pod{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "web-a"}, pod); err != nil {
+		t.Fatal(err)
+	}
+	if len(pod.OwnerReferences) != 0 || pod.Labels["app"] != "" || pod.Labels[templateHashLabel] != "" {
+		t.Errorf("orphaned pod has owners %v and labels %v, want the PodSet's removed", pod.OwnerReferences, pod.Labels)
+	}
+	if pod.Labels["team"] != "search" {
+		t.Errorf("orphaned pod labels = %v, want its own labels kept", pod.Labels)
+	}
+	if podExists(t, r, "web-b") {
+		t.Error("web-b still exists, want it deleted once no orphans were pending")
+	}
+	if len(state.deleted) != 1 || state.deleted[0].Name != "web-b" {
+		t.Errorf("recorded deletions = %+v, want only web-b", state.deleted)
+	}
+}
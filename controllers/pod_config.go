@@ -0,0 +1,278 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// podConfigVolume is the name of the volume that mounts a pod's
+	// per-pod ConfigMap.
+	podConfigVolume = "podset-config"
+
+	// defaultPodConfigRefreshInterval is used when the reconciler has no
+	// PodConfigRefreshInterval set.
+	defaultPodConfigRefreshInterval = 10 * time.Second
+)
+
+// podConfigValues are the variables available to perPodConfig templates.
+type podConfigValues struct {
+	PodName   string
+	Index     int
+	Namespace string
+	Peers     []string
+}
+
+// podConfigName returns the name of the ConfigMap rendered for a pod.
+func podConfigName(podName string) string {
+	return podName + "-config"
+}
+
+// parsePodConfig parses the PodSet's perPodConfig templates, keyed by file
+// name.
+func parsePodConfig(cr *podsetv1alpha1.PodSet) (map[string]*template.Template, error) {
+	tmpls := make(map[string]*template.Template, len(cr.Spec.PerPodConfig.Data))
+	for key, text := range cr.Spec.PerPodConfig.Data {
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("perPodConfig.data[%s]: %w", key, err)
+		}
+		tmpls[key] = tmpl
+	}
+	return tmpls, nil
+}
+
+// renderPodConfig executes the templates with the given values.
+func renderPodConfig(tmpls map[string]*template.Template, values podConfigValues) (map[string]string, error) {
+	data := make(map[string]string, len(tmpls))
+	for key, tmpl := range tmpls {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, values); err != nil {
+			return nil, fmt.Errorf("perPodConfig.data[%s]: %w", key, err)
+		}
+		data[key] = buf.String()
+	}
+	return data, nil
+}
+
+// mountPodConfig mounts the config volume into each of the pod's containers.
+// The volume itself is added by addPodConfigVolume once the pod is named.
+func mountPodConfig(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) error {
+	if cr.Spec.PerPodConfig == nil {
+		return nil
+	}
+	if _, err := parsePodConfig(cr); err != nil {
+		return err
+	}
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      podConfigVolume,
+			MountPath: cr.Spec.PerPodConfig.MountPath,
+			ReadOnly:  true,
+		})
+	}
+	return nil
+}
+
+// addPodConfigVolume adds the volume holding the pod's ConfigMap. The
+// ConfigMap is named after the pod, so a pod without a name is named here
+// rather than by the API server.
+func addPodConfigVolume(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) {
+	if cr.Spec.PerPodConfig == nil {
+		return
+	}
+	namePod(pod)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: podConfigVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: podConfigName(pod.Name)},
+			},
+		},
+	})
+}
+
+// namePod gives a pod without a name one generated from its GenerateName, for
+// the objects named after it to be created along with it.
+func namePod(pod *corev1.Pod) {
+	if pod.Name == "" {
+		pod.Name = pod.GenerateName + utilrand.String(5)
+		pod.GenerateName = ""
+	}
+}
+
+// podConfigMapName returns the name of the ConfigMap mounted by the pod's
+// config volume, if it has one. Pods created before perPodConfig was set do
+// not.
+func podConfigMapName(pod *corev1.Pod) (string, bool) {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == podConfigVolume && volume.ConfigMap != nil {
+			return volume.ConfigMap.Name, true
+		}
+	}
+	return "", false
+}
+
+// syncPodConfigs renders the per-pod ConfigMap of each of the given pods.
+// Missing ConfigMaps are created straight away, since their pods cannot start
+// without them. Rewrites of existing ones, which follow every change in
+// membership, are spaced at least PodConfigRefreshInterval apart per PodSet;
+// when a rewrite is held back the time left to wait is returned.
+func (r *PodSetReconciler) syncPodConfigs(ctx context.Context, podSet *podsetv1alpha1.PodSet, pods []corev1.Pod) (time.Duration, error) {
+	log := ctrllog.FromContext(ctx)
+	if podSet.Spec.PerPodConfig == nil {
+		return 0, nil
+	}
+	tmpls, err := parsePodConfig(podSet)
+	if err != nil {
+		return 0, err
+	}
+
+	cmList := &corev1.ConfigMapList{}
+	if err := r.List(ctx, cmList, client.InNamespace(podNamespace(podSet)), client.MatchingLabels(labelsForPodSet(podSet))); err != nil {
+		return 0, err
+	}
+	existing := make(map[string]*corev1.ConfigMap, len(cmList.Items))
+	for i := range cmList.Items {
+		existing[cmList.Items[i].Name] = &cmList.Items[i]
+	}
+
+	sorted := make([]corev1.Pod, len(pods))
+	copy(sorted, pods)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	names := make([]string, 0, len(sorted))
+	for _, pod := range sorted {
+		names = append(names, pod.Name)
+	}
+
+	var stale []*corev1.ConfigMap
+	for i := range sorted {
+		pod := &sorted[i]
+		cmName, ok := podConfigMapName(pod)
+		if !ok {
+			continue
+		}
+		peers := make([]string, 0, len(names)-1)
+		peers = append(peers, names[:i]...)
+		peers = append(peers, names[i+1:]...)
+		data, err := renderPodConfig(tmpls, podConfigValues{
+			PodName:   pod.Name,
+			Index:     i,
+			Namespace: pod.Namespace,
+			Peers:     peers,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		cm, ok := existing[cmName]
+		if !ok {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      cmName,
+					Namespace: pod.Namespace,
+					Labels:    labelsForPodSet(podSet),
+				},
+				Data: data,
+			}
+			// Owned by the pod, so it is garbage collected along with it.
+			if err := controllerutil.SetOwnerReference(pod, cm, r.Scheme); err != nil {
+				return 0, err
+			}
+			log.Info("Creating pod ConfigMap", "configmap.name", cmName)
+			if err := r.Create(ctx, cm); err != nil && !errors.IsAlreadyExists(err) {
+				return 0, err
+			}
+			continue
+		}
+		if !equality.Semantic.DeepEqual(cm.Data, data) {
+			cm.Data = data
+			stale = append(stale, cm)
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	interval := r.PodConfigRefreshInterval
+	if interval <= 0 {
+		interval = defaultPodConfigRefreshInterval
+	}
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}
+	if wait := r.podConfigRefreshes.reserve(key, interval); wait > 0 {
+		log.Info("Delaying pod ConfigMap refresh", "stale", len(stale), "wait", wait)
+		return wait, nil
+	}
+	for _, cm := range stale {
+		log.Info("Refreshing pod ConfigMap", "configmap.name", cm.Name)
+		if err := r.Update(ctx, cm); err != nil && !errors.IsNotFound(err) {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// refreshLimiter spaces out work per PodSet.
+type refreshLimiter struct {
+	mu   sync.Mutex
+	last map[types.NamespacedName]time.Time
+}
+
+// reserve returns zero and records a refresh for key if at least interval has
+// passed since the last one, and otherwise returns the time left to wait.
+func (l *refreshLimiter) reserve(key types.NamespacedName, interval time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if last, ok := l.last[key]; ok {
+		if wait := interval - now.Sub(last); wait > 0 {
+			return wait
+		}
+	}
+	if l.last == nil {
+		l.last = make(map[types.NamespacedName]time.Time)
+	}
+	l.last[key] = now
+	return 0
+}
+
+// forget drops the record for key once its PodSet is gone.
+func (l *refreshLimiter) forget(key types.NamespacedName) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.last, key)
+}
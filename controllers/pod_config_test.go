@@ -0,0 +1,107 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func podConfigTestPodSet() *podsetv1alpha1.PodSet {
+	podSet := testPodSet(2)
+	podSet.Spec.PerPodConfig = &podsetv1alpha1.PerPodConfigSpec{
+		MountPath: "/etc/podset",
+		Data:      map[string]string{"peers": "{{.Index}} {{.PodName}} {{range .Peers}}{{.}},{{end}}"},
+	}
+	return podSet
+}
+
+func podConfigData(t *testing.T, r *PodSetReconciler, podName string) string {
+	t.Helper()
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: podConfigName(podName)}, cm); err != nil {
+		t.Fatal(err)
+	}
+	return cm.Data["peers"]
+}
+
+func TestNewPodMountsPodConfig(t *testing.T) {
+	pod, err := newPodForCR(podConfigTestPodSet(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name == "" {
+		t.Fatal("pod is not named, want a name for its ConfigMap")
+	}
+	if name, ok := podConfigMapName(pod); !ok || name != podConfigName(pod.Name) {
+		t.Errorf("config volume mounts %q, want %q", name, podConfigName(pod.Name))
+	}
+	mounts := pod.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].Name != podConfigVolume || mounts[0].MountPath != "/etc/podset" {
+		t.Errorf("volume mounts = %+v, want the config volume at /etc/podset", mounts)
+	}
+}
+
+func TestSyncPodConfigs(t *testing.T) {
+	podSet := podConfigTestPodSet()
+	r := newTestReconciler(t, podSet)
+	ctx := context.Background()
+	var pods []corev1.Pod
+	for _, name := range []string{"web-a", "web-b"} {
+		pod := &corev1.Pod{}
+		pod.Name, pod.Namespace = name, "default"
+		addPodConfigVolume(podSet, pod)
+		pods = append(pods, *pod)
+	}
+
+	if wait, err := r.syncPodConfigs(ctx, podSet, pods); err != nil || wait != 0 {
+		t.Fatalf("syncPodConfigs = %v, %v, want the ConfigMaps created", wait, err)
+	}
+	if got := podConfigData(t, r, "web-a"); got != "0 web-a web-b," {
+		t.Errorf("web-a config = %q, want index 0 and peer web-b", got)
+	}
+	if got := podConfigData(t, r, "web-b"); got != "1 web-b web-a," {
+		t.Errorf("web-b config = %q, want index 1 and peer web-a", got)
+	}
+
+	// The first rewrite after a membership change goes straight through,
+	// the next one waits for the refresh interval.
+	pods = pods[1:]
+	if wait, err := r.syncPodConfigs(ctx, podSet, pods); err != nil || wait != 0 {
+		t.Fatalf("syncPodConfigs = %v, %v, want the ConfigMap refreshed", wait, err)
+	}
+	if got := podConfigData(t, r, "web-b"); got != "0 web-b " {
+		t.Errorf("web-b config = %q, want index 0 and no peers", got)
+	}
+	podSet.Spec.PerPodConfig.Data["peers"] = "{{.PodName}}"
+	if wait, err := r.syncPodConfigs(ctx, podSet, pods); err != nil || wait == 0 {
+		t.Errorf("syncPodConfigs = %v, %v, want the refresh delayed", wait, err)
+	}
+}
+
+func TestParsePodConfigRejectsBadTemplate(t *testing.T) {
+	podSet := podConfigTestPodSet()
+	podSet.Spec.PerPodConfig.Data["broken"] = "{{.PodName"
+	if _, err := newPodForCR(podSet, nil); err == nil {
+		t.Error("pod rendered from a broken perPodConfig template, want an error")
+	}
+}
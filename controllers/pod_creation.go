@@ -0,0 +1,159 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// newPodsForCR renders count new pods for the PodSet.
+func newPodsForCR(cr *podsetv1alpha1.PodSet, inputs *templateInputs, count int) ([]*corev1.Pod, error) {
+	pods := make([]*corev1.Pod, 0, count)
+	for i := 0; i < count; i++ {
+		pod, err := newPodForCR(cr, inputs)
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// newOrdinalPodsForCR renders the pods with the given ordinals for an Ordered
+// PodSet.
+func newOrdinalPodsForCR(cr *podsetv1alpha1.PodSet, inputs *templateInputs, ordinals []int) ([]*corev1.Pod, error) {
+	pods := make([]*corev1.Pod, 0, len(ordinals))
+	for _, ordinal := range ordinals {
+		pod, err := newNamedPodForCR(cr, inputs, ordinalPodName(cr, ordinal))
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// boundCreates keeps the first MaxCreatesPerReconcile of the pods. The scale-up
+// requeues after creating them, so the rest follow on the next pass.
+func (r *PodSetReconciler) boundCreates(pods []*corev1.Pod) []*corev1.Pod {
+	if r.MaxCreatesPerReconcile > 0 && len(pods) > r.MaxCreatesPerReconcile {
+		return pods[:r.MaxCreatesPerReconcile]
+	}
+	return pods
+}
+
+// throttleCreates keeps the pods CreateLimiter has tokens for, taking the
+// tokens, and returns how long until it has tokens for the rest.
+func (r *PodSetReconciler) throttleCreates(podSet *podsetv1alpha1.PodSet, pods []*corev1.Pod) ([]*corev1.Pod, time.Duration) {
+	if r.CreateLimiter == nil {
+		return pods, 0
+	}
+	allowed := 0
+	for allowed < len(pods) && r.CreateLimiter.Allow() {
+		allowed++
+	}
+	deficit := len(pods) - allowed
+	if deficit == 0 {
+		return pods, 0
+	}
+	podCreatesThrottled.WithLabelValues(podSet.Namespace, podSet.Name).Inc()
+	wait := time.Duration(float64(deficit) / float64(r.CreateLimiter.Limit()) * float64(time.Second))
+	return pods[:allowed], wait
+}
+
+// createPods creates the given pods for the PodSet in slow-start batches of
+// 1, 2, 4 and so on, issuing at most CreateConcurrency creates at a time.
+// Once a create fails no further batch is started, so that a PodSet whose
+// pods cannot be created costs a few failed calls rather than one per
+// missing pod. It returns the pods that were created along with an
+// aggregate of the errors for those that were not. The claims of each pod
+// are created before it. Each pod must be a distinct object, as the creates
+// run concurrently.
+func (r *PodSetReconciler) createPods(ctx context.Context, podSet *podsetv1alpha1.PodSet, pods []*corev1.Pod) ([]corev1.Pod, error) {
+	for _, pod := range pods {
+		if isCrossNamespace(podSet) {
+			// Owner references cannot cross namespaces; these pods are
+			// tracked by their owner labels instead.
+			continue
+		}
+		// Set PodSet instance as the owner and controller
+		if err := controllerutil.SetControllerReference(podSet, pod, r.Scheme); err != nil {
+			return nil, err
+		}
+	}
+
+	concurrency := r.CreateConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created []corev1.Pod
+		errs    []error
+	)
+	sem := make(chan struct{}, concurrency)
+	for batch, start := 1, 0; start < len(pods) && len(errs) == 0; batch, start = batch*2, start+batch {
+		end := start + batch
+		if end > len(pods) {
+			end = len(pods)
+		}
+		for _, pod := range pods[start:end] {
+			pod := pod
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				err := r.createClaims(ctx, podSet, pod)
+				if err == nil {
+					err = r.Create(ctx, pod, client.FieldOwner(fieldManager))
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonFailedCreate, fmt.Sprintf("Error creating pod: %v", err))
+					errs = append(errs, err)
+					return
+				}
+				r.Recorder.Event(podSet, corev1.EventTypeNormal, reasonSuccessfulCreate, fmt.Sprintf("Created pod %s", pod.Name))
+				podSetPodsCreated.WithLabelValues(podSet.Namespace, podSet.Name).Inc()
+				r.expectations.expectCreate(types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}, pod.Name, time.Now())
+				created = append(created, *pod)
+			}()
+		}
+		wg.Wait()
+	}
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}
+	if len(errs) > 0 {
+		r.createFailures.record(key, podSet.Generation, errs[0])
+	} else {
+		r.createFailures.reset(key)
+	}
+	return created, utilerrors.NewAggregate(errs)
+}
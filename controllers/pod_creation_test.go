@@ -0,0 +1,136 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// countingCreates counts the creates it is sent, failing each of them when
+// fail is set.
+type countingCreates struct {
+	client.Client
+	fail  bool
+	calls *int32
+}
+
+func (c countingCreates) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	atomic.AddInt32(c.calls, 1)
+	if c.fail {
+		return failingCreates{}.Create(ctx, obj, opts...)
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestCreatePods(t *testing.T) {
+	podSet := testPodSet(10)
+	r := newTestReconciler(t, podSet)
+	r.CreateConcurrency = 4
+	var calls int32
+	r.Client = countingCreates{Client: r.Client, calls: &calls}
+
+	pods, err := newPodsForCR(podSet, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := r.createPods(context.Background(), podSet, pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 10 || calls != 10 {
+		t.Errorf("created %d pods in %d calls, want 10 in 10", len(created), calls)
+	}
+	list := &corev1.PodList{}
+	if err := r.List(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 10 {
+		t.Errorf("%d pods exist, want 10", len(list.Items))
+	}
+}
+
+func TestCreatePodsStopsAfterFailedBatch(t *testing.T) {
+	podSet := testPodSet(10)
+	r := newTestReconciler(t, podSet)
+	r.CreateConcurrency = 4
+	var calls int32
+	r.Client = countingCreates{Client: r.Client, fail: true, calls: &calls}
+
+	pods, err := newPodsForCR(podSet, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := r.createPods(context.Background(), podSet, pods)
+	if err == nil {
+		t.Fatal("createPods succeeded, want the create error")
+	}
+	if len(created) != 0 || calls != 1 {
+		t.Errorf("created %d pods in %d calls, want none in the single call of the first batch", len(created), calls)
+	}
+}
+
+func TestBoundCreates(t *testing.T) {
+	pods := make([]*corev1.Pod, 5)
+	r := &PodSetReconciler{}
+	if got := r.boundCreates(pods); len(got) != 5 {
+		t.Errorf("unbounded: kept %d pods, want 5", len(got))
+	}
+	r.MaxCreatesPerReconcile = 2
+	if got := r.boundCreates(pods); len(got) != 2 {
+		t.Errorf("bounded to 2: kept %d pods, want 2", len(got))
+	}
+}
+
+func TestThrottleCreates(t *testing.T) {
+	podSet := testPodSet(5)
+	pods := make([]*corev1.Pod, 5)
+	r := &PodSetReconciler{}
+	if allowed, wait := r.throttleCreates(podSet, pods); len(allowed) != 5 || wait != 0 {
+		t.Errorf("without a limiter: allowed %d pods and wait %s, want all 5 at once", len(allowed), wait)
+	}
+
+	r.CreateLimiter = rate.NewLimiter(2, 3)
+	allowed, wait := r.throttleCreates(podSet, pods)
+	if len(allowed) != 3 || wait != time.Second {
+		t.Errorf("allowed %d pods and wait %s, want the 3 of the burst and 1s for the other 2", len(allowed), wait)
+	}
+}
+
+func TestReconcileThrottlesCreates(t *testing.T) {
+	r := newTestReconciler(t, testPodSet(4))
+	r.CreateLimiter = rate.NewLimiter(1, 1)
+
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := &corev1.PodList{}
+	if err := r.List(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || result.RequeueAfter != 3*time.Second {
+		t.Errorf("created %d pods with result %+v, want 1 and a retry once the limiter has tokens for the rest", len(list.Items), result)
+	}
+}
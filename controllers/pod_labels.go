@@ -0,0 +1,176 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// podOwnerIndex indexes pods by the UID of the PodSet that controls
+	// them through an owner reference.
+	podOwnerIndex = "podset.example.com/owner"
+
+	reasonLabelsRepaired = "LabelsRepaired"
+	reasonPodReleased    = "PodReleased"
+)
+
+// ManagedPodSelector selects the pods the controller created, which all
+// carry the template hash label. Scoping the manager's pod cache to it keeps
+// unrelated pods out of memory; pods without the label, including orphans
+// that would otherwise be adopted, are then invisible to the controller.
+func ManagedPodSelector() labels.Selector {
+	requirement, err := labels.NewRequirement(templateHashLabel, selection.Exists, nil)
+	if err != nil {
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
+
+// podSetOwnerRef returns the object's controller reference if it points to a
+// PodSet, or nil.
+func podSetOwnerRef(obj client.Object) *metav1.OwnerReference {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil || owner.Kind != "PodSet" || owner.APIVersion != podsetv1alpha1.GroupVersion.String() {
+		return nil
+	}
+	return owner
+}
+
+// listPodSetPods lists the PodSet's pods. Pods in the PodSet's namespace are
+// matched by their owner reference through podOwnerIndex, so that pods of
+// another PodSet whose labels happen to match are never counted or deleted.
+// Pods outside it, which cannot carry an owner reference, and the pods of an
+// ObserveOnly PodSet, which something else creates, are matched by the
+// selector.
+func listPodSetPods(ctx context.Context, reader client.Reader, podSet *podsetv1alpha1.PodSet) ([]corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	opts := []client.ListOption{client.InNamespace(podNamespace(podSet))}
+	if isCrossNamespace(podSet) || isObserveOnly(podSet) {
+		opts = append(opts, client.MatchingLabelsSelector{Selector: podSelector(podSet)})
+	} else {
+		opts = append(opts, client.MatchingFields{podOwnerIndex: string(podSet.UID)})
+	}
+	if err := reader.List(ctx, pods, opts...); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// indexPodOwner is the podOwnerIndex extractor.
+func indexPodOwner(obj client.Object) []string {
+	owner := podSetOwnerRef(obj)
+	if owner == nil {
+		return nil
+	}
+	return []string{string(owner.UID)}
+}
+
+// applyPodLabels sets the labels on the pod with a server-side apply as
+// fieldManager, taking them over from whoever changed them. The apply holds
+// only these labels, leaving any others and the rest of the pod alone.
+func (r *PodSetReconciler) applyPodLabels(ctx context.Context, pod *corev1.Pod, want map[string]string) error {
+	apply := &unstructured.Unstructured{}
+	apply.SetAPIVersion("v1")
+	apply.SetKind("Pod")
+	apply.SetNamespace(pod.Namespace)
+	apply.SetName(pod.Name)
+	apply.SetLabels(want)
+	return r.Patch(ctx, apply, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// fixPodLabels finds the pods the PodSet owns by reference whose management
+// labels no longer match, and repairs or releases them according to
+// spec.mislabeledPodPolicy. It reports whether any pod was fixed.
+func (r *PodSetReconciler) fixPodLabels(ctx context.Context, podSet *podsetv1alpha1.PodSet) (bool, error) {
+	log := ctrllog.FromContext(ctx)
+	if isCrossNamespace(podSet) {
+		return false, nil
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(podSet.Namespace), client.MatchingFields{podOwnerIndex: string(podSet.UID)}); err != nil {
+		return false, err
+	}
+	want := labelsForPodSet(podSet)
+	selector := podSelector(podSet)
+	fixed := false
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		var keys []string
+		for key, value := range want {
+			if current, ok := pod.Labels[key]; !ok || current != value {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			// The matchExpressions of spec.selector cannot be repaired;
+			// a pod that no longer satisfies them is released.
+			if selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			log.Info("Releasing pod that no longer matches the selector", "pod.name", pod.Name)
+			if err := r.orphanPod(ctx, podSet, pod); err != nil {
+				return false, err
+			}
+			r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonPodReleased,
+				fmt.Sprintf("Released pod %s, whose labels no longer match the selector", pod.Name))
+			fixed = true
+			continue
+		}
+		sort.Strings(keys)
+
+		if podSet.Spec.MislabeledPodPolicy == podsetv1alpha1.ReleaseMislabeledPodPolicy {
+			log.Info("Releasing pod whose labels were changed", "pod.name", pod.Name, "labels", keys)
+			if err := r.orphanPod(ctx, podSet, pod); err != nil {
+				return false, err
+			}
+			r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonPodReleased,
+				fmt.Sprintf("Released pod %s, whose labels %s were changed", pod.Name, strings.Join(keys, ", ")))
+			fixed = true
+			continue
+		}
+
+		log.Info("Repairing pod labels", "pod.name", pod.Name, "labels", keys)
+		if err := r.applyPodLabels(ctx, pod, want); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return false, err
+		}
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonLabelsRepaired,
+			fmt.Sprintf("Restored labels %s on pod %s", strings.Join(keys, ", "), pod.Name))
+		fixed = true
+	}
+	return fixed, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// recordingApplies records the labels of the server-side applies it is sent,
+// which the fake client does not support, and passes other patches on.
+type recordingApplies struct {
+	client.Client
+	applied map[string]map[string]string
+}
+
+func (c *recordingApplies) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	c.applied[obj.GetName()] = obj.(*unstructured.Unstructured).GetLabels()
+	return nil
+}
+
+// ownedTestPod returns a pod owned by the PodSet with the given labels.
+func ownedTestPod(podSet *podsetv1alpha1.PodSet, name string, labels map[string]string) *corev1.Pod {
+	pod := leaderTestPod(name, 0, true, false)
+	pod.Labels = labels
+	pod.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: podsetv1alpha1.GroupVersion.String(),
+		Kind:       "PodSet",
+		Name:       podSet.Name,
+		UID:        podSet.UID,
+		Controller: pointer.Bool(true),
+	}}
+	return pod
+}
+
+func TestFixPodLabelsRepairs(t *testing.T) {
+	podSet := testPodSet(2)
+	r := newTestReconciler(t, podSet,
+		ownedTestPod(podSet, "web-a", labelsForPodSet(podSet)),
+		ownedTestPod(podSet, "web-b", map[string]string{"app": "other", "version": "v0.1"}))
+	applies := &recordingApplies{Client: r.Client, applied: map[string]map[string]string{}}
+	r.Client = applies
+
+	fixed, err := r.fixPodLabels(context.Background(), podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fixed {
+		t.Error("fixed = false, want true")
+	}
+	want := map[string]map[string]string{"web-b": labelsForPodSet(podSet)}
+	if !reflect.DeepEqual(applies.applied, want) {
+		t.Errorf("applied labels = %v, want %v", applies.applied, want)
+	}
+}
+
+func TestFixPodLabelsReleases(t *testing.T) {
+	podSet := testPodSet(2)
+	podSet.Spec.MislabeledPodPolicy = podsetv1alpha1.ReleaseMislabeledPodPolicy
+	r := newTestReconciler(t, podSet,
+		ownedTestPod(podSet, "web-a", labelsForPodSet(podSet)),
+		ownedTestPod(podSet, "web-b", map[string]string{"app": "other", "version": "v0.1"}))
+
+	fixed, err := r.fixPodLabels(context.Background(), podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fixed {
+		t.Error("fixed = false, want true")
+	}
+	for name, owned := range map[string]bool{"web-a": true, "web-b": false} {
+		pod := &corev1.Pod{}
+		if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, pod); err != nil {
+			t.Fatal(err)
+		}
+		if got := podSetOwnerRef(pod) != nil; got != owned {
+			t.Errorf("%s owned = %v, want %v", name, got, owned)
+		}
+	}
+}
+
+func TestFixPodLabelsLeavesMatchingPods(t *testing.T) {
+	podSet := testPodSet(1)
+	r := newTestReconciler(t, podSet, ownedTestPod(podSet, "web-a", labelsForPodSet(podSet)))
+	applies := &recordingApplies{Client: r.Client, applied: map[string]map[string]string{}}
+	r.Client = applies
+
+	fixed, err := r.fixPodLabels(context.Background(), podSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed || len(applies.applied) != 0 {
+		t.Errorf("fixed = %v with applies %v, want the pod left alone", fixed, applies.applied)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// podMonitorGVK is the prometheus-operator PodMonitor. It is handled as an
+// unstructured object so that the operator neither depends on
+// prometheus-operator nor needs its CRDs installed.
+var podMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
+
+// newPodMonitor returns an empty PodMonitor with the given name.
+func newPodMonitor(namespace, name string) *unstructured.Unstructured {
+	monitor := &unstructured.Unstructured{}
+	monitor.SetGroupVersionKind(podMonitorGVK)
+	monitor.SetNamespace(namespace)
+	monitor.SetName(name)
+	return monitor
+}
+
+// ensurePodMonitor creates or updates the PodSet's PodMonitor, in the
+// namespace of its pods, while a container of the pod template declares the
+// metrics port, and deletes it otherwise. Without the PodMonitor resource
+// installed there is nothing to do. The monitor is owned by the PodSet and
+// garbage collected with it, unless it lives in another namespace, in which
+// case the finalizer removes it.
+func (r *PodSetReconciler) ensurePodMonitor(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	log := ctrllog.FromContext(ctx)
+	monitor := newPodMonitor(podNamespace(podSet), podSet.Name)
+	spec := podSet.Spec.PodMonitor
+	declared := false
+	if spec != nil {
+		var err error
+		declared, err = declaresPort(podSet, spec.Port)
+		if err != nil {
+			return err
+		}
+	}
+	if !declared {
+		if err := r.Get(ctx, types.NamespacedName{Namespace: monitor.GetNamespace(), Name: monitor.GetName()}, monitor); err != nil {
+			if meta.IsNoMatchError(err) {
+				return nil
+			}
+			return client.IgnoreNotFound(err)
+		}
+		if !createdFor(podSet, monitor) {
+			return nil
+		}
+		if err := r.Delete(ctx, monitor); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	selector, err := runtime.DefaultUnstructuredConverter.ToUnstructured(selectorForPodSet(podSet))
+	if err != nil {
+		return err
+	}
+	endpoint := map[string]interface{}{"port": spec.Port}
+	if spec.Path != "" {
+		endpoint["path"] = spec.Path
+	}
+	if spec.Interval != "" {
+		endpoint["interval"] = spec.Interval
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, monitor, func() error {
+		monitor.SetLabels(labelsForPodSet(podSet))
+		monitor.Object["spec"] = map[string]interface{}{
+			"selector":            selector,
+			"podMetricsEndpoints": []interface{}{endpoint},
+		}
+		if isCrossNamespace(podSet) {
+			// Cleaned up by the finalizer instead.
+			return nil
+		}
+		return controllerutil.SetControllerReference(podSet, monitor, r.Scheme)
+	})
+	if meta.IsNoMatchError(err) {
+		log.Info("Not creating a PodMonitor, the PodMonitor resource is not installed")
+		return nil
+	}
+	return err
+}
+
+// declaresPort reports whether a container of the PodSet's pod template
+// declares the named port.
+func declaresPort(podSet *podsetv1alpha1.PodSet, name string) (bool, error) {
+	pod, err := podTemplate(podSet, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// deletePodMonitors deletes the PodMonitors matching the list options, if
+// the PodMonitor resource is installed.
+func (r *PodSetReconciler) deletePodMonitors(ctx context.Context, opts ...client.ListOption) error {
+	monitors := &unstructured.UnstructuredList{}
+	monitors.SetGroupVersionKind(podMonitorGVK.GroupVersion().WithKind(podMonitorGVK.Kind + "List"))
+	if err := r.List(ctx, monitors, opts...); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+	for i := range monitors.Items {
+		if err := r.Delete(ctx, &monitors.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// applyPodOverrides returns pod with the PodSet's podOverrides applied as a
+// strategic merge patch, so lists such as containers are merged by name.
+func applyPodOverrides(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) (*corev1.Pod, error) {
+	if cr.Spec.PodOverrides == nil || len(cr.Spec.PodOverrides.Raw) == 0 {
+		return pod, nil
+	}
+	if errs := podsetv1alpha1.ValidatePodOverrides(&cr.Spec, field.NewPath("spec", "podOverrides")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, cr.Spec.PodOverrides.Raw, corev1.Pod{})
+	if err != nil {
+		return nil, fmt.Errorf("applying podOverrides: %w", err)
+	}
+	out := &corev1.Pod{}
+	if err := json.Unmarshal(patched, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestPodTemplateAppliesOverrides(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.PodOverrides = &runtime.RawExtension{Raw: []byte(`{
+		"metadata": {"labels": {"tier": "web"}},
+		"spec": {
+			"priorityClassName": "high",
+			"containers": [{"name": "busybox", "image": "busybox:1.36"}, {"name": "sidecar", "image": "envoy"}]
+		}
+	}`)}
+
+	pod, err := podTemplate(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Labels["tier"] != "web" || pod.Labels["app"] != "web" {
+		t.Errorf("labels = %v, want the override's merged with the PodSet's", pod.Labels)
+	}
+	if pod.Spec.PriorityClassName != "high" {
+		t.Errorf("priorityClassName = %q, want high", pod.Spec.PriorityClassName)
+	}
+	if len(pod.Spec.Containers) != 2 {
+		t.Fatalf("containers = %v, want busybox and sidecar", pod.Spec.Containers)
+	}
+	busybox := pod.Spec.Containers[0]
+	if busybox.Name != "busybox" || busybox.Image != "busybox:1.36" || len(busybox.Command) == 0 {
+		t.Errorf("busybox container = %+v, want its image overridden and its command kept", busybox)
+	}
+}
+
+func TestPodOverridesChangeTemplateHash(t *testing.T) {
+	podSet := testPodSet(1)
+	before, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podSet.Spec.PodOverrides = &runtime.RawExtension{Raw: []byte(`{"spec": {"priorityClassName": "high"}}`)}
+	after, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Error("template hash did not change with podOverrides")
+	}
+}
+
+func TestPodOverridesRejected(t *testing.T) {
+	for name, raw := range map[string]string{
+		"not a pod":        `{"spec": {"containers": "busybox"}}`,
+		"owner references": `{"metadata": {"ownerReferences": [{"apiVersion": "v1", "kind": "ConfigMap", "name": "x", "uid": "u"}]}}`,
+		"selector label":   `{"metadata": {"labels": {"app": "other"}}}`,
+		"owner label":      `{"metadata": {"labels": {"podset.example.com/owner-uid": "other"}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			podSet := testPodSet(1)
+			podSet.Spec.TargetNamespace = "pods"
+			podSet.Spec.PodOverrides = &runtime.RawExtension{Raw: []byte(raw)}
+			if errs := podsetv1alpha1.ValidatePodOverrides(&podSet.Spec, field.NewPath("spec", "podOverrides")); len(errs) == 0 {
+				t.Error("the webhook admits the podOverrides, want them rejected as the controller does")
+			}
+			if _, err := applyPodOverrides(podSet, &corev1.Pod{}); err == nil {
+				t.Error("podOverrides were applied, want an error")
+			}
+		})
+	}
+
+	podSet := testPodSet(1)
+	podSet.Spec.ServiceAccount = &podsetv1alpha1.ServiceAccountSpec{Create: true}
+	podSet.Spec.PodOverrides = &runtime.RawExtension{Raw: []byte(`{"spec": {"serviceAccountName": "other"}}`)}
+	if _, err := applyPodOverrides(podSet, &corev1.Pod{}); err == nil {
+		t.Error("podOverrides setting serviceAccountName were applied with serviceAccount.create, want an error")
+	}
+}
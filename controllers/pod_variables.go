@@ -0,0 +1,86 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"regexp"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// podVariablePattern matches a {{.Name}} placeholder, optionally escaped with
+// a leading backslash.
+var podVariablePattern = regexp.MustCompile(`\\?\{\{\s*\.(\w+)\s*\}\}`)
+
+// podVariables returns the values of the placeholders that may appear in the
+// commands, args and env values of the named pod of the PodSet. Index, the
+// pod's ordinal, is known only for the pods of an Ordered PodSet.
+func podVariables(podSet *podsetv1alpha1.PodSet, hash, name string) map[string]string {
+	vars := map[string]string{
+		"PodSetName":   podSet.Name,
+		"Namespace":    podNamespace(podSet),
+		"TemplateHash": hash,
+	}
+	if isOrdered(podSet) {
+		if ordinal, ok := nameOrdinal(podSet, name); ok {
+			vars["Index"] = strconv.Itoa(ordinal)
+		}
+	}
+	return vars
+}
+
+// expandPodVariables replaces known placeholders in s with their values.
+// Unknown placeholders are left as they are, and a backslash before a
+// placeholder is dropped and the placeholder kept verbatim.
+func expandPodVariables(s string, vars map[string]string) string {
+	return podVariablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match[0] == '\\' {
+			return match[1:]
+		}
+		value, ok := vars[podVariablePattern.FindStringSubmatch(match)[1]]
+		if !ok {
+			return match
+		}
+		return value
+	})
+}
+
+// expandPodTemplateVariables expands placeholders in the commands, args and
+// env values of the pod's containers. It runs after the template hash is
+// taken, since the values are the same for every pod of a template but for
+// Index, which sets pods apart only by the name they already have.
+func expandPodTemplateVariables(pod *corev1.Pod, vars map[string]string) {
+	expand := func(containers []corev1.Container) {
+		for i := range containers {
+			container := &containers[i]
+			for j := range container.Command {
+				container.Command[j] = expandPodVariables(container.Command[j], vars)
+			}
+			for j := range container.Args {
+				container.Args[j] = expandPodVariables(container.Args[j], vars)
+			}
+			for j := range container.Env {
+				container.Env[j].Value = expandPodVariables(container.Env[j].Value, vars)
+			}
+		}
+	}
+	expand(pod.Spec.InitContainers)
+	expand(pod.Spec.Containers)
+}
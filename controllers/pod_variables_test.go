@@ -0,0 +1,91 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestExpandPodVariables(t *testing.T) {
+	vars := map[string]string{"PodSetName": "web", "Index": "2"}
+	for in, want := range map[string]string{
+		"--name={{.PodSetName}}":          "--name=web",
+		"{{ .Index }}-{{.PodSetName}}":    "2-web",
+		"{{.Unknown}}":                    "{{.Unknown}}",
+		`\{{.PodSetName}}`:                "{{.PodSetName}}",
+		"no placeholders":                 "no placeholders",
+		"{{.PodSetName}} {{.PodSetName}}": "web web",
+	} {
+		if got := expandPodVariables(in, vars); got != want {
+			t.Errorf("expandPodVariables(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func variablesTestPodSet(policy podsetv1alpha1.PodManagementPolicyType) *podsetv1alpha1.PodSet {
+	podSet := testPodSet(2)
+	podSet.Spec.PodManagementPolicy = policy
+	podSet.Spec.Template = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name:    "app",
+			Image:   "app",
+			Command: []string{"serve", "--set={{.PodSetName}}"},
+			Args:    []string{"--index={{.Index}}"},
+			Env:     []corev1.EnvVar{{Name: "HASH", Value: "{{.TemplateHash}}"}},
+		}},
+	}}
+	return podSet
+}
+
+func TestNewPodExpandsVariables(t *testing.T) {
+	podSet := variablesTestPodSet(podsetv1alpha1.OrderedPodManagement)
+	pods, err := newOrdinalPodsForCR(podSet, nil, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := pods[0].Spec.Containers[0]
+	if container.Command[1] != "--set=web" || container.Args[0] != "--index=1" {
+		t.Errorf("command %v and args %v, want the PodSet name and index 1 filled in", container.Command, container.Args)
+	}
+	if hash := pods[0].Labels[templateHashLabel]; container.Env[0].Value != hash {
+		t.Errorf("HASH = %q, want the template hash %q", container.Env[0].Value, hash)
+	}
+
+	// Index is the only variable that differs between the pods, and is not
+	// part of the template hash.
+	other, err := newOrdinalPodsForCR(podSet, nil, []int{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other[0].Labels[templateHashLabel] != pods[0].Labels[templateHashLabel] {
+		t.Error("pods of the same template have different hashes")
+	}
+}
+
+func TestNewPodLeavesIndexUnorderedAlone(t *testing.T) {
+	pod, err := newPodForCR(variablesTestPodSet(""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := pod.Spec.Containers[0].Args; args[0] != "--index={{.Index}}" {
+		t.Errorf("args = %v, want Index left unexpanded", args)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// classNameIndex indexes PodSets by spec.className.
+	classNameIndex = "podset.example.com/class-name"
+
+	reasonClassNotFound = "ClassNotFound"
+)
+
+// resolvePodSetClass returns the spec of the PodSetClass named by the
+// PodSet's spec.className, recording in the ClassNotFound condition of status
+// whether it exists. A missing class resolves to no defaults.
+func (r *PodSetReconciler) resolvePodSetClass(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) (*podsetv1alpha1.PodSetClassSpec, error) {
+	name := podSet.Spec.ClassName
+	if name == "" {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionClassNotFound)
+		return nil, nil
+	}
+	class := &podsetv1alpha1.PodSetClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, class); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		message := fmt.Sprintf("PodSetClass %s does not exist; no class defaults are applied", name)
+		if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionClassNotFound) {
+			r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonClassNotFound, message)
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionClassNotFound,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonClassNotFound,
+			Message:            message,
+			ObservedGeneration: podSet.Generation,
+		})
+		return nil, nil
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionClassNotFound,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ClassFound",
+		Message:            fmt.Sprintf("PodSetClass %s defaults are applied", name),
+		ObservedGeneration: podSet.Generation,
+	})
+	return &class.Spec, nil
+}
+
+// applyClassDefaults fills in the fields of the pod that the PodSet left
+// unset from the class. Container resources are merged per resource name.
+func applyClassDefaults(class *podsetv1alpha1.PodSetClassSpec, pod *corev1.Pod) {
+	if class == nil {
+		return
+	}
+	if len(pod.Spec.Tolerations) == 0 && len(class.Tolerations) > 0 {
+		pod.Spec.Tolerations = append([]corev1.Toleration(nil), class.Tolerations...)
+	}
+	for key, value := range class.NodeSelector {
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = map[string]string{}
+		}
+		if _, ok := pod.Spec.NodeSelector[key]; !ok {
+			pod.Spec.NodeSelector[key] = value
+		}
+	}
+	if pod.Spec.RuntimeClassName == nil && class.RuntimeClassName != nil {
+		runtimeClassName := *class.RuntimeClassName
+		pod.Spec.RuntimeClassName = &runtimeClassName
+	}
+	if pod.Spec.PriorityClassName == "" {
+		pod.Spec.PriorityClassName = class.PriorityClassName
+	}
+	applyResources(class.Resources, pod)
+}
+
+// applyResources merges resources under those of each container of the pod.
+func applyResources(resources *corev1.ResourceRequirements, pod *corev1.Pod) {
+	if resources == nil {
+		return
+	}
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i].Resources
+		container.Requests = mergeResourceList(container.Requests, resources.Requests)
+		container.Limits = mergeResourceList(container.Limits, resources.Limits)
+	}
+}
+
+// applyImagePullSecrets adds the secrets the pod does not already list to its
+// image pull secrets.
+func applyImagePullSecrets(secrets []corev1.LocalObjectReference, pod *corev1.Pod) {
+	for _, secret := range secrets {
+		listed := false
+		for _, existing := range pod.Spec.ImagePullSecrets {
+			if existing.Name == secret.Name {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, secret)
+		}
+	}
+}
+
+// mergeResourceList returns list with the entries of defaults it lacks.
+func mergeResourceList(list, defaults corev1.ResourceList) corev1.ResourceList {
+	for name, quantity := range defaults {
+		if list == nil {
+			list = corev1.ResourceList{}
+		}
+		if _, ok := list[name]; !ok {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+	return list
+}
+
+// indexPodSetClassName is the classNameIndex extractor.
+func indexPodSetClassName(obj client.Object) []string {
+	podSet, ok := obj.(*podsetv1alpha1.PodSet)
+	if !ok || podSet.Spec.ClassName == "" {
+		return nil
+	}
+	return []string{podSet.Spec.ClassName}
+}
+
+// podSetsForClass enqueues the PodSets that select a PodSetClass, so that
+// changes to the class roll out to their pods.
+func (r *PodSetReconciler) podSetsForClass(obj client.Object) []reconcile.Request {
+	podSets := &podsetv1alpha1.PodSetList{}
+	if err := r.List(context.Background(), podSets, client.MatchingFields{classNameIndex: obj.GetName()}); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(podSets.Items))
+	for _, podSet := range podSets.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}})
+	}
+	return requests
+}
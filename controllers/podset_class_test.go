@@ -0,0 +1,118 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestResolvePodSetClass(t *testing.T) {
+	class := &podsetv1alpha1.PodSetClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "batch"},
+		Spec:       podsetv1alpha1.PodSetClassSpec{PriorityClassName: "low"},
+	}
+	r := newTestReconciler(t, class)
+	podSet := testPodSet(1)
+	status := &podsetv1alpha1.PodSetStatus{}
+	ctx := context.Background()
+
+	podSet.Spec.ClassName = "missing"
+	spec, err := r.resolvePodSetClass(ctx, podSet, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec != nil || !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionClassNotFound) {
+		t.Errorf("resolved %+v with conditions %+v, want no defaults and ClassNotFound", spec, status.Conditions)
+	}
+
+	podSet.Spec.ClassName = "batch"
+	spec, err = r.resolvePodSetClass(ctx, podSet, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec == nil || spec.PriorityClassName != "low" || meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionClassNotFound) {
+		t.Errorf("resolved %+v with conditions %+v, want the class", spec, status.Conditions)
+	}
+
+	podSet.Spec.ClassName = ""
+	if _, err := r.resolvePodSetClass(ctx, podSet, status); err != nil {
+		t.Fatal(err)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionClassNotFound); cond != nil {
+		t.Errorf("ClassNotFound = %+v without a class, want none", cond)
+	}
+}
+
+func TestApplyClassDefaults(t *testing.T) {
+	runtimeClass := "gvisor"
+	class := &podsetv1alpha1.PodSetClassSpec{
+		Tolerations:       []corev1.Toleration{{Key: "batch", Operator: corev1.TolerationOpExists}},
+		NodeSelector:      map[string]string{"pool": "batch", "zone": "a"},
+		RuntimeClassName:  &runtimeClass,
+		PriorityClassName: "low",
+		Resources: &corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		}},
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		NodeSelector:      map[string]string{"zone": "b"},
+		PriorityClassName: "high",
+		Containers: []corev1.Container{{
+			Name:      "app",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}},
+		}},
+	}}
+
+	applyClassDefaults(class, pod)
+	if len(pod.Spec.Tolerations) != 1 || pod.Spec.RuntimeClassName == nil || *pod.Spec.RuntimeClassName != "gvisor" {
+		t.Errorf("tolerations %v and runtime class %v, want the class defaults", pod.Spec.Tolerations, pod.Spec.RuntimeClassName)
+	}
+	if pod.Spec.NodeSelector["pool"] != "batch" || pod.Spec.NodeSelector["zone"] != "b" {
+		t.Errorf("node selector = %v, want the class's merged under the pod's", pod.Spec.NodeSelector)
+	}
+	if pod.Spec.PriorityClassName != "high" {
+		t.Errorf("priority class = %s, want the pod's own", pod.Spec.PriorityClassName)
+	}
+	requests := pod.Spec.Containers[0].Resources.Requests
+	if cpu, memory := requests[corev1.ResourceCPU], requests[corev1.ResourceMemory]; cpu.String() != "2" || memory.String() != "1Gi" {
+		t.Errorf("requests = %v, want the container's CPU and the class's memory", requests)
+	}
+}
+
+func TestClassChangesTemplateHash(t *testing.T) {
+	podSet := testPodSet(1)
+	before, err := currentTemplateHash(podSet, &templateInputs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := currentTemplateHash(podSet, &templateInputs{class: &podsetv1alpha1.PodSetClassSpec{PriorityClassName: "low"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Error("template hash did not change with the class defaults")
+	}
+}
@@ -19,16 +19,32 @@ package controllers
 import (
 	"context"
 	"reflect"
+	"sort"
+	"strconv"
+	"time"
 
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
 )
@@ -36,23 +52,162 @@ import (
 // PodSetReconciler reconciles a PodSet object
 type PodSetReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Pods is used to evict pods, which the controller-runtime client
+	// cannot do, for PodSets that scale down through the Eviction API.
+	Pods corev1client.PodsGetter
+
+	// CreateConcurrency bounds the number of pod creates issued at once
+	// during a scale-up. Values below one are treated as one.
+	CreateConcurrency int
+
+	// APIReader, if set, reads a PodSet afresh from the API server when an
+	// update of it conflicts, rather than from the cache, which may still
+	// hold the stale copy.
+	APIReader client.Reader
+
+	// MaxConcurrentReconciles is the number of PodSets reconciled at a
+	// time. A PodSet is never reconciled by two workers at once. Zero
+	// means one.
+	MaxConcurrentReconciles int
+
+	// RateLimiter, if set, paces the retries of failed reconciles and the
+	// requeues of PodSets in place of the controller-runtime default.
+	RateLimiter ratelimiter.RateLimiter
+
+	// RetryBaseDelay and RetryMaxDelay are the per-item backoff of
+	// RateLimiter, which the debug endpoint reports the next delay from.
+	// Zero means the controller-runtime default of 5ms doubling up to 1000s.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// MaxCreatesPerReconcile bounds the number of pods a single reconcile
+	// of a PodSet creates; a larger scale-up creates the rest on the
+	// following passes. Zero means no bound.
+	MaxCreatesPerReconcile int
+
+	// AllowedTargetNamespaces lists the namespaces, other than their own,
+	// that PodSets may create pods in. "*" allows any namespace.
+	AllowedTargetNamespaces []string
+
+	// CleanupHookHosts lists the hosts that the spec.cleanup.hook of a
+	// PodSet may call. "*" allows any host; with none, hooks are not
+	// called.
+	CleanupHookHosts []string
+
+	// PodNamesLimit caps the number of pod names written to status. Zero
+	// means no cap and a negative value omits the list entirely.
+	PodNamesLimit int
+
+	// PodConfigRefreshInterval is the minimum time between rewrites of a
+	// PodSet's per-pod ConfigMaps. Zero means a default of ten seconds.
+	PodConfigRefreshInterval time.Duration
+
+	// CapacityCheck makes the controller estimate the free capacity of the
+	// cluster before scaling up and create only the pods that fit.
+	CapacityCheck bool
+
+	// ScopedPodCache tells the controller that its cache holds only the
+	// pods it manages, so the capacity check lists every pod through
+	// APIReader instead.
+	ScopedPodCache bool
+
+	// CreateLimiter, if set, paces pod creates across all PodSets. A
+	// scale-up creates the pods it has tokens for and requeues for the rest.
+	CreateLimiter *rate.Limiter
+
+	// FlapWindow and FlapThreshold define flapping: more than FlapThreshold
+	// changes of scale direction within FlapWindow. Zero means defaults of
+	// one hour and six changes.
+	FlapWindow    time.Duration
+	FlapThreshold int
+
+	// FlapStabilization, if set, holds off scale-downs of a flapping
+	// PodSet until its desired count has not changed direction for this
+	// long.
+	FlapStabilization time.Duration
+
+	// CreateFailureLimit is the number of consecutive failed attempts to
+	// create a PodSet's pods after which the controller stops creating them
+	// until the spec changes. Zero means a default of five.
+	CreateFailureLimit int
+
+	// ReconcileInterval, if set, reconciles each PodSet again this long
+	// after each reconcile, unless its spec.reconcileInterval says
+	// otherwise.
+	ReconcileInterval time.Duration
+
+	// InPlaceResize makes the controller update the container resources of
+	// existing pods in place when they are all that changed in the pod
+	// template, on clusters with in-place pod vertical scaling.
+	InPlaceResize bool
+
+	// LogLevels, if set, supplies the logger of reconciles of PodSets whose
+	// verbosity is overridden.
+	LogLevels *LogLevels
+
+	// ShardIndex and ShardTotal split the PodSets between operator
+	// replicas: this replica reconciles only the PodSets whose UID hashes
+	// to ShardIndex out of ShardTotal. A ShardTotal of zero or one
+	// reconciles every PodSet.
+	ShardIndex int
+	ShardTotal int
+
+	// Clock, if set, is the clock deletion drains are paced by. Nil means
+	// the real clock.
+	Clock clock.PassiveClock
+
+	podConfigRefreshes refreshLimiter
+	capacity           capacityCache
+	templateChecks     templateCheckCache
+	latencies          latencyTracker
+	flaps              flapTracker
+	createFailures     createFailureTracker
+	reconciles         reconcileTracker
+	expectations       expectationsTracker
 }
 
 //+kubebuilder:rbac:groups=podset.example.com,resources=podsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=podset.example.com,resources=podsets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=podset.example.com,resources=podsets/finalizers,verbs=update
+//+kubebuilder:rbac:groups=podset.example.com,resources=podsetclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods/eviction,verbs=create
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;patch;delete
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=podmonitors,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+
+// fieldManager is the field manager the controller creates and corrects
+// pods as, so that their managed fields record what it owns.
+const fieldManager = "podset-operator"
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the PodSet object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.12.2/pkg/reconcile
-func (r *PodSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+// reasonActionFailed is the Degraded reason of a reconcile that failed to
+// create, delete or change an object.
+const reasonActionFailed = "ActionFailed"
+
+// Reconcile moves the pods of a PodSet towards its spec. A deleted PodSet is
+// finalized instead. Otherwise Reconcile first brings the PodSet and its
+// pods into shape to be listed: it adds the finalizer, clears a scale-down
+// confirmation, rolls back, and repairs pod labels and adopts orphans. It
+// then gathers the pods into a podSetState, waiting while the cache lags
+// behind recent creates and removals, and acts on them: it replaces failed,
+// crash looping and stuck pods, reconciles the objects that go with the
+// pods, and creates, deletes and updates pods to match spec.replicas and
+// the template. The status is written once, in a deferred call, whichever
+// step Reconcile returns from.
+func (r *PodSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, reterr error) {
+	ctx = r.LogLevels.reconcileContext(ctx, req)
 	log := ctrllog.FromContext(ctx)
 
 	// Fetch the PodSet instance
@@ -61,99 +216,702 @@ func (r *PodSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// if not found maybe its been deleted, dont requeue
+			r.podConfigRefreshes.forget(req.NamespacedName)
+			r.templateChecks.forget(req.NamespacedName)
+			r.latencies.forget(req.NamespacedName)
+			r.flaps.forget(req.NamespacedName)
+			r.createFailures.forget(req.NamespacedName)
+			r.reconciles.forget(req.NamespacedName)
+			r.expectations.forget(req.NamespacedName)
+			forgetPodSetMetrics(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object, requeue
 		return ctrl.Result{}, err
 	}
 
-	// LIst all pods owned by this PodSet instance,
 	podSet := instance
-	podList := &corev1.PodList{}
-	podSetLabels := map[string]string{
-		"app":     podSet.Name,
-		"version": "v0.1",
+	if !r.ownsObject(podSet) {
+		// Another replica reconciles this PodSet.
+		return ctrl.Result{}, nil
+	}
+	defer func() {
+		if interval := r.resyncInterval(podSet); reterr == nil && interval > 0 && !result.Requeue &&
+			(result.RequeueAfter == 0 || interval < result.RequeueAfter) {
+			result.RequeueAfter = interval
+		}
+		r.reconciles.record(req.NamespacedName, time.Now(), result, reterr)
+		if reterr != nil {
+			podSetReconcileErrors.WithLabelValues(req.Namespace, req.Name).Inc()
+		}
+	}()
+	if !podSet.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, podSet)
 	}
 
-	labelSelector := labels.SelectorFromSet(podSetLabels)
-	listOpts := &client.ListOptions{Namespace: podSet.Namespace, LabelSelector: labelSelector}
-	if err = r.List(context.TODO(), podList, listOpts); err != nil {
+	// The status is written once, after any scaling action below, so that it
+	// describes the pods we leave behind rather than the ones we found. Actions
+	// that fail are never folded into available, so the status stays truthful
+	// on error paths too, and their error is reported in the same write. A
+	// step that returns before the pods are listed leaves them as they were
+	// and reports only its error.
+	var state *podSetState
+	var status *podsetv1alpha1.PodSetStatus
+	defer func() {
+		var err error
+		if state == nil {
+			status = podSet.Status.DeepCopy()
+			r.reportActionError(podSet, status, reterr)
+			if !reflect.DeepEqual(podSet.Status, *status) {
+				patch := client.MergeFrom(podSet.DeepCopy())
+				podSet.Status = *status
+				err = r.Status().Patch(ctx, podSet, patch)
+			}
+		} else {
+			recordDeletions(status, state.deleted)
+			r.reportActionError(podSet, status, reterr)
+			err = r.updateStatus(ctx, podSet, status, state)
+		}
+		if err != nil {
+			log.Error(err, "Failed to update PodSet status")
+			if reterr == nil {
+				reterr = err
+			}
+		}
+	}()
+
+	if needsFinalizer(podSet) && !controllerutil.ContainsFinalizer(podSet, podSetFinalizer) {
+		if err := r.updatePodSet(ctx, podSet, func(podSet *podsetv1alpha1.PodSet) error {
+			controllerutil.AddFinalizer(podSet, podSetFinalizer)
+			return nil
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	// A confirmation of a drastic scale-down covers only the update it
+	// came with.
+	if _, ok := podSet.Annotations[podsetv1alpha1.ConfirmScaleDownAnnotation]; ok {
+		patch := client.MergeFrom(podSet.DeepCopy())
+		delete(podSet.Annotations, podsetv1alpha1.ConfirmScaleDownAnnotation)
+		if err := r.Patch(ctx, podSet, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if podSet.Spec.RollbackTo != nil {
+		if err := r.rollBackTo(ctx, podSet); err != nil {
+			log.Error(err, "Failed to roll back")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// Repair the labels of owned pods and adopt matching orphans first, so
+	// that the list below finds them.
+	if !isObserveOnly(podSet) && !isPaused(podSet) {
+		fixed, err := r.fixPodLabels(ctx, podSet)
+		if err != nil {
+			log.Error(err, "Failed to fix pod labels")
+			return ctrl.Result{}, err
+		}
+		adopted, err := r.adoptPods(ctx, podSet)
+		if err != nil {
+			log.Error(err, "Failed to adopt pods")
+			return ctrl.Result{}, err
+		}
+		if fixed || adopted {
+			return ctrl.Result{Requeue: true}, nil
+		}
+	}
+
+	// List all pods owned by this PodSet instance.
+	pods, err := listPodSetPods(ctx, r, podSet)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
+	// Until the cache shows the pods recent reconciles created and removed,
+	// acting on it would create or remove them a second time. Their events
+	// trigger the next reconcile.
+	if wait := r.expectations.observe(req.NamespacedName, pods, time.Now()); wait > 0 && !isObserveOnly(podSet) {
+		log.Info("Waiting for the cache to catch up with recent pod creates and removals")
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
 	// Count available pods (running + pending)
-	var available []corev1.Pod
-	for _, pod := range podList.Items {
+	state = &podSetState{pods: pods}
+	for _, pod := range pods {
 		// Dont count deleted pods
 		if pod.ObjectMeta.DeletionTimestamp != nil {
 			continue
 		}
-		if pod.Status.Phase == corev1.PodRunning || pod.Status.Phase == corev1.PodPending {
-			available = append(available, pod)
+		switch pod.Status.Phase {
+		case corev1.PodRunning, corev1.PodPending:
+			state.available = append(state.available, pod)
+		case corev1.PodFailed:
+			state.failed = append(state.failed, pod)
 		}
 	}
-	numAvailable := int32(len(available))
-	availableNames := []string{}
-	for _, pod := range available {
-		availableNames = append(availableNames, pod.ObjectMeta.Name)
-	}
+	status = podSet.Status.DeepCopy()
 
-	// Update the status if necessary
-	status := podsetv1alpha1.PodSetStatus{
-		PodNames:          availableNames,
-		AvailableReplicas: numAvailable,
+	r.observePodLatencies(podSet, status, state.pods)
+
+	if !r.targetNamespaceAllowed(podSet, status) {
+		log.Info("Target namespace is not allowed", "targetNamespace", podSet.Spec.TargetNamespace)
+		return ctrl.Result{}, nil
+	}
+	state.inputs.class, err = r.resolvePodSetClass(ctx, podSet, status)
+	if err != nil {
+		log.Error(err, "Failed to get PodSetClass", "className", podSet.Spec.ClassName)
+		return ctrl.Result{}, err
 	}
-	if !reflect.DeepEqual(podSet.Status, status) {
-		podSet.Status = status
-		err = r.Status().Update(context.TODO(), podSet)
+	state.inputs.colocation, err = r.resolveColocation(ctx, podSet, status)
+	if err != nil {
+		log.Error(err, "Failed to resolve colocation targets")
+		return ctrl.Result{}, err
+	}
+
+	// Under ObserveOnly, or while paused, everything below that would
+	// create, change or delete an object is skipped; the checks still
+	// report into status.
+	observeOnly := checkManagementPolicy(podSet, status)
+	if !observeOnly {
+		state.halted, state.ignoredFailures, err = r.applyFailurePolicy(ctx, podSet, status, state.failed)
 		if err != nil {
-			log.Error(err, "Failed to update PodSet status")
+			log.Error(err, "Failed to apply failure policy")
+			return ctrl.Result{}, err
+		}
+		if err := r.deleteReplacedFailures(ctx, podSet, status, state); err != nil {
+			log.Error(err, "Failed to delete failed pods")
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.handleCrashLoops(ctx, podSet, status, state, observeOnly); err != nil {
+		log.Error(err, "Failed to replace crash looping pods")
+		return ctrl.Result{}, err
+	}
+	r.checkImagePulls(podSet, status, state.available)
+	if err := r.handleStuckPending(ctx, podSet, status, state, observeOnly); err != nil {
+		log.Error(err, "Failed to replace stuck pending pods")
+		return ctrl.Result{}, err
+	}
+	if !observeOnly {
+		if err := r.ensureServiceAccount(ctx, podSet); err != nil {
+			log.Error(err, "Failed to reconcile ServiceAccount")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.ensureService(ctx, podSet); err != nil {
+			log.Error(err, "Failed to reconcile Service")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.ensureDisruptionBudget(ctx, podSet); err != nil {
+			log.Error(err, "Failed to reconcile PodDisruptionBudget")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.ensureNetworkPolicy(ctx, podSet); err != nil {
+			log.Error(err, "Failed to reconcile NetworkPolicy")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.ensurePodMonitor(ctx, podSet); err != nil {
+			log.Error(err, "Failed to reconcile PodMonitor")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.pruneClaims(ctx, podSet, state.pods); err != nil {
+			log.Error(err, "Failed to prune PersistentVolumeClaims")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.expandClaims(ctx, podSet, status); err != nil {
+			log.Error(err, "Failed to expand PersistentVolumeClaims")
 			return ctrl.Result{}, err
 		}
 	}
 
-	if numAvailable > podSet.Spec.Replicas {
-		diff := numAvailable - podSet.Spec.Replicas
-		// TODO(asmacdo) should be random?
-		dpods := available[:diff]
-		for _, dpod := range dpods {
-			err = r.Delete(context.TODO(), &dpod)
+	state.waitForReferences = r.checkReferences(ctx, podSet, status)
+
+	state.usableNodes, err = r.checkNodeNames(ctx, podSet, status)
+	if err != nil {
+		log.Error(err, "Failed to check spec.nodeNames")
+		return ctrl.Result{}, err
+	}
+	if !observeOnly {
+		for _, pod := range misplacedPods(podSet, state.available) {
+			log.Info("Deleting pod on a node no longer listed in spec.nodeNames", "pod.name", pod.Name, "node", pod.Spec.NodeName)
+			if err := r.Delete(ctx, &pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+				log.Error(err, "Failed to delete pod", "pod.name", pod.Name)
+				r.podDeleteFailed(podSet, &pod, err)
+				return ctrl.Result{}, err
+			}
+			r.podDeleted(podSet, state, &pod, podsetv1alpha1.DriftReplacementDeletion)
+			state.available = removePod(state.available, pod.Name)
+		}
+	}
+
+	var withinBudget bool
+	state.desired, withinBudget = r.checkResourceBudget(podSet, status, &state.inputs)
+	r.checkFlapping(ctx, podSet, status, state)
+	state.freeHostPorts = checkHostPorts(podSet, status, state)
+	state.capacity = r.checkCapacity(ctx, podSet, status, state)
+
+	if observeOnly {
+		status.Leader = observedLeader(state.available)
+		return ctrl.Result{}, nil
+	}
+
+	state.leader, err = r.reconcileLeader(ctx, podSet, state.pods, state.available)
+	if err != nil {
+		log.Error(err, "Failed to reconcile leader pod")
+		return ctrl.Result{}, err
+	}
+	status.Leader = state.leader
+
+	if !withinBudget {
+		log.Info("Not scaling, the resource budget is smaller than one pod")
+		return ctrl.Result{}, nil
+	}
+	if !state.halted && !state.waitForReferences {
+		state.templateRejected = r.checkPodTemplate(ctx, podSet, status, state)
+	}
+	state.replicaFailed = checkReplicaFailure(podSet, status)
+	result, err = r.scale(ctx, podSet, status, state)
+	if r.reportReplicaFailure(podSet, status) {
+		log.Info("Not creating pods, creates failed too often", "Error", err)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// Per-pod configs follow scaling so that they see the pods it created
+	// and deleted.
+	wait, err := r.syncPodConfigs(ctx, podSet, state.available)
+	if err != nil {
+		log.Error(err, "Failed to sync pod ConfigMaps")
+		return ctrl.Result{}, err
+	}
+	// The Available condition changes once pods have been Ready for
+	// spec.minReadySeconds, with no event to trigger a reconcile.
+	available := nextAvailable(state.available, minReady(podSet), time.Now())
+	for _, wait := range []time.Duration{wait, state.flapHold, state.pendingTimeout, available} {
+		if wait > 0 && (result.RequeueAfter == 0 || wait < result.RequeueAfter) {
+			result.RequeueAfter = wait
+		}
+	}
+	return result, nil
+}
+
+// resyncInterval is how long after a reconcile the PodSet is reconciled
+// again even without a watch event, or zero if it is not.
+func (r *PodSetReconciler) resyncInterval(podSet *podsetv1alpha1.PodSet) time.Duration {
+	if !podSet.DeletionTimestamp.IsZero() {
+		return 0
+	}
+	if podSet.Spec.ReconcileInterval != nil {
+		return podSet.Spec.ReconcileInterval.Duration
+	}
+	return r.ReconcileInterval
+}
+
+// podSetState is what a reconcile has observed about a PodSet's pods and
+// decided along the way.
+type podSetState struct {
+	// pods are all the pods listed for the PodSet, including deleted ones.
+	pods []corev1.Pod
+	// available are the running and pending pods that are not being
+	// deleted. Pods created or deleted by the reconcile are folded in as
+	// it goes.
+	available []corev1.Pod
+	// failed are the pods in the Failed phase.
+	failed []corev1.Pod
+	// ignoredFailures are the failed pods the pod failure policy counts as
+	// done; they keep their place among the replicas.
+	ignoredFailures []corev1.Pod
+	// deleted records the pods the reconcile deleted, and why.
+	deleted []podsetv1alpha1.DeletedPod
+	// halted is set when the failure policy forbids replacing pods.
+	halted bool
+	// waitForReferences is set when pod creation waits for referenced
+	// objects to appear.
+	waitForReferences bool
+	// usableNodes are the nodes from spec.nodeNames that can take pods.
+	usableNodes []string
+	// inputs are the objects other than the PodSet that its pod template
+	// is rendered from.
+	inputs templateInputs
+	// leader is the name of the elected leader pod, if any.
+	leader string
+	// desired is the number of pods the PodSet should run, after any
+	// clamping by its resource budget.
+	desired int32
+	// freeHostPorts are the ports of spec.hostPortRange no pod holds.
+	freeHostPorts []int32
+	// capacity is the number of new pods the cluster is estimated to fit,
+	// or -1 if unknown.
+	capacity int
+	// orphans is the number of excess pods to orphan rather than delete.
+	orphans int
+	// pendingTimeout is how long until the next Pending pod exceeds
+	// spec.pendingTimeout, if any does.
+	pendingTimeout time.Duration
+	// flapHold is how long scale-downs of a flapping PodSet are held off.
+	flapHold time.Duration
+	// scaleDownDeferral is how long a scale-down waits for pods to reach
+	// the minimum age, if it does.
+	scaleDownDeferral time.Duration
+	// templateRejected is set when a dry-run create rejected the pod
+	// template.
+	templateRejected bool
+	// replicaFailed is set while the ReplicaFailure condition stops pods
+	// from being created.
+	replicaFailed bool
+}
+
+// scale creates or deletes pods to bring the number of available pods to the
+// desired replica count, then rolls out spec changes to the pods.
+func (r *PodSetReconciler) scale(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) (ctrl.Result, error) {
+	var (
+		result ctrl.Result
+		err    error
+	)
+	// Orphans are counted against the desired count seen last time, which
+	// is recorded once scaling is done.
+	state.orphans = pendingOrphans(podSet, status, state)
+	defer func() {
+		status.DesiredReplicas = state.desired
+		status.PendingOrphans = int32(state.orphans)
+	}()
+	if isSharded(podSet) {
+		result, err = r.reconcileShards(ctx, podSet, state)
+	} else {
+		result, err = r.scaleReplicas(ctx, podSet, state)
+	}
+	recordScaleDownDeferral(podSet, status, state)
+	if err != nil || !result.IsZero() {
+		return result, err
+	}
+	if err := r.resizeInPlace(ctx, podSet, status, state); err != nil {
+		return ctrl.Result{}, err
+	}
+	return r.reconcileRollout(ctx, podSet, status, state)
+}
+
+// scaleReplicas brings the number of available pods of an unsharded PodSet to
+// the desired count.
+func (r *PodSetReconciler) scaleReplicas(ctx context.Context, podSet *podsetv1alpha1.PodSet, state *podSetState) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	numAvailable := int32(len(state.available) + len(state.ignoredFailures))
+	var candidates []corev1.Pod
+	if numAvailable > state.desired {
+		var matureIn time.Duration
+		candidates, matureIn = matureCandidates(podSet, preferNonLeader(orderForScaleDown(podSet, state.available), state.leader))
+		if len(candidates) == 0 {
+			log.Info("Deferring scale-down, every pod is younger than the minimum age", "Retry after", matureIn)
+			state.scaleDownDeferral = matureIn
+			return ctrl.Result{RequeueAfter: matureIn}, nil
+		}
+	}
+	if scaleDownDrain(podSet) > 0 {
+		var victims []corev1.Pod
+		if numAvailable > state.desired {
+			victims = drainingFirst(candidates)
+			if excess := int(numAvailable - state.desired); len(victims) > excess {
+				victims = victims[:excess]
+			}
+		}
+		drained, wait, err := r.drainVictims(ctx, podSet, state.available, victims)
+		if err != nil {
+			log.Error(err, "Failed to drain pods")
+			return ctrl.Result{}, err
+		}
+		if len(victims) > 0 {
+			removed, _, err := r.scaleDownPods(ctx, podSet, state, drained, len(drained))
+			for _, pod := range removed {
+				state.available = removePod(state.available, pod.Name)
+			}
 			if err != nil {
-				log.Error(err, "Failed to delete pod", "pod.name", dpod.Name)
-				// requeue
 				return ctrl.Result{}, err
 			}
-			return ctrl.Result{Requeue: true}, nil
+			if len(drained) > 0 {
+				return ctrl.Result{Requeue: true}, nil
+			}
+			return ctrl.Result{RequeueAfter: wait}, nil
 		}
 	}
-	if numAvailable < podSet.Spec.Replicas {
-		log.Info("Scaling up pods", "Currently available", numAvailable, "Required replicas", podSet.Spec.Replicas)
-		// Define a new Pod Object
-		pod := newPodForCR(podSet)
-		// Set PodSet instance as the owner and controller
-		if err := controllerutil.SetControllerReference(podSet, pod, r.Scheme); err != nil {
+	if numAvailable > state.desired {
+		diff := numAvailable - state.desired
+		// Pods are removed one per pass. Every available pod old enough is
+		// a candidate, in scale-down policy order, so that a pod protected by a
+		// PodDisruptionBudget does not hold up the scale-down.
+		r.recordScaling(podSet, numAvailable, state.desired)
+		removed, blocked, err := r.scaleDownPods(ctx, podSet, state, candidates, 1)
+		for _, pod := range removed {
+			state.available = removePod(state.available, pod.Name)
+		}
+		if err != nil {
+			// requeue
 			return ctrl.Result{}, err
 		}
-		err = r.Create(context.TODO(), pod)
+		if len(removed) == 0 && blocked {
+			log.Info("PodDisruptionBudgets refused every eviction, retrying with backoff", "Excess pods", diff)
+		}
+		// A plain requeue backs off while evictions keep being refused.
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if numAvailable < state.desired {
+		if state.halted {
+			log.Info("Not replacing failed pods, failure policy is Halt", "Failed pods", len(state.failed))
+			return ctrl.Result{}, nil
+		}
+		if state.waitForReferences {
+			log.Info("Not creating pods until referenced objects exist")
+			return ctrl.Result{}, nil
+		}
+		if state.templateRejected {
+			log.Info("Not creating pods, the pod template was rejected")
+			return ctrl.Result{}, nil
+		}
+		if state.replicaFailed {
+			log.Info("Not creating pods, creates failed too often")
+			return ctrl.Result{}, nil
+		}
+		diff := state.desired - numAvailable
+		log.Info("Scaling up pods", "Currently available", numAvailable, "Required replicas", state.desired)
+		r.recordScaling(podSet, numAvailable, state.desired)
+		var pods []*corev1.Pod
+		var err error
+		if isOrdered(podSet) {
+			var ordinals []int
+			ordinals, err = r.freeOrdinals(ctx, podSet, state, int(diff))
+			if err != nil {
+				log.Error(err, "Failed to free pod ordinals")
+				return ctrl.Result{}, err
+			}
+			pods, err = newOrdinalPodsForCR(podSet, &state.inputs, ordinals)
+		} else {
+			pods, err = newPodsForCR(podSet, &state.inputs, int(diff))
+		}
+		if err != nil {
+			log.Error(err, "Failed to render pods")
+			return ctrl.Result{}, err
+		}
+		pods = assignNodes(podSet, state.usableNodes, state.available, pods)
+		pods = assignHostPorts(podSet, state.freeHostPorts, pods)
+		fit := limitToCapacity(state.capacity, pods)
+		if len(fit) == 0 && len(pods) > 0 {
+			// No event announces freed capacity; look again once the
+			// estimate is refreshed.
+			log.Info("Not creating pods, the cluster has no capacity for them", "Retry after", capacityRefreshInterval)
+			return ctrl.Result{RequeueAfter: capacityRefreshInterval}, nil
+		}
+		pods = fit
+		pods = r.boundCreates(pods)
+		pods, throttled := r.throttleCreates(podSet, pods)
+		if len(pods) == 0 {
+			return ctrl.Result{RequeueAfter: throttled}, nil
+		}
+		created, err := r.createPods(ctx, podSet, pods)
+		state.available = append(state.available, created...)
 		if err != nil {
-			log.Error(err, "Failed to create pod", "pod.name", pod.Name)
+			log.Error(err, "Failed to create pods", "Created", len(created), "Requested", diff)
 			return ctrl.Result{}, err
 		}
+		if throttled > 0 {
+			log.Info("Pod creates throttled", "Created", len(created), "Requested", diff, "Retry after", throttled)
+			return ctrl.Result{RequeueAfter: throttled}, nil
+		}
 		return ctrl.Result{Requeue: true}, nil
 	}
 
 	return ctrl.Result{}, nil
 }
 
-func newPodForCR(cr *podsetv1alpha1.PodSet) *corev1.Pod {
-	podSetLabels := map[string]string{
-		"app":     cr.Name,
-		"version": "v0.1",
+// reportActionError records the error that failed the reconcile in the
+// Degraded condition of status, unless it is already raised for another
+// reason, and clears it once a reconcile succeeds.
+func (r *PodSetReconciler) reportActionError(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, err error) {
+	if err == nil {
+		clearDegraded(status, reasonActionFailed, podSet.Generation)
+		return
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason != reasonActionFailed {
+		return
 	}
-	return &corev1.Pod{
+	message := "Reconcile failed: " + err.Error()
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonActionFailed, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonActionFailed,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+}
+
+// updateStatus fills in status from the available pods of the state and
+// writes it if it differs from what is stored. It is written with a merge
+// patch of the fields that changed, so that it does not conflict with
+// writers of other status fields. A JSON merge patch replaces a changed
+// list whole, so conditions set by anyone but the controller since it read
+// the PodSet are overwritten when its own conditions change.
+func (r *PodSetReconciler) updateStatus(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) error {
+	available := state.available
+	availableNames := []string{}
+	for _, pod := range available {
+		availableNames = append(availableNames, pod.ObjectMeta.Name)
+	}
+	// Sort so that a truncated list is stable across reconciles.
+	sort.Strings(availableNames)
+	status.PodNamesTruncated = false
+	switch {
+	case r.PodNamesLimit < 0:
+		availableNames = nil
+		status.PodNamesTruncated = len(available) > 0
+	case r.PodNamesLimit > 0 && len(availableNames) > r.PodNamesLimit:
+		availableNames = availableNames[:r.PodNamesLimit]
+		status.PodNamesTruncated = true
+	}
+	status.PodNames = availableNames
+	status.ObservedGeneration = podSet.Generation
+	status.Replicas = int32(len(available))
+	status.AvailableReplicas = 0
+	status.ReadyReplicas = 0
+	now := time.Now()
+	for i := range available {
+		if isPodReady(&available[i]) {
+			status.ReadyReplicas++
+		}
+		if isPodAvailable(&available[i], minReady(podSet), now) {
+			status.AvailableReplicas++
+		}
+	}
+	// Left as it was if the template cannot be rendered, which the
+	// reconcile reports on its own.
+	if hash, err := currentTemplateHash(podSet, &state.inputs); err == nil {
+		status.UpdatedReplicas = 0
+		for _, pod := range available {
+			if pod.Labels[templateHashLabel] == hash {
+				status.UpdatedReplicas++
+			}
+		}
+	}
+	status.Selector = podSelector(podSet).String()
+	status.Shards = shardStatuses(podSet, available)
+	setStandardConditions(podSet, status, available)
+	podSetDesiredReplicas.WithLabelValues(podSet.Namespace, podSet.Name).Set(float64(status.DesiredReplicas))
+	podSetAvailableReplicas.WithLabelValues(podSet.Namespace, podSet.Name).Set(float64(status.AvailableReplicas))
+	if reflect.DeepEqual(podSet.Status, *status) {
+		return nil
+	}
+	patch := client.MergeFrom(podSet.DeepCopy())
+	podSet.Status = *status
+	return r.Status().Patch(ctx, podSet, patch)
+}
+
+// isPodReady reports whether the pod's Ready condition is True.
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// desiredReplicas returns the number of pods the PodSet should have.
+func desiredReplicas(podSet *podsetv1alpha1.PodSet) int32 {
+	if isSharded(podSet) {
+		return podSet.Spec.Shards * int32(replicasPerShard(podSet))
+	}
+	return podSet.Spec.Replicas
+}
+
+// removePod returns pods without the pod with the given name.
+func removePod(pods []corev1.Pod, name string) []corev1.Pod {
+	out := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Name != name {
+			out = append(out, pod)
+		}
+	}
+	return out
+}
+
+// labelsForPodSet returns the labels the controller stamps on the pods of
+// the PodSet: the matchLabels of spec.selector, or app and version without
+// one. Pods outside the PodSet's namespace cannot carry an owner reference,
+// so they are labeled with their owner as well.
+func labelsForPodSet(cr *podsetv1alpha1.PodSet) map[string]string {
+	labels := map[string]string{}
+	if cr.Spec.Selector != nil {
+		for key, value := range cr.Spec.Selector.MatchLabels {
+			labels[key] = value
+		}
+	} else {
+		labels["app"] = cr.Name
+		labels["version"] = "v0.1"
+	}
+	if isCrossNamespace(cr) {
+		labels[ownerUIDLabel] = string(cr.UID)
+		labels[ownerNamespaceLabel] = cr.Namespace
+		if cr.Spec.Selector != nil {
+			labels[ownerNameLabel] = cr.Name
+		}
+	}
+	return labels
+}
+
+// selectorForPodSet returns the selector of the PodSet's pods: spec.selector,
+// narrowed to the owner labels for pods outside the PodSet's namespace, or
+// labelsForPodSet without one.
+func selectorForPodSet(cr *podsetv1alpha1.PodSet) *metav1.LabelSelector {
+	if cr.Spec.Selector == nil {
+		return &metav1.LabelSelector{MatchLabels: labelsForPodSet(cr)}
+	}
+	selector := cr.Spec.Selector.DeepCopy()
+	selector.MatchLabels = labelsForPodSet(cr)
+	return selector
+}
+
+// podSelector returns selectorForPodSet as a labels.Selector. spec.selector
+// is validated by the webhook; should an invalid one get through, it selects
+// nothing.
+func podSelector(cr *podsetv1alpha1.PodSet) labels.Selector {
+	selector, err := metav1.LabelSelectorAsSelector(selectorForPodSet(cr))
+	if err != nil {
+		return labels.Nothing()
+	}
+	return selector
+}
+
+// safeToEvictAnnotation tells the cluster autoscaler whether it may evict a
+// pod to remove its node.
+const safeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+// templateInputs are what a PodSet's pod template is rendered from besides
+// the PodSet itself, as resolved by a reconcile.
+type templateInputs struct {
+	// class holds the defaults of the PodSet's PodSetClass, if any.
+	class *podsetv1alpha1.PodSetClassSpec
+	// colocation holds the affinity terms resolved from spec.colocateWith
+	// and spec.avoid.
+	colocation *corev1.Affinity
+}
+
+// podTemplate renders the part of the PodSet's pods that is the same for
+// every pod, with the given inputs, if any. Its hash identifies the version
+// of the spec a pod was created from.
+func podTemplate(cr *podsetv1alpha1.PodSet, inputs *templateInputs) (*corev1.Pod, error) {
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: cr.Name + "-pod",
-			Namespace:    cr.Namespace,
-			Labels:       podSetLabels,
+			Namespace:    podNamespace(cr),
+			Labels:       labelsForPodSet(cr),
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
@@ -165,11 +923,127 @@ func newPodForCR(cr *podsetv1alpha1.PodSet) *corev1.Pod {
 			},
 		},
 	}
+	if template := cr.Spec.Template; template != nil {
+		for key, value := range template.Labels {
+			if _, ok := pod.Labels[key]; !ok {
+				pod.Labels[key] = value
+			}
+		}
+		if len(template.Annotations) > 0 {
+			pod.Annotations = map[string]string{}
+			for key, value := range template.Annotations {
+				pod.Annotations[key] = value
+			}
+		}
+		pod.Spec = *template.Spec.DeepCopy()
+	}
+	if name := serviceAccountName(cr); name != "" && (createsServiceAccount(cr) || pod.Spec.ServiceAccountName == "") {
+		pod.Spec.ServiceAccountName = name
+	}
+	applyResources(cr.Spec.Resources, pod)
+	applyImagePullSecrets(cr.Spec.ImagePullSecrets, pod)
+	applyContainerEnv(cr.Spec.ContainerEnv, pod)
+	applyVolumes(cr, pod)
+	applyProbes(cr.Spec.Probes, pod)
+	applySecurityContext(cr, pod)
+	applyNetworking(cr, pod)
+	if pod.Spec.TerminationGracePeriodSeconds == nil && cr.Spec.TerminationGracePeriodSeconds != nil {
+		gracePeriod := *cr.Spec.TerminationGracePeriodSeconds
+		pod.Spec.TerminationGracePeriodSeconds = &gracePeriod
+	}
+	if isOrdered(cr) && pod.Spec.Subdomain == "" && cr.Spec.Service != nil && isHeadless(cr.Spec.Service) {
+		pod.Spec.Subdomain = serviceName(cr)
+	}
+	applyScheduling(cr, pod)
+	pod, err := applyPodOverrides(cr, pod)
+	if err != nil {
+		return nil, err
+	}
+	if cr.Spec.SafeToEvict != nil {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[safeToEvictAnnotation] = strconv.FormatBool(*cr.Spec.SafeToEvict)
+	}
+	if inputs != nil {
+		applyClassDefaults(inputs.class, pod)
+		applyColocation(inputs.colocation, pod)
+	}
+	if err := mountPodConfig(cr, pod); err != nil {
+		return nil, err
+	}
+	if isSharded(cr) {
+		addShardEnv(pod, corev1.EnvVar{Name: shardCountEnv, Value: strconv.Itoa(int(cr.Spec.Shards))})
+	}
+	return pod, nil
+}
+
+func newPodForCR(cr *podsetv1alpha1.PodSet, inputs *templateInputs) (*corev1.Pod, error) {
+	return newNamedPodForCR(cr, inputs, "")
+}
+
+// newNamedPodForCR renders a pod for the PodSet with the given name, or a
+// generated one if name is empty.
+func newNamedPodForCR(cr *podsetv1alpha1.PodSet, inputs *templateInputs, name string) (*corev1.Pod, error) {
+	pod, err := podTemplate(cr, inputs)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := podTemplateHash(pod)
+	if err != nil {
+		return nil, err
+	}
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[templateHashLabel] = hash
+	shape, err := podTemplateShapeHash(pod)
+	if err != nil {
+		return nil, err
+	}
+	pod.Labels[templateShapeLabel] = shape
+	if name != "" {
+		pod.Name = name
+		pod.GenerateName = ""
+	}
+	expandPodTemplateVariables(pod, podVariables(cr, hash, pod.Name))
+	addPodConfigVolume(cr, pod)
+	addClaimVolumes(cr, pod)
+	return pod, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PodSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Pod{}, podOwnerIndex, indexPodOwner); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &podsetv1alpha1.PodSet{}, referencesIndex, indexPodSetReferences); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &podsetv1alpha1.PodSet{}, classNameIndex, indexPodSetClassName); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &podsetv1alpha1.PodSet{}, colocationIndex, indexPodSetColocation); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&podsetv1alpha1.PodSet{}).
+		For(&podsetv1alpha1.PodSet{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.ownsObject), podSetChanged)).
+		Owns(&corev1.Pod{}, builder.WithPredicates(podChanged)).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&corev1.Service{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(podSetForLabeledPod), builder.WithPredicates(podChanged)).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.podSetsForOrphanPod), builder.WithPredicates(podChanged)).
+		Watches(&source.Kind{Type: &corev1.ServiceAccount{}}, handler.EnqueueRequestsFromMapFunc(r.podSetsForReference("ServiceAccount"))).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.podSetsForReference("Secret"))).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.podSetsForReference("ConfigMap"))).
+		Watches(&source.Kind{Type: &podsetv1alpha1.PodSetClass{}}, handler.EnqueueRequestsFromMapFunc(r.podSetsForClass)).
+		Watches(&source.Kind{Type: &podsetv1alpha1.PodSet{}}, handler.EnqueueRequestsFromMapFunc(r.podSetsColocatedWith)).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.RateLimiter,
+		}).
 		Complete(r)
 }
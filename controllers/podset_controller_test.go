@@ -0,0 +1,186 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// failingCreates fails every create that is not a dry run.
+type failingCreates struct {
+	client.Client
+}
+
+func (c failingCreates) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	if len(createOpts.DryRun) > 0 {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	return errors.New("create refused")
+}
+
+// failingPodLists fails every list of pods.
+type failingPodLists struct {
+	client.Client
+}
+
+func (c failingPodLists) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if _, ok := list.(*corev1.PodList); ok {
+		return errors.New("list refused")
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func testPodSet(replicas int32) *podsetv1alpha1.PodSet {
+	return &podsetv1alpha1.PodSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "web-uid", Generation: 1},
+		Spec:       podsetv1alpha1.PodSetSpec{Replicas: replicas},
+	}
+}
+
+// reconcileTestPodSet reconciles the PodSet made by testPodSet and returns
+// it as written back.
+func reconcileTestPodSet(t *testing.T, r *PodSetReconciler) (*podsetv1alpha1.PodSet, error) {
+	t.Helper()
+	key := client.ObjectKey{Namespace: "default", Name: "web"}
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	podSet := &podsetv1alpha1.PodSet{}
+	if getErr := r.Get(context.Background(), key, podSet); getErr != nil {
+		t.Fatal(getErr)
+	}
+	return podSet, err
+}
+
+func TestReconcileStatusCountsCreatedPods(t *testing.T) {
+	r := newTestReconciler(t, testPodSet(3))
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if podSet.Status.Replicas != 3 || len(podSet.Status.PodNames) != 3 {
+		t.Errorf("status has %d replicas and pod names %v, want the 3 pods just created", podSet.Status.Replicas, podSet.Status.PodNames)
+	}
+	if cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDegraded); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("Degraded condition = %+v, want False", cond)
+	}
+}
+
+func TestReconcileStatusReportsActionError(t *testing.T) {
+	r := newTestReconciler(t, testPodSet(3))
+	r.Client = failingCreates{r.Client}
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err == nil {
+		t.Fatal("reconcile succeeded, want the create error")
+	}
+	cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != reasonActionFailed {
+		t.Fatalf("Degraded condition = %+v, want True with reason %s", cond, reasonActionFailed)
+	}
+	if podSet.Status.Replicas != 0 {
+		t.Errorf("status has %d replicas, want 0", podSet.Status.Replicas)
+	}
+
+	r.Client = r.Client.(failingCreates).Client
+	podSet, err = reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDegraded); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("Degraded condition after a successful reconcile = %+v, want False", cond)
+	}
+}
+
+func TestReconcileStatusReportsErrorBeforePodsListed(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Status.Replicas = 2
+	r := newTestReconciler(t, podSet)
+	r.Client = failingPodLists{r.Client}
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err == nil {
+		t.Fatal("reconcile succeeded, want the list error")
+	}
+	cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != reasonActionFailed {
+		t.Fatalf("Degraded condition = %+v, want True with reason %s", cond, reasonActionFailed)
+	}
+	if podSet.Status.Replicas != 2 {
+		t.Errorf("status has %d replicas, want the 2 it had before the pods could not be listed", podSet.Status.Replicas)
+	}
+
+	r.Client = r.Client.(failingPodLists).Client
+	podSet, err = reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDegraded); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("Degraded condition after a successful reconcile = %+v, want False", cond)
+	}
+}
+
+func TestReconcileStatusPodNamesLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit     int
+		names     int
+		truncated bool
+	}{
+		{limit: 0, names: 3},
+		{limit: 5, names: 3},
+		{limit: 2, names: 2, truncated: true},
+		{limit: -1, names: 0, truncated: true},
+	} {
+		r := newTestReconciler(t, testPodSet(3))
+		r.PodNamesLimit = tc.limit
+
+		podSet, err := reconcileTestPodSet(t, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := podSet.Status
+		if len(status.PodNames) != tc.names || status.PodNamesTruncated != tc.truncated || status.Replicas != 3 {
+			t.Errorf("limit %d: status has pod names %v, truncated %v and %d replicas, want %d names, truncated %v and 3 replicas",
+				tc.limit, status.PodNames, status.PodNamesTruncated, status.Replicas, tc.names, tc.truncated)
+		}
+	}
+}
+
+func TestReconcileClearsScaleDownConfirmation(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Annotations = map[string]string{podsetv1alpha1.ConfirmScaleDownAnnotation: "true", "team": "search"}
+	r := newTestReconciler(t, podSet)
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := podSet.Annotations[podsetv1alpha1.ConfirmScaleDownAnnotation]; ok || podSet.Annotations["team"] != "search" {
+		t.Errorf("annotations = %v, want only the confirmation removed", podSet.Annotations)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// podSetChanged passes updates of a PodSet that change its spec, labels or
+// annotations, dropping those of its status alone, which the controller
+// writes itself.
+var podSetChanged = predicate.Or(
+	predicate.GenerationChangedPredicate{},
+	predicate.LabelChangedPredicate{},
+	predicate.AnnotationChangedPredicate{},
+)
+
+// podChanged passes updates of a pod that change something the controller
+// acts on: its metadata, its spec, its phase or conditions, or the state of
+// its containers. Other status updates, such as new probe times, are
+// dropped.
+var podChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, ok := e.ObjectOld.(*corev1.Pod)
+		if !ok {
+			return true
+		}
+		newPod, ok := e.ObjectNew.(*corev1.Pod)
+		if !ok {
+			return true
+		}
+		return podUpdateMatters(oldPod, newPod)
+	},
+}
+
+// podUpdateMatters reports whether the update of a pod from oldPod to newPod
+// changes something the controller acts on.
+func podUpdateMatters(oldPod, newPod *corev1.Pod) bool {
+	if !reflect.DeepEqual(oldPod.Labels, newPod.Labels) ||
+		!reflect.DeepEqual(oldPod.Annotations, newPod.Annotations) ||
+		!reflect.DeepEqual(oldPod.OwnerReferences, newPod.OwnerReferences) ||
+		!reflect.DeepEqual(oldPod.Finalizers, newPod.Finalizers) ||
+		!oldPod.DeletionTimestamp.Equal(newPod.DeletionTimestamp) ||
+		!reflect.DeepEqual(oldPod.Spec, newPod.Spec) {
+		return true
+	}
+	if oldPod.Status.Phase != newPod.Status.Phase || !conditionStatusesEqual(oldPod.Status.Conditions, newPod.Status.Conditions) {
+		return true
+	}
+	return !containerStatesEqual(oldPod.Status.InitContainerStatuses, newPod.Status.InitContainerStatuses) ||
+		!containerStatesEqual(oldPod.Status.ContainerStatuses, newPod.Status.ContainerStatuses)
+}
+
+// conditionStatusesEqual reports whether a and b hold the same conditions
+// with the same statuses, ignoring their probe and transition times.
+func conditionStatusesEqual(a, b []corev1.PodCondition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	statuses := make(map[corev1.PodConditionType]corev1.ConditionStatus, len(a))
+	for _, cond := range a {
+		statuses[cond.Type] = cond.Status
+	}
+	for _, cond := range b {
+		if status, ok := statuses[cond.Type]; !ok || status != cond.Status {
+			return false
+		}
+	}
+	return true
+}
+
+// containerStatesEqual reports whether a and b show the same containers in
+// the same states, with the same readiness and restart counts.
+func containerStatesEqual(a, b []corev1.ContainerStatus) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Ready != b[i].Ready || a[i].RestartCount != b[i].RestartCount ||
+			containerState(a[i].State) != containerState(b[i].State) {
+			return false
+		}
+	}
+	return true
+}
+
+// containerState summarizes a container's state as running, terminated or
+// the reason it is waiting.
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "Running"
+	case state.Terminated != nil:
+		return "Terminated"
+	case state.Waiting != nil:
+		return "Waiting:" + state.Waiting.Reason
+	}
+	return ""
+}
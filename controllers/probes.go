@@ -0,0 +1,45 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// applyProbes sets spec.probes on the containers they name, keeping the
+// probes the template sets.
+func applyProbes(probes []podsetv1alpha1.ContainerProbesSpec, pod *corev1.Pod) {
+	for _, spec := range probes {
+		for i := range pod.Spec.Containers {
+			container := &pod.Spec.Containers[i]
+			if spec.ContainerName != "" && spec.ContainerName != container.Name {
+				continue
+			}
+			if container.LivenessProbe == nil && spec.LivenessProbe != nil {
+				container.LivenessProbe = spec.LivenessProbe.DeepCopy()
+			}
+			if container.ReadinessProbe == nil && spec.ReadinessProbe != nil {
+				container.ReadinessProbe = spec.ReadinessProbe.DeepCopy()
+			}
+			if container.StartupProbe == nil && spec.StartupProbe != nil {
+				container.StartupProbe = spec.StartupProbe.DeepCopy()
+			}
+		}
+	}
+}
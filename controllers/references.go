@@ -0,0 +1,223 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// referencesIndex indexes PodSets by the objects their pods reference,
+	// as keys built by referenceKey.
+	referencesIndex = "podset.example.com/references"
+
+	reasonMissingReference = "MissingReference"
+)
+
+// podReference is an object, in the pod's namespace, that a pod refers to.
+type podReference struct {
+	Kind string
+	Name string
+}
+
+func (ref podReference) String() string {
+	return ref.Kind + " " + ref.Name
+}
+
+// referenceKey returns the referencesIndex key of an object.
+func referenceKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
+
+// podSetReferences returns the objects the PodSet's pods reference that the
+// controller does not create itself, skipping optional references.
+func podSetReferences(podSet *podsetv1alpha1.PodSet) ([]podReference, error) {
+	// PodSetClass defaults add no references.
+	pod, err := podTemplate(podSet, nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[podReference]bool{}
+	add := func(kind, name string, optional *bool) {
+		if name == "" || (optional != nil && *optional) {
+			return
+		}
+		seen[podReference{Kind: kind, Name: name}] = true
+	}
+
+	if createsServiceAccount(podSet) {
+		for _, secret := range podSet.Spec.ServiceAccount.ImagePullSecrets {
+			add("Secret", secret.Name, nil)
+		}
+	} else {
+		add("ServiceAccount", pod.Spec.ServiceAccountName, nil)
+	}
+	for _, secret := range pod.Spec.ImagePullSecrets {
+		add("Secret", secret.Name, nil)
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, source := range container.EnvFrom {
+			if source.SecretRef != nil {
+				add("Secret", source.SecretRef.Name, source.SecretRef.Optional)
+			}
+			if source.ConfigMapRef != nil {
+				add("ConfigMap", source.ConfigMapRef.Name, source.ConfigMapRef.Optional)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				add("Secret", ref.Name, ref.Optional)
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				add("ConfigMap", ref.Name, ref.Optional)
+			}
+		}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Secret != nil {
+			add("Secret", volume.Secret.SecretName, volume.Secret.Optional)
+		}
+		if volume.ConfigMap != nil {
+			add("ConfigMap", volume.ConfigMap.Name, volume.ConfigMap.Optional)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					add("Secret", source.Secret.Name, source.Secret.Optional)
+				}
+				if source.ConfigMap != nil {
+					add("ConfigMap", source.ConfigMap.Name, source.ConfigMap.Optional)
+				}
+			}
+		}
+	}
+
+	refs := make([]podReference, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	return refs, nil
+}
+
+// checkReferences looks up, in the cache, each object the PodSet's pods
+// reference and records the missing ones in the MissingReference condition
+// of status. It reports whether pod creation should wait for them. Lookups
+// that fail are logged rather than failing the reconcile.
+func (r *PodSetReconciler) checkReferences(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) bool {
+	log := ctrllog.FromContext(ctx)
+	refs, err := podSetReferences(podSet)
+	if err != nil {
+		// The render error is reported when pods are created.
+		return false
+	}
+	var missing []string
+	for _, ref := range refs {
+		var obj client.Object
+		switch ref.Kind {
+		case "ServiceAccount":
+			obj = &corev1.ServiceAccount{}
+		case "Secret":
+			obj = &corev1.Secret{}
+		case "ConfigMap":
+			obj = &corev1.ConfigMap{}
+		}
+		err := r.Get(ctx, types.NamespacedName{Namespace: podNamespace(podSet), Name: ref.Name}, obj)
+		switch {
+		case errors.IsNotFound(err):
+			missing = append(missing, ref.String())
+		case err != nil:
+			log.Error(err, "Failed to look up referenced object", "reference", ref.String())
+		}
+	}
+
+	if len(missing) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionMissingReference,
+			Status:             metav1.ConditionFalse,
+			Reason:             "ReferencesFound",
+			Message:            "All referenced objects exist",
+			ObservedGeneration: podSet.Generation,
+		})
+		return false
+	}
+	message := fmt.Sprintf("Referenced objects do not exist in namespace %s: %s", podNamespace(podSet), strings.Join(missing, ", "))
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionMissingReference) {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonMissingReference, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionMissingReference,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonMissingReference,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return podSet.Spec.MissingReferencePolicy == podsetv1alpha1.WaitMissingReferencePolicy
+}
+
+// indexPodSetReferences is the referencesIndex extractor.
+func indexPodSetReferences(obj client.Object) []string {
+	podSet, ok := obj.(*podsetv1alpha1.PodSet)
+	if !ok {
+		return nil
+	}
+	refs, err := podSetReferences(podSet)
+	if err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		keys = append(keys, referenceKey(podNamespace(podSet), ref.Kind, ref.Name))
+	}
+	return keys
+}
+
+// podSetsForReference returns a map function that enqueues the PodSets whose
+// pods reference an object of the given kind, so that they notice it
+// appearing.
+func (r *PodSetReconciler) podSetsForReference(kind string) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		podSets := &podsetv1alpha1.PodSetList{}
+		key := referenceKey(obj.GetNamespace(), kind, obj.GetName())
+		if err := r.List(context.Background(), podSets, client.MatchingFields{referencesIndex: key}); err != nil {
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(podSets.Items))
+		for _, podSet := range podSets.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}})
+		}
+		return requests
+	}
+}
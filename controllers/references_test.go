@@ -0,0 +1,113 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func referencesTestPodSet() *podsetv1alpha1.PodSet {
+	optional := true
+	podSet := testPodSet(2)
+	podSet.Spec.Template = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		ServiceAccountName: "runner",
+		Containers: []corev1.Container{{
+			Name:    "app",
+			Image:   "app",
+			EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}},
+			Env: []corev1.EnvVar{{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "extra"},
+				Key:                  "token",
+				Optional:             &optional,
+			}}}},
+		}},
+		Volumes: []corev1.Volume{{Name: "certs", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "certs"}}}},
+	}}
+	return podSet
+}
+
+func TestPodSetReferences(t *testing.T) {
+	refs, err := podSetReferences(referencesTestPodSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []podReference{{Kind: "ConfigMap", Name: "settings"}, {Kind: "Secret", Name: "certs"}, {Kind: "ServiceAccount", Name: "runner"}}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("references = %v, want %v, skipping the optional one", refs, want)
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	podSet := referencesTestPodSet()
+	podSet.Spec.MissingReferencePolicy = podsetv1alpha1.WaitMissingReferencePolicy
+	r := newTestReconciler(t,
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "certs", Namespace: "default"}},
+	)
+	status := &podsetv1alpha1.PodSetStatus{}
+	ctx := context.Background()
+
+	if wait := r.checkReferences(ctx, podSet, status); !wait {
+		t.Error("not waiting for the missing ConfigMap")
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionMissingReference)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Message != "Referenced objects do not exist in namespace default: ConfigMap settings" {
+		t.Errorf("MissingReference = %+v, want True naming ConfigMap settings", cond)
+	}
+
+	podSet.Spec.MissingReferencePolicy = ""
+	if wait := r.checkReferences(ctx, podSet, status); wait {
+		t.Error("waiting for the missing ConfigMap without the Wait policy")
+	}
+
+	if err := r.Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}}); err != nil {
+		t.Fatal(err)
+	}
+	podSet.Spec.MissingReferencePolicy = podsetv1alpha1.WaitMissingReferencePolicy
+	if wait := r.checkReferences(ctx, podSet, status); wait {
+		t.Error("waiting once every reference exists")
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionMissingReference); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("MissingReference = %+v, want False", cond)
+	}
+}
+
+func TestReconcileWaitsForReferences(t *testing.T) {
+	podSet := referencesTestPodSet()
+	podSet.Spec.MissingReferencePolicy = podsetv1alpha1.WaitMissingReferencePolicy
+	r := newTestReconciler(t, podSet)
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(context.Background(), pods); err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 || !meta.IsStatusConditionTrue(podSet.Status.Conditions, podsetv1alpha1.ConditionMissingReference) {
+		t.Errorf("%d pods created with conditions %+v, want none while references are missing", len(pods.Items), podSet.Status.Conditions)
+	}
+}
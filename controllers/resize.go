@@ -0,0 +1,134 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// templateShapeLabel holds the hash of the pod template a pod was
+	// created from without its container resources, so that pods that
+	// differ from a new template only in resources can be found.
+	templateShapeLabel = "podset.example.com/template-shape-hash"
+
+	// resizedAnnotation records the template hash a pod was resized in
+	// place to.
+	resizedAnnotation = "podset.example.com/resized-to"
+	// resizeInfeasibleAnnotation records the template hash a pod could not
+	// be resized in place to.
+	resizeInfeasibleAnnotation = "podset.example.com/resize-infeasible"
+)
+
+// podTemplateShapeHash returns the hash of the pod template without the
+// resources of its containers. Those of its init containers, which are not
+// resized in place, are part of the shape.
+func podTemplateShapeHash(template *corev1.Pod) (string, error) {
+	shape := template.DeepCopy()
+	for i := range shape.Spec.Containers {
+		shape.Spec.Containers[i].Resources = corev1.ResourceRequirements{}
+	}
+	delete(shape.Labels, templateHashLabel)
+	return podTemplateHash(shape)
+}
+
+// resizeInPlace updates, when the operator resizes pods in place, the
+// container resources of the available pods that differ from the current
+// pod template only in those, and relabels them as created from it so that
+// the rollout leaves them be. A pod whose resize the API server refuses is
+// marked and left to the rollout to replace. The counts are reported in
+// status.
+func (r *PodSetReconciler) resizeInPlace(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) error {
+	log := ctrllog.FromContext(ctx)
+	if !r.InPlaceResize {
+		status.InPlaceResize = nil
+		return nil
+	}
+	template, err := newPodForCR(podSet, &state.inputs)
+	if err != nil {
+		return err
+	}
+	hash := template.Labels[templateHashLabel]
+	shape := template.Labels[templateShapeLabel]
+	resources := map[string]corev1.ResourceRequirements{}
+	for _, container := range template.Spec.Containers {
+		resources[container.Name] = container.Resources
+	}
+
+	counts := &podsetv1alpha1.InPlaceResizeStatus{}
+	for i := range state.available {
+		pod := &state.available[i]
+		switch {
+		case pod.Labels[templateHashLabel] == hash:
+			if pod.Annotations[resizedAnnotation] == hash {
+				counts.Resized++
+			}
+			continue
+		case pod.Labels[templateShapeLabel] != shape:
+			continue
+		case pod.Annotations[resizeInfeasibleAnnotation] == hash:
+			counts.Infeasible++
+			continue
+		}
+
+		patch := client.StrategicMergeFrom(pod.DeepCopy())
+		for j := range pod.Spec.Containers {
+			container := &pod.Spec.Containers[j]
+			container.Resources = resources[container.Name]
+		}
+		pod.Labels[templateHashLabel] = hash
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[resizedAnnotation] = hash
+		err := r.Patch(ctx, pod, patch)
+		switch {
+		case err == nil:
+			log.Info("Resized pod in place", "pod.name", pod.Name, "templateHash", hash)
+			counts.Resized++
+		case errors.IsInvalid(err) || errors.IsForbidden(err) || errors.IsBadRequest(err):
+			log.Info("Pod cannot be resized in place, leaving it to be replaced", "pod.name", pod.Name, "reason", err.Error())
+			current := state.available[i].DeepCopy()
+			if getErr := r.Get(ctx, client.ObjectKeyFromObject(current), current); getErr != nil {
+				return client.IgnoreNotFound(getErr)
+			}
+			mark := client.MergeFrom(current.DeepCopy())
+			if current.Annotations == nil {
+				current.Annotations = map[string]string{}
+			}
+			current.Annotations[resizeInfeasibleAnnotation] = hash
+			if err := r.Patch(ctx, current, mark); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			state.available[i] = *current
+			counts.Infeasible++
+		case errors.IsNotFound(err):
+		default:
+			counts.Pending++
+			log.Error(err, "Failed to resize pod in place", "pod.name", pod.Name)
+		}
+	}
+	status.InPlaceResize = counts
+	return nil
+}
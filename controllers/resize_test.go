@@ -0,0 +1,143 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// refusingResizes refuses the strategic merge patches resizes are made
+// with, as an API server without in-place resize does.
+type refusingResizes struct {
+	client.Client
+}
+
+func (c refusingResizes) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() == types.StrategicMergePatchType {
+		return errors.NewInvalid(schema.GroupKind{Kind: "Pod"}, obj.GetName(),
+			field.ErrorList{field.Forbidden(field.NewPath("spec"), "pod updates may not change fields other than image")})
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// resizeTestPods returns pods rendered from the PodSet with the given CPU
+// request, and the PodSet requesting newCPU instead.
+func resizeTestPods(t *testing.T, cpu, newCPU string, names ...string) (*podsetv1alpha1.PodSet, []corev1.Pod) {
+	t.Helper()
+	podSet := testPodSet(int32(len(names)))
+	podSet.Spec.Resources = &corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}
+	var pods []corev1.Pod
+	for _, name := range names {
+		pod, err := newPodForCR(podSet, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pod.Name = name
+		pod.Status.Phase = corev1.PodRunning
+		pods = append(pods, *pod)
+	}
+	podSet.Spec.Resources.Requests[corev1.ResourceCPU] = resource.MustParse(newCPU)
+	return podSet, pods
+}
+
+func TestResizeInPlace(t *testing.T) {
+	podSet, pods := resizeTestPods(t, "100m", "200m", "web-a")
+	// A pod of another shape is left to the rollout.
+	other, err := newPodForCR(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Name = "web-b"
+	other.Labels[templateHashLabel] = "old"
+	other.Labels[templateShapeLabel] = "old"
+	pods = append(pods, *other)
+	r := rolloutTestReconciler(t, podSet, pods)
+	r.InPlaceResize = true
+	status := &podsetv1alpha1.PodSetStatus{}
+	state := &podSetState{available: pods}
+
+	if err := r.resizeInPlace(context.Background(), podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if want := (podsetv1alpha1.InPlaceResizeStatus{Resized: 1}); status.InPlaceResize == nil || *status.InPlaceResize != want {
+		t.Errorf("inPlaceResize = %+v, want %+v", status.InPlaceResize, want)
+	}
+	hash, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "web-a"}, pod); err != nil {
+		t.Fatal(err)
+	}
+	if cpu := pod.Spec.Containers[0].Resources.Requests.Cpu(); cpu.String() != "200m" {
+		t.Errorf("web-a requests %s CPU, want 200m", cpu)
+	}
+	if pod.Labels[templateHashLabel] != hash || pod.Annotations[resizedAnnotation] != hash {
+		t.Errorf("web-a labels %v and annotations %v, want it marked as resized to %s", pod.Labels, pod.Annotations, hash)
+	}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "web-b"}, pod); err != nil {
+		t.Fatal(err)
+	}
+	if pod.Labels[templateHashLabel] != "old" {
+		t.Errorf("web-b template hash = %s, want it left to the rollout", pod.Labels[templateHashLabel])
+	}
+}
+
+func TestResizeInPlaceInfeasible(t *testing.T) {
+	podSet, pods := resizeTestPods(t, "100m", "200m", "web-a")
+	r := rolloutTestReconciler(t, podSet, pods)
+	r.Client = refusingResizes{r.Client}
+	r.InPlaceResize = true
+	status := &podsetv1alpha1.PodSetStatus{}
+	state := &podSetState{available: pods}
+
+	if err := r.resizeInPlace(context.Background(), podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if want := (podsetv1alpha1.InPlaceResizeStatus{Infeasible: 1}); status.InPlaceResize == nil || *status.InPlaceResize != want {
+		t.Errorf("inPlaceResize = %+v, want %+v", status.InPlaceResize, want)
+	}
+	hash, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.available[0].Annotations[resizeInfeasibleAnnotation] != hash {
+		t.Errorf("web-a annotations = %v, want it marked infeasible for %s", state.available[0].Annotations, hash)
+	}
+
+	// The pod is not tried again.
+	r.Client = refusingResizes{}
+	status = &podsetv1alpha1.PodSetStatus{}
+	if err := r.resizeInPlace(context.Background(), podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if status.InPlaceResize.Infeasible != 1 {
+		t.Errorf("inPlaceResize = %+v on the next pass, want the pod still counted infeasible", status.InPlaceResize)
+	}
+}
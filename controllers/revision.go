@@ -0,0 +1,302 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// revisionPodSetLabel holds the name of the PodSet a ControllerRevision
+	// belongs to.
+	revisionPodSetLabel = "podset.example.com/podset"
+
+	reasonRollbackRevisionNotFound = "RollbackRevisionNotFound"
+
+	// revisionHistoryLimit is the number of ControllerRevisions kept for
+	// each PodSet.
+	revisionHistoryLimit = 10
+)
+
+// templateFields are the parts of a PodSet's spec its pod template is
+// rendered from, as recorded in a ControllerRevision.
+type templateFields struct {
+	Template          *corev1.PodTemplateSpec                    `json:"template,omitempty"`
+	Resources         *corev1.ResourceRequirements               `json:"resources,omitempty"`
+	PullSecrets       []corev1.LocalObjectReference              `json:"imagePullSecrets,omitempty"`
+	ContainerEnv      []podsetv1alpha1.ContainerEnvSpec          `json:"containerEnv,omitempty"`
+	Volumes           []corev1.Volume                            `json:"volumes,omitempty"`
+	VolumeMounts      []podsetv1alpha1.ContainerVolumeMountsSpec `json:"volumeMounts,omitempty"`
+	Probes            []podsetv1alpha1.ContainerProbesSpec       `json:"probes,omitempty"`
+	NodeSelector      map[string]string                          `json:"nodeSelector,omitempty"`
+	Affinity          *corev1.Affinity                           `json:"affinity,omitempty"`
+	Tolerations       []corev1.Toleration                        `json:"tolerations,omitempty"`
+	Spread            []corev1.TopologySpreadConstraint          `json:"topologySpreadConstraints,omitempty"`
+	AntiAffinity      podsetv1alpha1.DefaultAntiAffinityType     `json:"defaultAntiAffinity,omitempty"`
+	SecurityContext   *corev1.PodSecurityContext                 `json:"securityContext,omitempty"`
+	ContainerSecurity *corev1.SecurityContext                    `json:"containerSecurityContext,omitempty"`
+	GracePeriod       *int64                                     `json:"terminationGracePeriodSeconds,omitempty"`
+	HostNetwork       bool                                       `json:"hostNetwork,omitempty"`
+	DNSPolicy         corev1.DNSPolicy                           `json:"dnsPolicy,omitempty"`
+	DNSConfig         *corev1.PodDNSConfig                       `json:"dnsConfig,omitempty"`
+	RuntimeClassName  *string                                    `json:"runtimeClassName,omitempty"`
+	PriorityClassName string                                     `json:"priorityClassName,omitempty"`
+	PodOverrides      *runtime.RawExtension                      `json:"podOverrides,omitempty"`
+	ServiceAccount    *podsetv1alpha1.ServiceAccountSpec         `json:"serviceAccount,omitempty"`
+	PerPodConfig      *podsetv1alpha1.PerPodConfigSpec           `json:"perPodConfig,omitempty"`
+	ClassName         string                                     `json:"className,omitempty"`
+	ColocateWith      []podsetv1alpha1.PodSetAffinityTerm        `json:"colocateWith,omitempty"`
+	Avoid             []podsetv1alpha1.PodSetAffinityTerm        `json:"avoid,omitempty"`
+	SafeToEvict       *bool                                      `json:"safeToEvict,omitempty"`
+}
+
+// revisionName returns the name of the ControllerRevision that records the
+// PodSet's pod template with the given hash.
+func revisionName(podSet *podsetv1alpha1.PodSet, hash string) string {
+	return podSet.Name + "-" + hash
+}
+
+// listRevisions returns the ControllerRevisions recorded for the PodSet.
+func (r *PodSetReconciler) listRevisions(ctx context.Context, podSet *podsetv1alpha1.PodSet) ([]appsv1.ControllerRevision, error) {
+	revisions := &appsv1.ControllerRevisionList{}
+	if err := r.List(ctx, revisions, client.InNamespace(podSet.Namespace), client.MatchingLabels{revisionPodSetLabel: podSet.Name}); err != nil {
+		return nil, err
+	}
+	return revisions.Items, nil
+}
+
+// ensureRevision records the PodSet's current pod template, with the given
+// hash, in a ControllerRevision, and prunes the oldest revisions beyond
+// revisionHistoryLimit. The current template always has the highest
+// revision number: returning to an earlier template renumbers its
+// revision.
+func (r *PodSetReconciler) ensureRevision(ctx context.Context, podSet *podsetv1alpha1.PodSet, hash string) error {
+	revisions, err := r.listRevisions(ctx, podSet)
+	if err != nil {
+		return err
+	}
+	name := revisionName(podSet, hash)
+	var next int64 = 1
+	var existing *appsv1.ControllerRevision
+	for i := range revisions {
+		if revisions[i].Name == name {
+			existing = &revisions[i]
+			continue
+		}
+		if revisions[i].Revision >= next {
+			next = revisions[i].Revision + 1
+		}
+	}
+	if existing != nil {
+		if existing.Revision >= next {
+			return nil
+		}
+		existing.Revision = next
+		return r.Update(ctx, existing)
+	}
+
+	data, err := json.Marshal(templateFields{
+		Template:          podSet.Spec.Template,
+		Resources:         podSet.Spec.Resources,
+		PullSecrets:       podSet.Spec.ImagePullSecrets,
+		ContainerEnv:      podSet.Spec.ContainerEnv,
+		Volumes:           podSet.Spec.Volumes,
+		VolumeMounts:      podSet.Spec.VolumeMounts,
+		Probes:            podSet.Spec.Probes,
+		NodeSelector:      podSet.Spec.NodeSelector,
+		Affinity:          podSet.Spec.Affinity,
+		Tolerations:       podSet.Spec.Tolerations,
+		Spread:            podSet.Spec.TopologySpreadConstraints,
+		AntiAffinity:      podSet.Spec.DefaultAntiAffinity,
+		SecurityContext:   podSet.Spec.SecurityContext,
+		ContainerSecurity: podSet.Spec.ContainerSecurityContext,
+		GracePeriod:       podSet.Spec.TerminationGracePeriodSeconds,
+		HostNetwork:       podSet.Spec.HostNetwork,
+		DNSPolicy:         podSet.Spec.DNSPolicy,
+		DNSConfig:         podSet.Spec.DNSConfig,
+		RuntimeClassName:  podSet.Spec.RuntimeClassName,
+		PriorityClassName: podSet.Spec.PriorityClassName,
+		PodOverrides:      podSet.Spec.PodOverrides,
+		ServiceAccount:    podSet.Spec.ServiceAccount,
+		PerPodConfig:      podSet.Spec.PerPodConfig,
+		ClassName:         podSet.Spec.ClassName,
+		ColocateWith:      podSet.Spec.ColocateWith,
+		Avoid:             podSet.Spec.Avoid,
+		SafeToEvict:       podSet.Spec.SafeToEvict,
+	})
+	if err != nil {
+		return err
+	}
+	revision := &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: podSet.Namespace,
+			Labels:    map[string]string{revisionPodSetLabel: podSet.Name},
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: next,
+	}
+	if err := controllerutil.SetControllerReference(podSet, revision, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, revision); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	old := revisions
+	if excess := len(old) + 1 - revisionHistoryLimit; excess > 0 {
+		sort.Slice(old, func(i, j int) bool { return old[i].Revision < old[j].Revision })
+		for i := 0; i < excess && i < len(old); i++ {
+			if err := r.Delete(ctx, &old[i]); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// revisionFor returns the revision recorded for the given hash of the
+// PodSet's pod template, or nil if none is.
+func (r *PodSetReconciler) revisionFor(ctx context.Context, podSet *podsetv1alpha1.PodSet, hash string) (*appsv1.ControllerRevision, error) {
+	revision := &appsv1.ControllerRevision{}
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: revisionName(podSet, hash)}
+	if err := r.Get(ctx, key, revision); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return revision, nil
+}
+
+// applyRevision sets the PodSet's pod template fields to those recorded in
+// the revision.
+func applyRevision(podSet *podsetv1alpha1.PodSet, revision *appsv1.ControllerRevision) error {
+	fields := templateFields{}
+	if err := json.Unmarshal(revision.Data.Raw, &fields); err != nil {
+		return err
+	}
+	podSet.Spec.Template = fields.Template
+	podSet.Spec.Resources = fields.Resources
+	podSet.Spec.ImagePullSecrets = fields.PullSecrets
+	podSet.Spec.ContainerEnv = fields.ContainerEnv
+	podSet.Spec.Volumes = fields.Volumes
+	podSet.Spec.VolumeMounts = fields.VolumeMounts
+	podSet.Spec.Probes = fields.Probes
+	podSet.Spec.NodeSelector = fields.NodeSelector
+	podSet.Spec.Affinity = fields.Affinity
+	podSet.Spec.Tolerations = fields.Tolerations
+	podSet.Spec.TopologySpreadConstraints = fields.Spread
+	podSet.Spec.DefaultAntiAffinity = fields.AntiAffinity
+	podSet.Spec.SecurityContext = fields.SecurityContext
+	podSet.Spec.ContainerSecurityContext = fields.ContainerSecurity
+	podSet.Spec.TerminationGracePeriodSeconds = fields.GracePeriod
+	podSet.Spec.HostNetwork = fields.HostNetwork
+	podSet.Spec.DNSPolicy = fields.DNSPolicy
+	podSet.Spec.DNSConfig = fields.DNSConfig
+	podSet.Spec.RuntimeClassName = fields.RuntimeClassName
+	podSet.Spec.PriorityClassName = fields.PriorityClassName
+	podSet.Spec.PodOverrides = fields.PodOverrides
+	podSet.Spec.ServiceAccount = fields.ServiceAccount
+	podSet.Spec.PerPodConfig = fields.PerPodConfig
+	podSet.Spec.ClassName = fields.ClassName
+	podSet.Spec.ColocateWith = fields.ColocateWith
+	podSet.Spec.Avoid = fields.Avoid
+	podSet.Spec.SafeToEvict = fields.SafeToEvict
+	return nil
+}
+
+// rollBackTo handles spec.rollbackTo: it restores the pod template fields
+// recorded in the requested revision, or the one before the current
+// template for revision zero, and clears the request. A revision that is not
+// recorded is reported in an event and the request is dropped.
+func (r *PodSetReconciler) rollBackTo(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	log := ctrllog.FromContext(ctx)
+	revisions, err := r.listRevisions(ctx, podSet)
+	if err != nil {
+		return err
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision > revisions[j].Revision })
+
+	decided, generation := *podSet.Spec.RollbackTo, podSet.Generation
+	// unchanged re-checks, on a conflict retry, that the fresh PodSet still
+	// asks for the rollback decided on here and that its spec, and so the
+	// revision the rollback restores over, was not edited meanwhile.
+	unchanged := func(podSet *podsetv1alpha1.PodSet) error {
+		if podSet.Spec.RollbackTo == nil || *podSet.Spec.RollbackTo != decided || podSet.Generation != generation {
+			return errPodSetChanged
+		}
+		return nil
+	}
+	wanted := decided.Revision
+	var target *appsv1.ControllerRevision
+	for i := range revisions {
+		if (wanted == 0 && i == 1) || (wanted != 0 && revisions[i].Revision == wanted) {
+			target = &revisions[i]
+			break
+		}
+	}
+	if target == nil {
+		log.Info("Revision to roll back to is not recorded", "revision", wanted)
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonRollbackRevisionNotFound,
+			fmt.Sprintf("Revision %d to roll back to is not recorded; the rollback was dropped", wanted))
+		err := r.updatePodSet(ctx, podSet, func(podSet *podsetv1alpha1.PodSet) error {
+			if err := unchanged(podSet); err != nil {
+				return err
+			}
+			podSet.Spec.RollbackTo = nil
+			return nil
+		})
+		if err == errPodSetChanged {
+			return nil
+		}
+		return err
+	}
+	log.Info("Rolling back to revision", "revision", target.Revision)
+	err = r.updatePodSet(ctx, podSet, func(podSet *podsetv1alpha1.PodSet) error {
+		if err := unchanged(podSet); err != nil {
+			return err
+		}
+		podSet.Spec.RollbackTo = nil
+		return applyRevision(podSet, target)
+	})
+	if err == errPodSetChanged {
+		log.Info("Rollback request changed before it was applied", "revision", target.Revision)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.Recorder.Event(podSet, corev1.EventTypeNormal, reasonRolledBack,
+		fmt.Sprintf("Rolled back the pod template to revision %d", target.Revision))
+	return nil
+}
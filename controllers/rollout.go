@@ -0,0 +1,323 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// templateHashLabel holds the hash of the pod template a pod was
+	// created from.
+	templateHashLabel = "podset.example.com/template-hash"
+
+	// approveBatchAnnotation is set, or changed, on a PodSet to approve the
+	// next batch of a rolling update that requires approval.
+	approveBatchAnnotation = "podset.example.com/approve-batch"
+
+	// forceRolloutAnnotation, while set on a PodSet, skips the
+	// verification of a progressive rollout.
+	forceRolloutAnnotation = "podset.example.com/force-rollout"
+
+	reasonBatchCompleted      = "BatchCompleted"
+	reasonRolledBack          = "RolledBack"
+	reasonRollbackUnavailable = "RollbackUnavailable"
+)
+
+// podTemplateHash returns a short, label-safe hash of the pod template.
+func podTemplateHash(template *corev1.Pod) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return utilrand.SafeEncodeString(fmt.Sprint(hasher.Sum32())), nil
+}
+
+// currentTemplateHash returns the hash of the PodSet's current pod template.
+func currentTemplateHash(podSet *podsetv1alpha1.PodSet, inputs *templateInputs) (string, error) {
+	template, err := podTemplate(podSet, inputs)
+	if err != nil {
+		return "", err
+	}
+	return podTemplateHash(template)
+}
+
+// rollingUpdateStrategy returns the PodSet's rolling update strategy, which
+// defaults to batches of one pod, or nil if outdated pods are left running.
+func rollingUpdateStrategy(podSet *podsetv1alpha1.PodSet) *podsetv1alpha1.RollingUpdatePodSetStrategy {
+	if podSet.Spec.UpdateStrategy.Type == podsetv1alpha1.OnDeletePodSetStrategyType {
+		return nil
+	}
+	if podSet.Spec.UpdateStrategy.RollingUpdate == nil {
+		return &podsetv1alpha1.RollingUpdatePodSetStrategy{}
+	}
+	return podSet.Spec.UpdateStrategy.RollingUpdate
+}
+
+// reconcileRollout replaces pods created from an outdated pod template, a
+// batch at a time, once the PodSet is at its desired size. A batch is
+// complete when every updated pod is Ready and, for a progressive rollout,
+// has stayed healthy through the observation window. When the strategy
+// requires approval, each batch after the first waits for the approve-batch
+// annotation to change.
+func (r *PodSetReconciler) reconcileRollout(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	failed := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionRolloutFailed)
+	if failed != nil && failed.ObservedGeneration < podSet.Generation {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionRolloutFailed)
+		failed = nil
+	}
+	hash, err := currentTemplateHash(podSet, &state.inputs)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Every template is recorded so that spec.rollbackTo can return to it.
+	if err := r.ensureRevision(ctx, podSet, hash); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	strategy := rollingUpdateStrategy(podSet)
+	if strategy == nil {
+		status.Rollout = nil
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionAwaitingApproval)
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionRolloutFailed)
+		return ctrl.Result{}, nil
+	}
+	var updated, outdated []corev1.Pod
+	for _, pod := range state.available {
+		if pod.Labels[templateHashLabel] == hash {
+			updated = append(updated, pod)
+		} else {
+			outdated = append(outdated, pod)
+		}
+	}
+
+	rollout := status.Rollout
+	if rollout == nil || rollout.TemplateHash != hash {
+		// An approval given during an earlier rollout does not carry over.
+		rollout = &podsetv1alpha1.RolloutStatus{
+			TemplateHash:         hash,
+			ApprovedBatch:        podSet.Annotations[approveBatchAnnotation],
+			PreviousTemplateHash: dominantTemplateHash(outdated),
+		}
+		status.Rollout = rollout
+	}
+
+	progressive := podSet.Spec.UpdateStrategy.Progressive
+	if failed != nil && failed.Reason == reasonRollbackUnavailable {
+		// The failed template could not be rolled back; hold the rollout
+		// until the spec is edited.
+		return ctrl.Result{}, nil
+	}
+	verify := progressive != nil && podSet.Annotations[forceRolloutAnnotation] == ""
+
+	if rollout.BatchInProgress && rollout.ObservationStartTime != nil {
+		if verify {
+			for _, pod := range state.failed {
+				if pod.Labels[templateHashLabel] == hash {
+					updated = append(updated, pod)
+				}
+			}
+			threshold := 1
+			if progressive.FailureThreshold > 0 {
+				threshold = int(progressive.FailureThreshold)
+			}
+			if failures := rolloutFailures(updated); failures >= threshold {
+				return r.rollBack(ctx, podSet, status, &state.inputs, failures)
+			}
+			remaining := progressive.ObservationWindow.Duration - time.Since(rollout.ObservationStartTime.Time)
+			if remaining > 0 {
+				return ctrl.Result{RequeueAfter: remaining}, nil
+			}
+		}
+		rollout.BatchesCompleted++
+		rollout.BatchInProgress = false
+		rollout.ObservationStartTime = nil
+	}
+
+	if int32(len(state.available)) < state.desired {
+		return ctrl.Result{}, nil
+	}
+	now := time.Now()
+	for i := range updated {
+		if wait := podAvailableIn(&updated[i], minReady(podSet), now); wait != 0 {
+			if wait < 0 {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+	if rollout.BatchInProgress {
+		if verify {
+			now := metav1.Now()
+			rollout.ObservationStartTime = &now
+			return ctrl.Result{Requeue: true, RequeueAfter: progressive.ObservationWindow.Duration}, nil
+		}
+		rollout.BatchesCompleted++
+		rollout.BatchInProgress = false
+	}
+
+	batchSize := 1
+	if strategy.BatchSize > 0 {
+		batchSize = int(strategy.BatchSize)
+	}
+	rollout.BatchesRemaining = int32((len(outdated) + batchSize - 1) / batchSize)
+	if len(outdated) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionAwaitingApproval)
+		return ctrl.Result{}, nil
+	}
+
+	approval := podSet.Annotations[approveBatchAnnotation]
+	if strategy.RequireApproval && rollout.BatchesCompleted > 0 && approval == rollout.ApprovedBatch {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:   podsetv1alpha1.ConditionAwaitingApproval,
+			Status: metav1.ConditionTrue,
+			Reason: reasonBatchCompleted,
+			Message: fmt.Sprintf("Batch %d of %d is complete; set the %s annotation to a new value to continue",
+				rollout.BatchesCompleted, rollout.BatchesCompleted+rollout.BatchesRemaining, approveBatchAnnotation),
+			ObservedGeneration: podSet.Generation,
+		})
+		return ctrl.Result{}, nil
+	}
+	meta.RemoveStatusCondition(&status.Conditions, podsetv1alpha1.ConditionAwaitingApproval)
+
+	batch := preferNonLeader(outdated, state.leader)
+	if len(batch) > batchSize {
+		batch = batch[:batchSize]
+	}
+	rollout.ApprovedBatch = approval
+	rollout.BatchInProgress = true
+	log.Info("Replacing outdated pods", "batch", rollout.BatchesCompleted+1, "pods", len(batch))
+	for _, pod := range batch {
+		if err := r.Delete(ctx, &pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete pod", "pod.name", pod.Name)
+			r.podDeleteFailed(podSet, &pod, err)
+			return ctrl.Result{}, err
+		}
+		r.podDeleted(podSet, state, &pod, podsetv1alpha1.TemplateRolloutDeletion)
+		state.available = removePod(state.available, pod.Name)
+	}
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// dominantTemplateHash returns the template hash shared by most of the pods.
+func dominantTemplateHash(pods []corev1.Pod) string {
+	counts := map[string]int{}
+	var dominant string
+	for _, pod := range pods {
+		hash := pod.Labels[templateHashLabel]
+		if hash == "" {
+			continue
+		}
+		counts[hash]++
+		if counts[hash] > counts[dominant] || (counts[hash] == counts[dominant] && hash < dominant) {
+			dominant = hash
+		}
+	}
+	return dominant
+}
+
+// rolloutFailures counts the failures of updated pods under observation:
+// container and init container restarts, Failed pods, and pods that are not Ready, which during
+// the window means they lost readiness after the batch completed.
+func rolloutFailures(pods []corev1.Pod) int {
+	failures := 0
+	for i := range pods {
+		pod := &pods[i]
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			failures += int(cs.RestartCount)
+		}
+		if pod.Status.Phase == corev1.PodFailed || !isPodReady(pod) {
+			failures++
+		}
+	}
+	return failures
+}
+
+// rollBack reverts the PodSet's pod template to the one the failed rollout
+// replaced and records the failure in the RolloutFailed condition. The
+// reverted spec is then rolled out like any other change. The rollback is
+// given up if the template was edited since the rollout failed.
+func (r *PodSetReconciler) rollBack(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, inputs *templateInputs, failures int) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	rollout := status.Rollout
+	var revision *appsv1.ControllerRevision
+	if rollout.PreviousTemplateHash != "" {
+		var err error
+		revision, err = r.revisionFor(ctx, podSet, rollout.PreviousTemplateHash)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if revision == nil {
+		log.Info("Rollout failed verification and has no revision to roll back to", "failures", failures)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionRolloutFailed,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonRollbackUnavailable,
+			Message:            fmt.Sprintf("Updated pods had %d failures and no previous revision is recorded; the rollout is paused", failures),
+			ObservedGeneration: podSet.Generation,
+		})
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Rolling back failed rollout", "failures", failures, "revision", rollout.PreviousTemplateHash)
+	err := r.updatePodSet(ctx, podSet, func(podSet *podsetv1alpha1.PodSet) error {
+		hash, err := currentTemplateHash(podSet, inputs)
+		if err != nil {
+			return err
+		}
+		if hash != rollout.TemplateHash {
+			return errPodSetChanged
+		}
+		return applyRevision(podSet, revision)
+	})
+	if err == errPodSetChanged {
+		log.Info("Template changed since the rollout failed; not rolling back")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionRolloutFailed,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonRolledBack,
+		Message:            fmt.Sprintf("Updated pods had %d failures; rolled back to revision %s", failures, rollout.PreviousTemplateHash),
+		ObservedGeneration: podSet.Generation,
+	})
+	status.Rollout = nil
+	return ctrl.Result{Requeue: true}, nil
+}
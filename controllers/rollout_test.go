@@ -0,0 +1,255 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// rolloutTestPods returns ready pods created from the template with the
+// given hash.
+func rolloutTestPods(hash string, names ...string) []corev1.Pod {
+	var pods []corev1.Pod
+	for _, name := range names {
+		pod := leaderTestPod(name, time.Hour, true, false)
+		pod.Labels[templateHashLabel] = hash
+		pods = append(pods, *pod)
+	}
+	return pods
+}
+
+func rolloutTestReconciler(t *testing.T, podSet *podsetv1alpha1.PodSet, pods []corev1.Pod) *PodSetReconciler {
+	t.Helper()
+	objs := []client.Object{podSet}
+	for i := range pods {
+		objs = append(objs, &pods[i])
+	}
+	return newTestReconciler(t, objs...)
+}
+
+func TestReconcileRolloutBatchesWithApproval(t *testing.T) {
+	podSet := testPodSet(3)
+	podSet.Spec.UpdateStrategy.RollingUpdate = &podsetv1alpha1.RollingUpdatePodSetStrategy{BatchSize: 2, RequireApproval: true}
+	hash, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outdated := rolloutTestPods("old", "web-a", "web-b", "web-c")
+	r := rolloutTestReconciler(t, podSet, outdated)
+	status := &podsetv1alpha1.PodSetStatus{}
+	ctx := context.Background()
+
+	// The first batch needs no approval.
+	state := &podSetState{available: outdated, desired: 3}
+	if _, err := r.reconcileRollout(ctx, podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.deleted) != 2 || status.Rollout == nil || !status.Rollout.BatchInProgress {
+		t.Fatalf("deleted %v with rollout %+v, want the first batch of 2 in progress", state.deleted, status.Rollout)
+	}
+	if status.Rollout.PreviousTemplateHash != "old" || status.Rollout.BatchesRemaining != 2 {
+		t.Errorf("rollout = %+v, want it to replace template old in 2 batches", status.Rollout)
+	}
+
+	// Once the batch is ready, the next one waits for approval.
+	state = &podSetState{available: append(rolloutTestPods(hash, "web-d", "web-e"), outdated[2]), desired: 3}
+	if _, err := r.reconcileRollout(ctx, podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionAwaitingApproval)
+	if len(state.deleted) != 0 || cond == nil || cond.Reason != reasonBatchCompleted {
+		t.Fatalf("deleted %v with AwaitingApproval %+v, want the rollout held for approval", state.deleted, cond)
+	}
+	if status.Rollout.BatchesCompleted != 1 || status.Rollout.BatchesRemaining != 1 {
+		t.Errorf("rollout = %+v, want 1 batch completed and 1 remaining", status.Rollout)
+	}
+
+	// Approving releases the last batch.
+	podSet.Annotations = map[string]string{approveBatchAnnotation: "1"}
+	if _, err := r.reconcileRollout(ctx, podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.deleted) != 1 || state.deleted[0].Name != "web-c" {
+		t.Errorf("deleted %v, want web-c", state.deleted)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionAwaitingApproval); cond != nil {
+		t.Errorf("AwaitingApproval = %+v after approval, want it removed", cond)
+	}
+}
+
+func TestReconcileRolloutWaitsForReadyBatch(t *testing.T) {
+	podSet := testPodSet(2)
+	hash, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := rolloutTestPods(hash, "web-new")
+	updated[0].Status.Conditions = nil
+	pods := append(updated, rolloutTestPods("old", "web-old")...)
+	r := rolloutTestReconciler(t, podSet, pods)
+	status := &podsetv1alpha1.PodSetStatus{Rollout: &podsetv1alpha1.RolloutStatus{TemplateHash: hash, BatchInProgress: true}}
+
+	state := &podSetState{available: pods, desired: 2}
+	if _, err := r.reconcileRollout(context.Background(), podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.deleted) != 0 || !status.Rollout.BatchInProgress {
+		t.Errorf("deleted %v with rollout %+v, want the batch held until its pod is ready", state.deleted, status.Rollout)
+	}
+}
+
+func TestReconcileRolloutOnDelete(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.UpdateStrategy.Type = podsetv1alpha1.OnDeletePodSetStrategyType
+	pods := rolloutTestPods("old", "web-old")
+	r := rolloutTestReconciler(t, podSet, pods)
+	status := &podsetv1alpha1.PodSetStatus{}
+
+	state := &podSetState{available: pods, desired: 1}
+	if _, err := r.reconcileRollout(context.Background(), podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.deleted) != 0 || status.Rollout != nil {
+		t.Errorf("deleted %v with rollout %+v, want outdated pods left alone", state.deleted, status.Rollout)
+	}
+}
+
+func progressiveTestPodSet(image string) *podsetv1alpha1.PodSet {
+	podSet := testPodSet(1)
+	podSet.Spec.UpdateStrategy.Progressive = &podsetv1alpha1.ProgressiveRolloutStrategy{
+		ObservationWindow: metav1.Duration{Duration: time.Minute},
+		FailureThreshold:  2,
+	}
+	podSet.Spec.Template = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "app", Image: image}},
+	}}
+	return podSet
+}
+
+// observedRollout returns the rollout of the PodSet's current template from
+// template previous, with its one batch under observation since started.
+func observedRollout(t *testing.T, podSet *podsetv1alpha1.PodSet, previous string, started time.Time) *podsetv1alpha1.RolloutStatus {
+	t.Helper()
+	hash, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &podsetv1alpha1.RolloutStatus{
+		TemplateHash:         hash,
+		PreviousTemplateHash: previous,
+		BatchInProgress:      true,
+		ObservationStartTime: &metav1.Time{Time: started},
+	}
+}
+
+func TestReconcileRolloutRollsBackFailedRollout(t *testing.T) {
+	podSet := progressiveTestPodSet("app:v1")
+	previous, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestReconciler(t, podSet)
+	ctx := context.Background()
+	if err := r.ensureRevision(ctx, podSet, previous); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(podSet), podSet); err != nil {
+		t.Fatal(err)
+	}
+	podSet.Spec.Template.Spec.Containers[0].Image = "app:v2"
+	if err := r.Update(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+
+	rollout := observedRollout(t, podSet, previous, time.Now())
+	pods := rolloutTestPods(rollout.TemplateHash, "web-new")
+	pods[0].Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", RestartCount: 2}}
+	status := &podsetv1alpha1.PodSetStatus{Rollout: rollout}
+	state := &podSetState{available: pods, desired: 1}
+	if _, err := r.reconcileRollout(ctx, podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionRolloutFailed)
+	if cond == nil || cond.Reason != reasonRolledBack || status.Rollout != nil {
+		t.Fatalf("RolloutFailed = %+v with rollout %+v, want the rollout rolled back", cond, status.Rollout)
+	}
+	got := &podsetv1alpha1.PodSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(podSet), got); err != nil {
+		t.Fatal(err)
+	}
+	if image := got.Spec.Template.Spec.Containers[0].Image; image != "app:v1" {
+		t.Errorf("template image = %s, want app:v1 restored", image)
+	}
+}
+
+func TestReconcileRolloutObservesBatch(t *testing.T) {
+	podSet := progressiveTestPodSet("app:v2")
+	r := newTestReconciler(t, podSet)
+	ctx := context.Background()
+
+	// Healthy pods inside the window are watched until it ends.
+	rollout := observedRollout(t, podSet, "old", time.Now().Add(-30*time.Second))
+	status := &podsetv1alpha1.PodSetStatus{Rollout: rollout}
+	state := &podSetState{available: rolloutTestPods(rollout.TemplateHash, "web-new"), desired: 1}
+	result, err := r.reconcileRollout(ctx, podSet, status, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > 30*time.Second || !rollout.BatchInProgress {
+		t.Errorf("result %+v with rollout %+v, want the batch observed for the rest of the window", result, rollout)
+	}
+
+	// Failures below the threshold do not roll back.
+	rollout.ObservationStartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}
+	state.available[0].Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", RestartCount: 1}}
+	if _, err := r.reconcileRollout(ctx, podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	if rollout.BatchInProgress || rollout.BatchesCompleted != 1 {
+		t.Errorf("rollout = %+v, want the batch completed once the window passed", rollout)
+	}
+}
+
+func TestReconcileRolloutWithoutRevisionPauses(t *testing.T) {
+	podSet := progressiveTestPodSet("app:v2")
+	r := newTestReconciler(t, podSet)
+	rollout := observedRollout(t, podSet, "missing", time.Now())
+	failed := rolloutTestPods(rollout.TemplateHash, "web-new-0", "web-new-1")
+	for i := range failed {
+		failed[i].Status.Phase = corev1.PodFailed
+	}
+	status := &podsetv1alpha1.PodSetStatus{Rollout: rollout}
+
+	state := &podSetState{failed: failed, desired: 1}
+	if _, err := r.reconcileRollout(context.Background(), podSet, status, state); err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionRolloutFailed)
+	if cond == nil || cond.Reason != reasonRollbackUnavailable {
+		t.Errorf("RolloutFailed = %+v, want reason %s", cond, reasonRollbackUnavailable)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/utils/pointer"
+)
+
+func TestPodTemplateSafeToEvict(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		safeToEvict *bool
+		want        string
+		annotated   bool
+	}{
+		{name: "unset"},
+		{name: "true", safeToEvict: pointer.Bool(true), want: "true", annotated: true},
+		{name: "false", safeToEvict: pointer.Bool(false), want: "false", annotated: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			podSet := testPodSet(1)
+			podSet.Spec.SafeToEvict = tc.safeToEvict
+			pod, err := podTemplate(podSet, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, annotated := pod.Annotations[safeToEvictAnnotation]
+			if annotated != tc.annotated || value != tc.want {
+				t.Errorf("%s annotation = %q (set %v), want %q (set %v)", safeToEvictAnnotation, value, annotated, tc.want, tc.annotated)
+			}
+		})
+	}
+}
+
+func TestSafeToEvictChangesTemplateHash(t *testing.T) {
+	podSet := testPodSet(1)
+	before, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podSet.Spec.SafeToEvict = pointer.Bool(false)
+	after, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Errorf("template hash unchanged by safeToEvict, want the pods rolled out with the annotation")
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// drainingLabel marks a pod chosen for scale-down while it drains.
+	drainingLabel = "podset.example.com/draining"
+	// drainingSinceAnnotation records when a pod started draining, so that
+	// the drain survives controller restarts.
+	drainingSinceAnnotation = "podset.example.com/draining-since"
+)
+
+// scaleDownDrain returns how long pods chosen for scale-down drain before
+// they are removed.
+func scaleDownDrain(podSet *podsetv1alpha1.PodSet) time.Duration {
+	if podSet.Spec.ScaleDown == nil {
+		return 0
+	}
+	return time.Duration(podSet.Spec.ScaleDown.DrainSeconds) * time.Second
+}
+
+// isDraining reports whether the pod is draining before scale-down.
+func isDraining(pod *corev1.Pod) bool {
+	return pod.Labels[drainingLabel] == "true"
+}
+
+// drainingFirst orders the pods with those already draining first, so that a
+// drain in progress is finished rather than started over on another pod.
+func drainingFirst(pods []corev1.Pod) []corev1.Pod {
+	ordered := make([]corev1.Pod, 0, len(pods))
+	var rest []corev1.Pod
+	for _, pod := range pods {
+		if isDraining(&pod) {
+			ordered = append(ordered, pod)
+		} else {
+			rest = append(rest, pod)
+		}
+	}
+	return append(ordered, rest...)
+}
+
+// drainVictims starts draining the victims that are not draining yet and
+// cancels the drain of available pods that are no longer victims. It returns
+// the victims that have drained for the PodSet's drain delay and how long
+// until the next one has.
+func (r *PodSetReconciler) drainVictims(ctx context.Context, podSet *podsetv1alpha1.PodSet, available, victims []corev1.Pod) ([]corev1.Pod, time.Duration, error) {
+	log := ctrllog.FromContext(ctx)
+	delay := scaleDownDrain(podSet)
+	isVictim := map[string]bool{}
+	var (
+		drained []corev1.Pod
+		wait    time.Duration
+	)
+	for i := range victims {
+		pod := &victims[i]
+		isVictim[pod.Name] = true
+		since, err := time.Parse(time.RFC3339, pod.Annotations[drainingSinceAnnotation])
+		if !isDraining(pod) || err != nil {
+			log.Info("Draining pod before scale-down", "pod.name", pod.Name, "drain", delay)
+			if err := r.setDraining(ctx, pod, true); err != nil {
+				return nil, 0, err
+			}
+			if wait == 0 || delay < wait {
+				wait = delay
+			}
+			continue
+		}
+		remaining := delay - time.Since(since)
+		if remaining <= 0 {
+			drained = append(drained, *pod)
+			continue
+		}
+		if wait == 0 || remaining < wait {
+			wait = remaining
+		}
+	}
+	for i := range available {
+		pod := &available[i]
+		if isDraining(pod) && !isVictim[pod.Name] {
+			log.Info("Cancelling drain of pod no longer chosen for scale-down", "pod.name", pod.Name)
+			if err := r.setDraining(ctx, pod, false); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return drained, wait, nil
+}
+
+// setDraining labels the pod as draining from now, or removes the label.
+func (r *PodSetReconciler) setDraining(ctx context.Context, pod *corev1.Pod, draining bool) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	if draining {
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Labels[drainingLabel] = "true"
+		pod.Annotations[drainingSinceAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	} else {
+		delete(pod.Labels, drainingLabel)
+		delete(pod.Annotations, drainingSinceAnnotation)
+	}
+	if err := r.Patch(ctx, pod, patch); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func drainingTestPod(name string, since time.Duration) corev1.Pod {
+	pod := rolloutTestPods("hash", name)[0]
+	pod.Labels[drainingLabel] = "true"
+	pod.Annotations = map[string]string{drainingSinceAnnotation: time.Now().Add(-since).UTC().Format(time.RFC3339)}
+	return pod
+}
+
+func TestDrainVictims(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.ScaleDown = &podsetv1alpha1.ScaleDownSpec{DrainSeconds: 60}
+	fresh := rolloutTestPods("hash", "web-fresh")[0]
+	draining := drainingTestPod("web-draining", 20*time.Second)
+	drained := drainingTestPod("web-drained", 2*time.Minute)
+	spared := drainingTestPod("web-spared", 20*time.Second)
+	available := []corev1.Pod{fresh, draining, drained, spared}
+	r := rolloutTestReconciler(t, podSet, available)
+	ctx := context.Background()
+
+	done, wait, err := r.drainVictims(ctx, podSet, available, []corev1.Pod{fresh, draining, drained})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Name != "web-drained" {
+		t.Errorf("drained = %v, want only web-drained", done)
+	}
+	if wait <= 30*time.Second || wait > 40*time.Second {
+		t.Errorf("wait = %s, want about 40s until web-draining has drained", wait)
+	}
+
+	for name, want := range map[string]bool{"web-fresh": true, "web-spared": false} {
+		pod := &corev1.Pod{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, pod); err != nil {
+			t.Fatal(err)
+		}
+		_, since := pod.Annotations[drainingSinceAnnotation]
+		if isDraining(pod) != want || since != want {
+			t.Errorf("%s draining = %v, want %v", name, isDraining(pod), want)
+		}
+	}
+}
+
+func TestDrainingFirst(t *testing.T) {
+	pods := []corev1.Pod{rolloutTestPods("hash", "web-a")[0], drainingTestPod("web-b", 0)}
+	if ordered := drainingFirst(pods); ordered[0].Name != "web-b" {
+		t.Errorf("first pod = %s, want the draining web-b", ordered[0].Name)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// orderForScaleDown returns pods in the order spec.scaleDownPolicy removes
+// them, first to go first. Without a policy they keep their listed order.
+// The pods of an Ordered PodSet go from the highest ordinal down.
+func orderForScaleDown(podSet *podsetv1alpha1.PodSet, pods []corev1.Pod) []corev1.Pod {
+	ordered := append([]corev1.Pod(nil), pods...)
+	if isOrdered(podSet) {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return scaleDownRank(podSet, &ordered[i]) > scaleDownRank(podSet, &ordered[j])
+		})
+		return ordered
+	}
+	switch podSet.Spec.ScaleDownPolicy {
+	case podsetv1alpha1.RandomScaleDownPolicy:
+		rand.Shuffle(len(ordered), func(i, j int) {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		})
+	case podsetv1alpha1.NewestScaleDownPolicy:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return olderPod(&ordered[j], &ordered[i])
+		})
+	case podsetv1alpha1.OldestScaleDownPolicy:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return olderPod(&ordered[i], &ordered[j])
+		})
+	case podsetv1alpha1.LeastReadyScaleDownPolicy:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return lessReady(&ordered[i], &ordered[j])
+		})
+	}
+	return ordered
+}
+
+// lessReady reports whether a should be removed before b under the
+// LeastReady policy: unscheduled before scheduled, pending before running,
+// not Ready before Ready, and then Ready for less time before Ready for
+// longer.
+func lessReady(a, b *corev1.Pod) bool {
+	if (a.Spec.NodeName == "") != (b.Spec.NodeName == "") {
+		return a.Spec.NodeName == ""
+	}
+	if (a.Status.Phase == corev1.PodRunning) != (b.Status.Phase == corev1.PodRunning) {
+		return a.Status.Phase != corev1.PodRunning
+	}
+	if isPodReady(a) != isPodReady(b) {
+		return !isPodReady(a)
+	}
+	if !isPodReady(a) {
+		return false
+	}
+	readyA, readyB := podConditionTime(a, corev1.PodReady), podConditionTime(b, corev1.PodReady)
+	if readyA == nil || readyB == nil || readyA.Equal(readyB) {
+		return false
+	}
+	return readyB.Before(readyA)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// applyScheduling renders the PodSet's scheduling fields into the pod: the
+// node selector is merged under the template's, the affinity and the runtime
+// and priority classes are used when the template sets none, and the
+// tolerations, topology spread constraints and default anti-affinity are
+// added to the template's.
+func applyScheduling(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) {
+	for key, value := range cr.Spec.NodeSelector {
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = map[string]string{}
+		}
+		if _, ok := pod.Spec.NodeSelector[key]; !ok {
+			pod.Spec.NodeSelector[key] = value
+		}
+	}
+	if pod.Spec.Affinity == nil && cr.Spec.Affinity != nil {
+		pod.Spec.Affinity = cr.Spec.Affinity.DeepCopy()
+	}
+	if pod.Spec.RuntimeClassName == nil && cr.Spec.RuntimeClassName != nil {
+		runtimeClassName := *cr.Spec.RuntimeClassName
+		pod.Spec.RuntimeClassName = &runtimeClassName
+	}
+	if pod.Spec.PriorityClassName == "" {
+		pod.Spec.PriorityClassName = cr.Spec.PriorityClassName
+	}
+	for _, toleration := range cr.Spec.Tolerations {
+		pod.Spec.Tolerations = append(pod.Spec.Tolerations, *toleration.DeepCopy())
+	}
+	for _, constraint := range cr.Spec.TopologySpreadConstraints {
+		constraint := *constraint.DeepCopy()
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = selectorForPodSet(cr)
+		}
+		pod.Spec.TopologySpreadConstraints = append(pod.Spec.TopologySpreadConstraints, constraint)
+	}
+	applyColocation(defaultAntiAffinity(cr), pod)
+}
+
+// defaultAntiAffinity returns the pod anti-affinity of spec.defaultAntiAffinity,
+// or nil.
+func defaultAntiAffinity(cr *podsetv1alpha1.PodSet) *corev1.Affinity {
+	term := corev1.PodAffinityTerm{
+		LabelSelector: selectorForPodSet(cr),
+		Namespaces:    []string{podNamespace(cr)},
+		TopologyKey:   corev1.LabelHostname,
+	}
+	switch cr.Spec.DefaultAntiAffinity {
+	case podsetv1alpha1.PreferredDefaultAntiAffinity:
+		return &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: colocationPreferenceWeight, PodAffinityTerm: term}},
+		}}
+	case podsetv1alpha1.RequiredDefaultAntiAffinity:
+		return &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term},
+		}}
+	}
+	return nil
+}
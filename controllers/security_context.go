@@ -0,0 +1,41 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// applySecurityContext sets the PodSet's pod and container security contexts
+// where the template sets none.
+func applySecurityContext(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) {
+	if pod.Spec.SecurityContext == nil && cr.Spec.SecurityContext != nil {
+		pod.Spec.SecurityContext = cr.Spec.SecurityContext.DeepCopy()
+	}
+	if cr.Spec.ContainerSecurityContext == nil {
+		return
+	}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			if containers[i].SecurityContext == nil {
+				containers[i].SecurityContext = cr.Spec.ContainerSecurityContext.DeepCopy()
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// serviceName returns the name of the PodSet's Service, or "" if it has
+// none.
+func serviceName(podSet *podsetv1alpha1.PodSet) string {
+	switch {
+	case podSet.Spec.Service == nil:
+		return ""
+	case podSet.Spec.Service.Name != "":
+		return podSet.Spec.Service.Name
+	}
+	return podSet.Name
+}
+
+// isHeadless reports whether the PodSet's Service has no cluster IP.
+func isHeadless(spec *podsetv1alpha1.ServiceSpec) bool {
+	return spec.Headless == nil || *spec.Headless
+}
+
+// ensureService creates or updates the PodSet's Service, in the namespace of
+// its pods, and deletes the Services it created before under another name
+// or before spec.service was unset. A Service whose cluster IP no longer
+// matches spec.service.headless is deleted and recreated on the next pass.
+// The Service is owned by the PodSet and garbage collected with it, unless
+// it lives in another namespace, in which case the finalizer removes it.
+func (r *PodSetReconciler) ensureService(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	log := ctrllog.FromContext(ctx)
+	name := serviceName(podSet)
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(podNamespace(podSet)), client.MatchingLabels(labelsForPodSet(podSet))); err != nil {
+		return err
+	}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		if !createdFor(podSet, svc) {
+			continue
+		}
+		stale := svc.Name != name
+		if !stale && svc.Spec.ClusterIP != "" {
+			stale = (svc.Spec.ClusterIP == corev1.ClusterIPNone) != isHeadless(podSet.Spec.Service)
+		}
+		if !stale {
+			continue
+		}
+		log.Info("Deleting stale Service", "service.namespace", svc.Namespace, "service.name", svc.Name)
+		if err := r.Delete(ctx, svc); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if svc.Name == name {
+			// Recreated once the deletion has gone through.
+			return nil
+		}
+	}
+	if name == "" {
+		return nil
+	}
+
+	spec := podSet.Spec.Service
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: podNamespace(podSet),
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, svc, func() error {
+		svc.Labels = labelsForPodSet(podSet)
+		svc.Spec.Selector = labelsForPodSet(podSet)
+		svc.Spec.Ports = spec.Ports
+		svc.Spec.PublishNotReadyAddresses = spec.PublishNotReadyAddresses
+		if svc.CreationTimestamp.IsZero() && isHeadless(spec) {
+			svc.Spec.ClusterIP = corev1.ClusterIPNone
+		}
+		if isCrossNamespace(podSet) {
+			// Cleaned up by the finalizer instead.
+			return nil
+		}
+		return controllerutil.SetControllerReference(podSet, svc, r.Scheme)
+	})
+	return err
+}
+
+// createdFor reports whether the controller created the object for the
+// PodSet: by its controller reference, or, outside the PodSet's namespace,
+// by its owner label.
+func createdFor(podSet *podsetv1alpha1.PodSet, obj client.Object) bool {
+	if isCrossNamespace(podSet) {
+		return obj.GetLabels()[ownerUIDLabel] == string(podSet.UID)
+	}
+	owner := podSetOwnerRef(obj)
+	return owner != nil && owner.UID == podSet.UID
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// createsServiceAccount reports whether the controller manages a dedicated
+// ServiceAccount for the PodSet's pods.
+func createsServiceAccount(cr *podsetv1alpha1.PodSet) bool {
+	return cr.Spec.ServiceAccount != nil && cr.Spec.ServiceAccount.Create
+}
+
+// serviceAccountName returns the name of the ServiceAccount spec.serviceAccount
+// runs the pods as, or "" if it names none.
+func serviceAccountName(cr *podsetv1alpha1.PodSet) string {
+	switch {
+	case cr.Spec.ServiceAccount == nil:
+		return ""
+	case cr.Spec.ServiceAccount.Name != "":
+		return cr.Spec.ServiceAccount.Name
+	case cr.Spec.ServiceAccount.Create:
+		return cr.Name
+	}
+	return ""
+}
+
+// ensureServiceAccount creates or updates the PodSet's dedicated
+// ServiceAccount, in the namespace of its pods, when one is requested, and
+// deletes those it created before under another name or before creation was
+// turned off. The ServiceAccount is owned by the PodSet and garbage
+// collected with it, unless it lives in another namespace, in which case the
+// finalizer removes it.
+func (r *PodSetReconciler) ensureServiceAccount(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	log := ctrllog.FromContext(ctx)
+	name := ""
+	if createsServiceAccount(podSet) {
+		name = serviceAccountName(podSet)
+	}
+	sas := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, sas, client.InNamespace(podNamespace(podSet)), client.MatchingLabels(labelsForPodSet(podSet))); err != nil {
+		return err
+	}
+	for i := range sas.Items {
+		sa := &sas.Items[i]
+		if sa.Name == name || !createdFor(podSet, sa) {
+			continue
+		}
+		log.Info("Deleting stale ServiceAccount", "serviceAccount.namespace", sa.Namespace, "serviceAccount.name", sa.Name)
+		if err := r.Delete(ctx, sa); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	if name == "" {
+		return nil
+	}
+
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: podNamespace(podSet),
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, sa, func() error {
+		sa.Labels = labelsForPodSet(podSet)
+		sa.ImagePullSecrets = podSet.Spec.ServiceAccount.ImagePullSecrets
+		if isCrossNamespace(podSet) {
+			// Cleaned up by the finalizer instead.
+			return nil
+		}
+		return controllerutil.SetControllerReference(podSet, sa, r.Scheme)
+	})
+	return err
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func serviceAccountNames(t *testing.T, r *PodSetReconciler) []string {
+	t.Helper()
+	sas := &corev1.ServiceAccountList{}
+	if err := r.List(context.Background(), sas, client.InNamespace("default")); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sa := range sas.Items {
+		names = append(names, sa.Name)
+	}
+	return names
+}
+
+func TestEnsureServiceAccount(t *testing.T) {
+	podSet := testPodSet(1)
+	podSet.Spec.ServiceAccount = &podsetv1alpha1.ServiceAccountSpec{
+		Create:           true,
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+	}
+	unrelated := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", Labels: labelsForPodSet(podSet)}}
+	r := newTestReconciler(t, podSet, unrelated)
+	ctx := context.Background()
+
+	if err := r.ensureServiceAccount(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	sa := &corev1.ServiceAccount{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web"}, sa); err != nil {
+		t.Fatal(err)
+	}
+	if len(sa.ImagePullSecrets) != 1 || sa.ImagePullSecrets[0].Name != "registry" {
+		t.Errorf("imagePullSecrets = %v, want registry", sa.ImagePullSecrets)
+	}
+	if owner := metav1.GetControllerOf(sa); owner == nil || owner.UID != podSet.UID {
+		t.Errorf("controller = %+v, want the PodSet", owner)
+	}
+
+	// Renaming deletes the ServiceAccount created under the old name, but
+	// not one the controller did not create.
+	podSet.Spec.ServiceAccount.Name = "web-runner"
+	if err := r.ensureServiceAccount(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if names := serviceAccountNames(t, r); len(names) != 2 || names[0] != "other" || names[1] != "web-runner" {
+		t.Errorf("ServiceAccounts = %v, want other and web-runner", names)
+	}
+
+	// Turning creation off deletes it.
+	podSet.Spec.ServiceAccount.Create = false
+	if err := r.ensureServiceAccount(ctx, podSet); err != nil {
+		t.Fatal(err)
+	}
+	if names := serviceAccountNames(t, r); len(names) != 1 || names[0] != "other" {
+		t.Errorf("ServiceAccounts = %v, want only other", names)
+	}
+}
+
+func TestPodTemplateServiceAccount(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		serviceAccount *podsetv1alpha1.ServiceAccountSpec
+		templateName   string
+		want           string
+	}{
+		{name: "created", serviceAccount: &podsetv1alpha1.ServiceAccountSpec{Create: true}, want: "web"},
+		{name: "named", serviceAccount: &podsetv1alpha1.ServiceAccountSpec{Name: "runner"}, want: "runner"},
+		{name: "named in the template", serviceAccount: &podsetv1alpha1.ServiceAccountSpec{Name: "runner"}, templateName: "custom", want: "custom"},
+		{name: "none", want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			podSet := testPodSet(1)
+			podSet.Spec.ServiceAccount = tc.serviceAccount
+			if tc.templateName != "" {
+				podSet.Spec.Template = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					ServiceAccountName: tc.templateName,
+					Containers:         []corev1.Container{{Name: "app", Image: "app"}},
+				}}
+			}
+			pod, err := podTemplate(podSet, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pod.Spec.ServiceAccountName != tc.want {
+				t.Errorf("serviceAccountName = %q, want %q", pod.Spec.ServiceAccountName, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// shardLabel holds the shard index of a sharded PodSet's pod.
+	shardLabel = "podset.example.com/shard"
+
+	shardIDEnv    = "SHARD_ID"
+	shardCountEnv = "SHARD_COUNT"
+)
+
+// isSharded reports whether the PodSet splits its pods into shards.
+func isSharded(podSet *podsetv1alpha1.PodSet) bool {
+	return podSet.Spec.Shards > 0
+}
+
+// replicasPerShard returns spec.replicasPerShard, defaulting to one.
+func replicasPerShard(podSet *podsetv1alpha1.PodSet) int {
+	if podSet.Spec.ReplicasPerShard > 0 {
+		return int(podSet.Spec.ReplicasPerShard)
+	}
+	return 1
+}
+
+// podShard returns the shard index of the pod, or -1 if it has none.
+func podShard(pod *corev1.Pod) int {
+	shard, err := strconv.Atoi(pod.Labels[shardLabel])
+	if err != nil {
+		return -1
+	}
+	return shard
+}
+
+// addShardEnv injects the variable into each of the pod's containers and
+// init containers.
+func addShardEnv(pod *corev1.Pod, env corev1.EnvVar) {
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].Env = append(pod.Spec.InitContainers[i].Env, env)
+	}
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, env)
+	}
+}
+
+// setShard labels the pod with its shard and injects its SHARD_ID. Its
+// SHARD_COUNT is part of the pod template, so that the template hash changes
+// with the shard count.
+func setShard(pod *corev1.Pod, shard int) {
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[shardLabel] = strconv.Itoa(shard)
+	addShardEnv(pod, corev1.EnvVar{Name: shardIDEnv, Value: strconv.Itoa(shard)})
+}
+
+// reconcileShards scales each shard of a sharded PodSet to replicasPerShard
+// pods. Pods in shards beyond spec.shards, or without a shard, are removed
+// first, highest shard first, so that shrinking the shard count removes whole
+// shards. Since SHARD_COUNT is part of the pod template, the pods created
+// under a previous shard count are replaced by the rollout like any other
+// outdated pods.
+func (r *PodSetReconciler) reconcileShards(ctx context.Context, podSet *podsetv1alpha1.PodSet, state *podSetState) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	shards := int(podSet.Spec.Shards)
+	perShard := int(state.desired) / shards
+
+	byShard := map[int][]corev1.Pod{}
+	for _, pod := range state.available {
+		byShard[podShard(&pod)] = append(byShard[podShard(&pod)], pod)
+	}
+	ignoredByShard := map[int]int{}
+	for _, pod := range state.ignoredFailures {
+		ignoredByShard[podShard(&pod)]++
+	}
+	indexes := make([]int, 0, len(byShard))
+	for shard := range byShard {
+		indexes = append(indexes, shard)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+
+	var victims []corev1.Pod
+	for _, shard := range indexes {
+		pods := byShard[shard]
+		switch {
+		case shard < 0 || shard >= shards:
+			victims = append(victims, pods...)
+		case len(pods) > perShard && podSet.Spec.ScaleDownPolicy != "":
+			victims = append(victims, orderForScaleDown(podSet, pods)[:len(pods)-perShard]...)
+		case len(pods) > perShard:
+			victims = append(victims, pods[perShard:]...)
+		}
+	}
+	victims, matureIn := matureCandidates(podSet, victims)
+	if matureIn > 0 {
+		log.Info("Deferring removal of pods younger than the minimum age", "Retry after", matureIn)
+		state.scaleDownDeferral = matureIn
+	}
+	drainWait := matureIn
+	if scaleDownDrain(podSet) > 0 {
+		drained, wait, err := r.drainVictims(ctx, podSet, state.available, victims)
+		if err != nil {
+			log.Error(err, "Failed to drain pods")
+			return ctrl.Result{}, err
+		}
+		victims = drained
+		if wait > 0 && (drainWait == 0 || wait < drainWait) {
+			drainWait = wait
+		}
+	}
+	removed, _, err := r.scaleDownPods(ctx, podSet, state, victims, len(victims))
+	for _, pod := range removed {
+		log.Info("Deleted pod outside the desired shards", "pod.name", pod.Name, "shard", pod.Labels[shardLabel])
+		state.available = removePod(state.available, pod.Name)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var pods []*corev1.Pod
+	for shard := 0; shard < shards; shard++ {
+		missing := perShard - len(byShard[shard]) - ignoredByShard[shard]
+		if missing <= 0 {
+			continue
+		}
+		rendered, err := newPodsForCR(podSet, &state.inputs, missing)
+		if err != nil {
+			log.Error(err, "Failed to render pods")
+			return ctrl.Result{}, err
+		}
+		for _, pod := range rendered {
+			setShard(pod, shard)
+		}
+		pods = append(pods, rendered...)
+	}
+	if len(pods) == 0 {
+		if len(victims) > 0 {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{RequeueAfter: drainWait}, nil
+	}
+	if state.halted {
+		log.Info("Not replacing failed pods, failure policy is Halt")
+		return ctrl.Result{}, nil
+	}
+	if state.waitForReferences {
+		log.Info("Not creating pods until referenced objects exist")
+		return ctrl.Result{}, nil
+	}
+	if state.templateRejected {
+		log.Info("Not creating pods, the pod template was rejected")
+		return ctrl.Result{}, nil
+	}
+	if state.replicaFailed {
+		log.Info("Not creating pods, creates failed too often")
+		return ctrl.Result{}, nil
+	}
+
+	pods = assignNodes(podSet, state.usableNodes, state.available, pods)
+	pods = assignHostPorts(podSet, state.freeHostPorts, pods)
+	fit := limitToCapacity(state.capacity, pods)
+	if len(fit) == 0 && len(pods) > 0 {
+		// No event announces freed capacity; look again once the estimate
+		// is refreshed.
+		log.Info("Not creating pods, the cluster has no capacity for them", "Retry after", capacityRefreshInterval)
+		return ctrl.Result{RequeueAfter: capacityRefreshInterval}, nil
+	}
+	pods = fit
+	pods = r.boundCreates(pods)
+	pods, throttled := r.throttleCreates(podSet, pods)
+	if len(pods) == 0 {
+		return ctrl.Result{RequeueAfter: throttled}, nil
+	}
+	log.Info("Scaling up shards", "Missing pods", len(pods))
+	r.recordScaling(podSet, int32(len(state.available)), int32(len(state.available)+len(pods)))
+	created, err := r.createPods(ctx, podSet, pods)
+	state.available = append(state.available, created...)
+	if err != nil {
+		log.Error(err, "Failed to create pods", "Created", len(created), "Requested", len(pods))
+		return ctrl.Result{}, err
+	}
+	if throttled > 0 {
+		log.Info("Pod creates throttled", "Created", len(created), "Retry after", throttled)
+		return ctrl.Result{RequeueAfter: throttled}, nil
+	}
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// shardStatuses reports the available and ready pods of each shard.
+func shardStatuses(podSet *podsetv1alpha1.PodSet, available []corev1.Pod) []podsetv1alpha1.ShardStatus {
+	if !isSharded(podSet) {
+		return nil
+	}
+	statuses := make([]podsetv1alpha1.ShardStatus, podSet.Spec.Shards)
+	for i := range statuses {
+		statuses[i].Index = int32(i)
+	}
+	for _, pod := range available {
+		shard := podShard(&pod)
+		if shard < 0 || shard >= len(statuses) {
+			continue
+		}
+		statuses[shard].Replicas++
+		if isPodReady(&pod) {
+			statuses[shard].ReadyReplicas++
+		}
+	}
+	return statuses
+}
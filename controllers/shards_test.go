@@ -0,0 +1,115 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestShardCountChangesTemplateHash(t *testing.T) {
+	podSet := &podsetv1alpha1.PodSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       podsetv1alpha1.PodSetSpec{Shards: 2},
+	}
+	before, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podSet.Spec.Shards = 3
+	after, err := currentTemplateHash(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Errorf("template hash %s did not change with the shard count", before)
+	}
+}
+
+func TestSetShard(t *testing.T) {
+	podSet := &podsetv1alpha1.PodSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       podsetv1alpha1.PodSetSpec{Shards: 3},
+	}
+	pod, err := newPodForCR(podSet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setShard(pod, 1)
+	if pod.Labels[shardLabel] != "1" {
+		t.Errorf("shard label = %q, want 1", pod.Labels[shardLabel])
+	}
+	env := map[string]string{}
+	for _, e := range pod.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if env[shardIDEnv] != "1" || env[shardCountEnv] != "3" {
+		t.Errorf("env = %v, want SHARD_ID 1 and SHARD_COUNT 3", env)
+	}
+}
+
+func TestReconcileShards(t *testing.T) {
+	podSet := testPodSet(0)
+	podSet.Spec.Shards = 2
+	podSet.Spec.ReplicasPerShard = 2
+	r := newTestReconciler(t, podSet)
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(context.Background(), pods); err != nil {
+		t.Fatal(err)
+	}
+	perShard := map[string]int{}
+	for _, pod := range pods.Items {
+		perShard[pod.Labels[shardLabel]]++
+	}
+	if len(pods.Items) != 4 || perShard["0"] != 2 || perShard["1"] != 2 {
+		t.Errorf("pods per shard = %v, want 2 in each of shards 0 and 1", perShard)
+	}
+	shards := podSet.Status.Shards
+	if len(shards) != 2 || shards[0].Replicas != 2 || shards[1].Replicas != 2 {
+		t.Errorf("shard statuses = %+v, want 2 replicas in each of 2 shards", shards)
+	}
+}
+
+func TestShardStatuses(t *testing.T) {
+	podSet := testPodSet(0)
+	podSet.Spec.Shards = 2
+	ready := corev1.PodStatus{Phase: corev1.PodRunning, Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}}
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{shardLabel: "0"}}, Status: ready},
+		{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{shardLabel: "0"}}},
+		{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{shardLabel: "5"}}, Status: ready},
+		{},
+	}
+	want := []podsetv1alpha1.ShardStatus{{Index: 0, Replicas: 2, ReadyReplicas: 1}, {Index: 1}}
+	if got := shardStatuses(podSet, pods); !reflect.DeepEqual(got, want) {
+		t.Errorf("shard statuses = %+v, want %+v", got, want)
+	}
+	if got := shardStatuses(testPodSet(2), pods); got != nil {
+		t.Errorf("shard statuses of an unsharded PodSet = %+v, want none", got)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	reasonMinimumReplicasAvailable   = "MinimumReplicasAvailable"
+	reasonMinimumReplicasUnavailable = "MinimumReplicasUnavailable"
+	reasonScalingUp                  = "ScalingUp"
+	reasonScalingDown                = "ScalingDown"
+	reasonRollingOut                 = "RollingOut"
+	reasonComplete                   = "Complete"
+)
+
+// setStandardConditions sets the Available and Progressing conditions of
+// status from the PodSet's available pods and its replica counts, which must
+// be filled in first, and reports Degraded as False until something raises
+// it.
+func setStandardConditions(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, available []corev1.Pod) {
+	desired := status.DesiredReplicas
+	if desired == 0 {
+		desired = desiredReplicas(podSet)
+	}
+	var ready int32
+	now := time.Now()
+	for i := range available {
+		if isPodAvailable(&available[i], minReady(podSet), now) {
+			ready++
+		}
+	}
+
+	message := fmt.Sprintf("%d of %d pods are Ready", ready, desired)
+	if podSet.Spec.MinReadySeconds > 0 {
+		message = fmt.Sprintf("%d of %d pods have been Ready for %ds", ready, desired, podSet.Spec.MinReadySeconds)
+	}
+	availableCond := metav1.Condition{
+		Type:               podsetv1alpha1.ConditionAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonMinimumReplicasAvailable,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	}
+	if ready < desired {
+		availableCond.Status = metav1.ConditionFalse
+		availableCond.Reason = reasonMinimumReplicasUnavailable
+	}
+	meta.SetStatusCondition(&status.Conditions, availableCond)
+
+	progressing := metav1.Condition{
+		Type:               podsetv1alpha1.ConditionProgressing,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: podSet.Generation,
+	}
+	switch count := int32(len(available)); {
+	case count < desired:
+		progressing.Reason = reasonScalingUp
+		progressing.Message = fmt.Sprintf("%d of %d pods exist", count, desired)
+	case count > desired:
+		progressing.Reason = reasonScalingDown
+		progressing.Message = fmt.Sprintf("%d pods exist, %d desired", count, desired)
+	case status.Rollout != nil && status.Rollout.BatchesRemaining > 0:
+		progressing.Reason = reasonRollingOut
+		progressing.Message = fmt.Sprintf("%d batches of outdated pods remain to be replaced", status.Rollout.BatchesRemaining)
+	default:
+		progressing.Status = metav1.ConditionFalse
+		progressing.Reason = reasonComplete
+		progressing.Message = fmt.Sprintf("%d pods exist", count)
+	}
+	meta.SetStatusCondition(&status.Conditions, progressing)
+
+	if meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded) == nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionDegraded,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonAsExpected,
+			ObservedGeneration: podSet.Generation,
+		})
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const reasonPodsStuckPending = "PodsStuckPending"
+
+// handleStuckPending lists in status the available pods Pending for longer
+// than spec.pendingTimeout and reports them in the Degraded condition,
+// unless it is already raised for another reason. Unless observeOnly or
+// the failure policy has halted, stuck pods are deleted when the timeout
+// asks to replace them. state.pendingTimeout is set to when the next
+// Pending pod times out.
+func (r *PodSetReconciler) handleStuckPending(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState, observeOnly bool) error {
+	log := ctrllog.FromContext(ctx)
+	status.StuckPendingPods = nil
+	timeout := podSet.Spec.PendingTimeout
+	if timeout == nil {
+		clearDegraded(status, reasonPodsStuckPending, podSet.Generation)
+		return nil
+	}
+	limit := time.Duration(timeout.Seconds) * time.Second
+	now := time.Now()
+	for _, pod := range append([]corev1.Pod(nil), state.available...) {
+		if pod.Status.Phase != corev1.PodPending {
+			continue
+		}
+		if left := limit - now.Sub(pod.CreationTimestamp.Time); left > 0 {
+			if state.pendingTimeout == 0 || left < state.pendingTimeout {
+				state.pendingTimeout = left
+			}
+			continue
+		}
+		if observeOnly || !timeout.Replace || state.halted {
+			status.StuckPendingPods = append(status.StuckPendingPods, pod.Name)
+			continue
+		}
+		log.Info("Replacing stuck pending pod", "pod.name", pod.Name, "pending", now.Sub(pod.CreationTimestamp.Time))
+		if err := r.Delete(ctx, &pod, podDeleteOptions(podSet)...); err != nil && !errors.IsNotFound(err) {
+			r.podDeleteFailed(podSet, &pod, err)
+			return err
+		}
+		r.podDeleted(podSet, state, &pod, podsetv1alpha1.StuckPendingDeletion)
+		state.available = removePod(state.available, pod.Name)
+	}
+
+	if len(status.StuckPendingPods) == 0 {
+		clearDegraded(status, reasonPodsStuckPending, podSet.Generation)
+		return nil
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason != reasonPodsStuckPending {
+		return nil
+	}
+	message := fmt.Sprintf("Pods Pending for more than %s: %s", limit, strings.Join(status.StuckPendingPods, ", "))
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonPodsStuckPending, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonPodsStuckPending,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return nil
+}
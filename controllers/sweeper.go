@@ -0,0 +1,160 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const reasonLeakedPod = "LeakedPod"
+
+// PodSweeper periodically looks for managed pods whose PodSet no longer
+// exists, such as those left behind by an orphaning delete or a failed
+// finalizer, and reports or deletes them.
+type PodSweeper struct {
+	// Client lists the pods and deletes the leaked ones.
+	Client client.Client
+	// Reader looks up the owning PodSets. It should read from the API
+	// server, so that a PodSet missing from a lagging cache is not taken
+	// for gone.
+	Reader   client.Reader
+	Recorder record.EventRecorder
+
+	// Interval is the time between sweeps.
+	Interval time.Duration
+
+	// MinPodAge spares pods younger than this, whose PodSet may not have
+	// reached the caches yet.
+	MinPodAge time.Duration
+
+	// Delete makes the sweeper delete leaked pods. Otherwise they are only
+	// reported through events and the podset_leaked_pods metric.
+	Delete bool
+
+	// DeleteLimiter, if set, paces the deletes.
+	DeleteLimiter *rate.Limiter
+}
+
+// Start implements manager.Runnable.
+func (s *PodSweeper) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.sweep(ctx); err != nil {
+			ctrllog.FromContext(ctx).Error(err, "Failed to sweep leaked pods")
+		}
+	}, s.Interval)
+	return nil
+}
+
+// sweep reports, and deletes if configured to, the managed pods whose
+// PodSet is confirmed gone.
+func (s *PodSweeper) sweep(ctx context.Context) error {
+	log := ctrllog.FromContext(ctx).WithName("sweeper")
+
+	managed, err := labels.NewRequirement(templateHashLabel, selection.Exists, nil)
+	if err != nil {
+		return err
+	}
+	pods := &corev1.PodList{}
+	if err := s.Client.List(ctx, pods, client.MatchingLabelsSelector{Selector: labels.NewSelector().Add(*managed)}); err != nil {
+		return err
+	}
+
+	leaked := map[string]int{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || time.Since(pod.CreationTimestamp.Time) < s.MinPodAge {
+			continue
+		}
+		gone, err := s.ownerGone(ctx, pod)
+		if err != nil {
+			return err
+		}
+		if !gone {
+			continue
+		}
+		leaked[pod.Namespace]++
+		if !s.Delete {
+			log.Info("Found a pod whose PodSet no longer exists", "pod", client.ObjectKeyFromObject(pod))
+			s.Recorder.Event(pod, corev1.EventTypeWarning, reasonLeakedPod, "The PodSet that created this pod no longer exists")
+			continue
+		}
+		if s.DeleteLimiter != nil {
+			if err := s.DeleteLimiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		// Delete only the pod that was checked, not a later one of the
+		// same name.
+		if err := s.Client.Delete(ctx, pod, client.Preconditions{UID: &pod.UID}); err != nil {
+			if errors.IsNotFound(err) || errors.IsConflict(err) {
+				continue
+			}
+			return err
+		}
+		log.Info("Deleted a pod whose PodSet no longer exists", "pod", client.ObjectKeyFromObject(pod))
+		s.Recorder.Event(pod, corev1.EventTypeNormal, reasonLeakedPod, "Deleted: the PodSet that created this pod no longer exists")
+		leakedPodsDeleted.WithLabelValues(pod.Namespace).Inc()
+	}
+
+	leakedPods.Reset()
+	for namespace, count := range leaked {
+		leakedPods.WithLabelValues(namespace).Set(float64(count))
+	}
+	return nil
+}
+
+// ownerGone reports whether the PodSet the pod was created by is confirmed
+// not to exist: it is not found, or a PodSet of the same name with another
+// UID has taken its place. Pods that do not say which PodSet created them
+// are never reported.
+func (s *PodSweeper) ownerGone(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	var key types.NamespacedName
+	var uid types.UID
+	if ref := podSetOwnerRef(pod); ref != nil {
+		key = types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}
+		uid = ref.UID
+	} else if pod.Labels[ownerUIDLabel] != "" && pod.Labels[ownerNamespaceLabel] != "" && ownerName(pod.Labels) != "" {
+		key = types.NamespacedName{Namespace: pod.Labels[ownerNamespaceLabel], Name: ownerName(pod.Labels)}
+		uid = types.UID(pod.Labels[ownerUIDLabel])
+	} else {
+		return false, nil
+	}
+
+	podSet := &podsetv1alpha1.PodSet{}
+	if err := s.Reader.Get(ctx, key, podSet); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("getting PodSet %s: %w", key, err)
+	}
+	return podSet.UID != uid, nil
+}
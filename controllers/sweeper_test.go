@@ -0,0 +1,97 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// sweeperTestSweeper returns a sweeper over a PodSet web that exists, and
+// pods of it, of a deleted PodSet, of a PodSet recreated under the same
+// name, and a young one of the deleted PodSet.
+func sweeperTestSweeper(t *testing.T) *PodSweeper {
+	t.Helper()
+	podSet := testPodSet(1)
+	gone := testPodSet(1)
+	gone.Name, gone.UID = "gone", "gone-uid"
+	replaced := testPodSet(1)
+	replaced.UID = "replaced-uid"
+
+	var objs []client.Object
+	for name, owner := range map[string]*podsetv1alpha1.PodSet{"web-a": podSet, "gone-a": gone, "gone-young": gone, "web-old": replaced} {
+		pod := ownedTestPod(owner, name, map[string]string{templateHashLabel: "hash"})
+		if name != "gone-young" {
+			pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+		}
+		objs = append(objs, pod)
+	}
+	unowned := leaderTestPod("unowned", time.Hour, true, false)
+	unowned.Labels[templateHashLabel] = "hash"
+	objs = append(objs, unowned, podSet)
+
+	r := newTestReconciler(t, objs...)
+	return &PodSweeper{Client: r.Client, Reader: r.Client, Recorder: r.Recorder, MinPodAge: time.Minute}
+}
+
+func remainingPods(t *testing.T, c client.Client) []string {
+	t.Helper()
+	pods := &corev1.PodList{}
+	if err := c.List(context.Background(), pods); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSweepReportsLeakedPods(t *testing.T) {
+	s := sweeperTestSweeper(t)
+	if err := s.sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"gone-a", "gone-young", "unowned", "web-a", "web-old"}; !reflect.DeepEqual(remainingPods(t, s.Client), want) {
+		t.Errorf("pods = %v, want %v left when only reporting", remainingPods(t, s.Client), want)
+	}
+	if events := len(s.Recorder.(*record.FakeRecorder).Events); events != 2 {
+		t.Errorf("%d events, want one for each of gone-a and web-old", events)
+	}
+}
+
+func TestSweepDeletesLeakedPods(t *testing.T) {
+	s := sweeperTestSweeper(t)
+	s.Delete = true
+	if err := s.sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"gone-young", "unowned", "web-a"}; !reflect.DeepEqual(remainingPods(t, s.Client), want) {
+		t.Errorf("pods = %v, want %v", remainingPods(t, s.Client), want)
+	}
+}
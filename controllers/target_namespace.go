@@ -0,0 +1,106 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const (
+	// ownerUIDLabel and ownerNamespaceLabel identify the PodSet that owns a
+	// pod created outside the PodSet's namespace.
+	ownerUIDLabel       = podsetv1alpha1.OwnerUIDLabel
+	ownerNamespaceLabel = podsetv1alpha1.OwnerNamespaceLabel
+	// ownerNameLabel names the owning PodSet of such a pod when the PodSet
+	// has a spec.selector; otherwise the app label does.
+	ownerNameLabel = podsetv1alpha1.OwnerNameLabel
+
+	reasonTargetNamespaceNotAllowed = "TargetNamespaceNotAllowed"
+)
+
+// podNamespace returns the namespace the PodSet's pods are created in.
+func podNamespace(cr *podsetv1alpha1.PodSet) string {
+	if cr.Spec.TargetNamespace != "" {
+		return cr.Spec.TargetNamespace
+	}
+	return cr.Namespace
+}
+
+// isCrossNamespace reports whether the PodSet's pods live outside its own
+// namespace.
+func isCrossNamespace(cr *podsetv1alpha1.PodSet) bool {
+	return podNamespace(cr) != cr.Namespace
+}
+
+// allowsPodNamespace reports whether the PodSet's pods live in its own
+// namespace or in one listed in AllowedTargetNamespaces.
+func (r *PodSetReconciler) allowsPodNamespace(podSet *podsetv1alpha1.PodSet) bool {
+	if !isCrossNamespace(podSet) {
+		return true
+	}
+	for _, ns := range r.AllowedTargetNamespaces {
+		if ns == "*" || ns == podSet.Spec.TargetNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// targetNamespaceAllowed reports whether the operator allows the PodSet's
+// target namespace, recording a refusal in the Degraded condition of status.
+func (r *PodSetReconciler) targetNamespaceAllowed(podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus) bool {
+	if r.allowsPodNamespace(podSet) {
+		clearDegraded(status, reasonTargetNamespaceNotAllowed, podSet.Generation)
+		return true
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonTargetNamespaceNotAllowed,
+		Message:            fmt.Sprintf("The operator does not allow creating pods in namespace %s", podSet.Spec.TargetNamespace),
+		ObservedGeneration: podSet.Generation,
+	})
+	return false
+}
+
+// ownerName returns the name of the PodSet a pod outside its namespace is
+// labeled with.
+func ownerName(labels map[string]string) string {
+	if name := labels[ownerNameLabel]; name != "" {
+		return name
+	}
+	return labels["app"]
+}
+
+// podSetForLabeledPod maps a pod created outside its PodSet's namespace back
+// to the PodSet, since such pods have no owner reference to follow.
+func podSetForLabeledPod(obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	ns, name := labels[ownerNamespaceLabel], ownerName(labels)
+	if labels[ownerUIDLabel] == "" || ns == "" || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: ns, Name: name}}}
+}
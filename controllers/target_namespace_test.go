@@ -0,0 +1,76 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+func TestReconcileTargetNamespace(t *testing.T) {
+	podSet := testPodSet(2)
+	podSet.Spec.TargetNamespace = "apps"
+	r := newTestReconciler(t, podSet)
+	r.AllowedTargetNamespaces = []string{"apps"}
+
+	if _, err := reconcileTestPodSet(t, r); err != nil {
+		t.Fatal(err)
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(context.Background(), pods, client.InNamespace("apps")); err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 2 {
+		t.Fatalf("%d pods in the target namespace, want 2", len(pods.Items))
+	}
+	pod := pods.Items[0]
+	if len(pod.OwnerReferences) != 0 || pod.Labels[ownerUIDLabel] != string(podSet.UID) || pod.Labels[ownerNamespaceLabel] != "default" {
+		t.Errorf("pod has owner references %v and labels %v, want owner labels only", pod.OwnerReferences, pod.Labels)
+	}
+	requests := podSetForLabeledPod(&pod)
+	if len(requests) != 1 || requests[0].Namespace != "default" || requests[0].Name != "web" {
+		t.Errorf("pod maps to %v, want default/web", requests)
+	}
+}
+
+func TestReconcileTargetNamespaceNotAllowed(t *testing.T) {
+	podSet := testPodSet(2)
+	podSet.Spec.TargetNamespace = "apps"
+	r := newTestReconciler(t, podSet)
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(podSet.Status.Conditions, podsetv1alpha1.ConditionDegraded)
+	if cond == nil || cond.Reason != reasonTargetNamespaceNotAllowed {
+		t.Errorf("Degraded = %+v, want reason %s", cond, reasonTargetNamespaceNotAllowed)
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(context.Background(), pods); err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("%d pods created, want none", len(pods.Items))
+	}
+}
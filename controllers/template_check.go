@@ -0,0 +1,139 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+const reasonPolicyRejected = "PolicyRejected"
+
+// templateCheck is the outcome of the dry-run create of a PodSet's pod
+// template.
+type templateCheck struct {
+	hash       string
+	generation int64
+	// rejection is the API server's message if the pod was rejected.
+	rejection string
+}
+
+// templateCheckCache remembers the last dry-run create per PodSet.
+type templateCheckCache struct {
+	mu     sync.Mutex
+	checks map[types.NamespacedName]templateCheck
+}
+
+// get returns the last check recorded for key.
+func (c *templateCheckCache) get(key types.NamespacedName) (templateCheck, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	check, ok := c.checks[key]
+	return check, ok
+}
+
+// set records a check for key.
+func (c *templateCheckCache) set(key types.NamespacedName, check templateCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checks == nil {
+		c.checks = make(map[types.NamespacedName]templateCheck)
+	}
+	c.checks[key] = check
+}
+
+// forget drops the record for key once its PodSet is gone.
+func (c *templateCheckCache) forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.checks, key)
+}
+
+// checkPodTemplate validates the pod rendered for the PodSet with a dry-run
+// create before pods are created from a new template, so that admission
+// webhooks and policies rejecting it are reported once in the
+// InvalidPodTemplate condition of status instead of failing every create. It
+// reports whether the template was rejected. An accepted template is not
+// checked again; a rejected one is checked again when the spec changes.
+// Dry-runs that fail for other reasons are logged and do not block creates.
+func (r *PodSetReconciler) checkPodTemplate(ctx context.Context, podSet *podsetv1alpha1.PodSet, status *podsetv1alpha1.PodSetStatus, state *podSetState) bool {
+	log := ctrllog.FromContext(ctx)
+	if int(state.desired) <= len(state.available) {
+		return false
+	}
+	pod, err := newPodForCR(podSet, &state.inputs)
+	if err != nil {
+		// The render error is reported when pods are created.
+		return false
+	}
+	hash := pod.Labels[templateHashLabel]
+	key := types.NamespacedName{Namespace: podSet.Namespace, Name: podSet.Name}
+
+	check, ok := r.templateChecks.get(key)
+	if !ok || check.hash != hash || (check.rejection != "" && check.generation != podSet.Generation) {
+		if !isCrossNamespace(podSet) {
+			if err := controllerutil.SetControllerReference(podSet, pod, r.Scheme); err != nil {
+				return false
+			}
+		}
+		check = templateCheck{hash: hash, generation: podSet.Generation}
+		err := r.Create(ctx, pod, client.DryRunAll, client.FieldOwner(fieldManager))
+		switch {
+		case errors.IsForbidden(err) || errors.IsInvalid(err) || errors.IsBadRequest(err):
+			check.rejection = err.Error()
+		case err != nil:
+			log.Error(err, "Dry-run create of pod template failed")
+			return false
+		}
+		r.templateChecks.set(key, check)
+	}
+
+	if check.rejection == "" {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               podsetv1alpha1.ConditionInvalidPodTemplate,
+			Status:             metav1.ConditionFalse,
+			Reason:             "DryRunSucceeded",
+			Message:            fmt.Sprintf("Pod template %s was accepted by a dry-run create", hash),
+			ObservedGeneration: podSet.Generation,
+		})
+		return false
+	}
+	message := fmt.Sprintf("Pod template %s was rejected by a dry-run create: %s", hash, check.rejection)
+	if !meta.IsStatusConditionTrue(status.Conditions, podsetv1alpha1.ConditionInvalidPodTemplate) {
+		r.Recorder.Event(podSet, corev1.EventTypeWarning, reasonPolicyRejected, message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               podsetv1alpha1.ConditionInvalidPodTemplate,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonPolicyRejected,
+		Message:            message,
+		ObservedGeneration: podSet.Generation,
+	})
+	return true
+}
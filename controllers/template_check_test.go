@@ -0,0 +1,106 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// dryRunCreates counts the dry-run creates it is sent, refusing them when
+// reject is set, as an admission policy would.
+type dryRunCreates struct {
+	client.Client
+	reject  *bool
+	dryRuns *int
+}
+
+func (c dryRunCreates) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	if len(createOpts.DryRun) > 0 {
+		*c.dryRuns++
+		if *c.reject {
+			return errors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.NewBadRequest("denied by policy"))
+		}
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestCheckPodTemplate(t *testing.T) {
+	podSet := testPodSet(2)
+	r := newTestReconciler(t, podSet)
+	reject, dryRuns := true, 0
+	r.Client = dryRunCreates{Client: r.Client, reject: &reject, dryRuns: &dryRuns}
+	status := &podsetv1alpha1.PodSetStatus{}
+	state := &podSetState{desired: 2}
+	ctx := context.Background()
+
+	if rejected := r.checkPodTemplate(ctx, podSet, status, state); !rejected {
+		t.Fatal("template accepted, want it rejected")
+	}
+	cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionInvalidPodTemplate)
+	if cond == nil || cond.Reason != reasonPolicyRejected {
+		t.Fatalf("InvalidPodTemplate = %+v, want reason %s", cond, reasonPolicyRejected)
+	}
+
+	// A rejection is remembered until the spec changes.
+	reject = false
+	if rejected := r.checkPodTemplate(ctx, podSet, status, state); !rejected || dryRuns != 1 {
+		t.Errorf("rejected = %v after %d dry-runs, want the rejection remembered", rejected, dryRuns)
+	}
+	podSet.Generation++
+	if rejected := r.checkPodTemplate(ctx, podSet, status, state); rejected || dryRuns != 2 {
+		t.Errorf("rejected = %v after %d dry-runs, want the template checked again", rejected, dryRuns)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, podsetv1alpha1.ConditionInvalidPodTemplate); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("InvalidPodTemplate = %+v, want False", cond)
+	}
+
+	// An accepted template is not checked again.
+	podSet.Generation++
+	if rejected := r.checkPodTemplate(ctx, podSet, status, state); rejected || dryRuns != 2 {
+		t.Errorf("rejected = %v after %d dry-runs, want the acceptance remembered", rejected, dryRuns)
+	}
+}
+
+func TestReconcileCreatesNoPodsFromRejectedTemplate(t *testing.T) {
+	r := newTestReconciler(t, testPodSet(2))
+	reject, dryRuns := true, 0
+	r.Client = dryRunCreates{Client: r.Client, reject: &reject, dryRuns: &dryRuns}
+
+	podSet, err := reconcileTestPodSet(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(context.Background(), pods); err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 || !meta.IsStatusConditionTrue(podSet.Status.Conditions, podsetv1alpha1.ConditionInvalidPodTemplate) {
+		t.Errorf("%d pods created with conditions %+v, want none from a rejected template", len(pods.Items), podSet.Status.Conditions)
+	}
+}
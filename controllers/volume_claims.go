@@ -0,0 +1,211 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// claimPodLabel holds the name of the pod a claim of spec.volumeClaimTemplates
+// was created for.
+const claimPodLabel = "podset.example.com/claim-pod"
+
+// retainsClaimsWhenDeleted reports whether the claims of the PodSet's pods
+// outlive the PodSet.
+func retainsClaimsWhenDeleted(podSet *podsetv1alpha1.PodSet) bool {
+	policy := podSet.Spec.PersistentVolumeClaimRetentionPolicy
+	return len(podSet.Spec.VolumeClaimTemplates) > 0 && policy != nil &&
+		policy.WhenDeleted == podsetv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType
+}
+
+// deletesClaimsWhenScaled reports whether the claims of the pods of an
+// Ordered PodSet are deleted once scale-down removed them.
+func deletesClaimsWhenScaled(podSet *podsetv1alpha1.PodSet) bool {
+	policy := podSet.Spec.PersistentVolumeClaimRetentionPolicy
+	return policy != nil && policy.WhenScaled == podsetv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType
+}
+
+// claimName returns the name of the pod's claim from the template.
+func claimName(template *podsetv1alpha1.VolumeClaimTemplate, pod *corev1.Pod) string {
+	return template.Name + "-" + pod.Name
+}
+
+// addClaimVolumes adds a volume for each of the pod's claims, replacing the
+// volumes of the same name. The claims are named after the pod, so a pod
+// without a name is named here rather than by the API server.
+func addClaimVolumes(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) {
+	if len(cr.Spec.VolumeClaimTemplates) == 0 {
+		return
+	}
+	namePod(pod)
+	for i := range cr.Spec.VolumeClaimTemplates {
+		template := &cr.Spec.VolumeClaimTemplates[i]
+		volume := corev1.Volume{
+			Name: template.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName(template, pod)},
+			},
+		}
+		replaced := false
+		for j := range pod.Spec.Volumes {
+			if pod.Spec.Volumes[j].Name == volume.Name {
+				pod.Spec.Volumes[j] = volume
+				replaced = true
+			}
+		}
+		if !replaced {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+		}
+	}
+}
+
+// createClaims creates the claims of a pod about to be created, keeping
+// those that already exist, as they do for a pod of an Ordered PodSet that
+// is recreated. A claim retained from a deleted PodSet of the same name is
+// adopted. The claims are owned by the PodSet, unless they live in another
+// namespace, in which case the finalizer removes them.
+func (r *PodSetReconciler) createClaims(ctx context.Context, podSet *podsetv1alpha1.PodSet, pod *corev1.Pod) error {
+	for i := range podSet.Spec.VolumeClaimTemplates {
+		template := &podSet.Spec.VolumeClaimTemplates[i]
+		claim := &corev1.PersistentVolumeClaim{}
+		claim.Name = claimName(template, pod)
+		claim.Namespace = pod.Namespace
+		claim.Labels = labelsForPodSet(podSet)
+		for key, value := range template.Labels {
+			if _, ok := claim.Labels[key]; !ok {
+				claim.Labels[key] = value
+			}
+		}
+		claim.Labels[claimPodLabel] = pod.Name
+		claim.Spec = *template.Spec.DeepCopy()
+		if !isCrossNamespace(podSet) {
+			if err := controllerutil.SetControllerReference(podSet, claim, r.Scheme); err != nil {
+				return err
+			}
+		}
+		err := r.Create(ctx, claim)
+		if errors.IsAlreadyExists(err) {
+			err = r.adoptClaim(ctx, podSet, claim)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adoptClaim makes the PodSet the owner of the existing claim of the
+// rendered claim's name if it was released for the same pod, as
+// persistentVolumeClaimRetentionPolicy.whenDeleted Retain does.
+func (r *PodSetReconciler) adoptClaim(ctx context.Context, podSet *podsetv1alpha1.PodSet, rendered *corev1.PersistentVolumeClaim) error {
+	existing := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(rendered), existing); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if createdFor(podSet, existing) || metav1.GetControllerOf(existing) != nil ||
+		existing.Labels[claimPodLabel] != rendered.Labels[claimPodLabel] || existing.DeletionTimestamp != nil {
+		return nil
+	}
+	patch := client.MergeFrom(existing.DeepCopy())
+	for key, value := range rendered.Labels {
+		existing.Labels[key] = value
+	}
+	if !isCrossNamespace(podSet) {
+		if err := controllerutil.SetControllerReference(podSet, existing, r.Scheme); err != nil {
+			return err
+		}
+	}
+	ctrllog.FromContext(ctx).Info("Adopting retained claim", "claim.name", existing.Name)
+	return r.Patch(ctx, existing, patch)
+}
+
+// releaseClaims releases the claims of a deleted PodSet whose
+// persistentVolumeClaimRetentionPolicy retains them: their owner reference
+// and owner labels are removed, so that neither garbage collection nor the
+// finalizer deletes them.
+func (r *PodSetReconciler) releaseClaims(ctx context.Context, podSet *podsetv1alpha1.PodSet) error {
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(podNamespace(podSet)), client.HasLabels{claimPodLabel}, client.MatchingLabels(labelsForPodSet(podSet))); err != nil {
+		return err
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if !createdFor(podSet, claim) {
+			continue
+		}
+		patch := client.MergeFrom(claim.DeepCopy())
+		var refs []metav1.OwnerReference
+		for _, ref := range claim.OwnerReferences {
+			if ref.UID != podSet.UID {
+				refs = append(refs, ref)
+			}
+		}
+		claim.OwnerReferences = refs
+		for _, key := range []string{ownerUIDLabel, ownerNamespaceLabel, ownerNameLabel} {
+			delete(claim.Labels, key)
+		}
+		ctrllog.FromContext(ctx).Info("Retaining claim of deleted PodSet", "claim.name", claim.Name)
+		if err := r.Patch(ctx, claim, patch); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneClaims deletes the claims of pods that are gone. The pods of an
+// Ordered PodSet come back under their names and reuse their claims, so
+// only the claims of ordinals scaled away are deleted, and only if
+// persistentVolumeClaimRetentionPolicy.whenScaled is Delete.
+func (r *PodSetReconciler) pruneClaims(ctx context.Context, podSet *podsetv1alpha1.PodSet, pods []corev1.Pod) error {
+	log := ctrllog.FromContext(ctx)
+	if len(podSet.Spec.VolumeClaimTemplates) == 0 || (isOrdered(podSet) && !deletesClaimsWhenScaled(podSet)) {
+		return nil
+	}
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(podNamespace(podSet)), client.HasLabels{claimPodLabel}, client.MatchingLabels(labelsForPodSet(podSet))); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i := range pods {
+		names[pods[i].Name] = true
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if names[claim.Labels[claimPodLabel]] || claim.DeletionTimestamp != nil || !createdFor(podSet, claim) {
+			continue
+		}
+		if isOrdered(podSet) {
+			if ordinal, ok := nameOrdinal(podSet, claim.Labels[claimPodLabel]); ok && ordinal < int(desiredReplicas(podSet)) {
+				continue
+			}
+		}
+		log.Info("Deleting claim of a pod that is gone", "claim.name", claim.Name, "pod.name", claim.Labels[claimPodLabel])
+		if err := r.Delete(ctx, claim); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
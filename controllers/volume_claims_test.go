@@ -0,0 +1,169 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// retentionTestPodSet returns an Ordered PodSet of one replica with a claim
+// template and the retention policy, whose pods live in the namespace pods
+// so that the finalizer rather than garbage collection deletes their claims.
+func retentionTestPodSet(uid string, whenScaled, whenDeleted podsetv1alpha1.PersistentVolumeClaimRetentionPolicyType) *podsetv1alpha1.PodSet {
+	podSet := claimTestPodSet("1Gi")
+	podSet.UID = types.UID("web-" + uid)
+	podSet.Spec.Replicas = 1
+	podSet.Spec.PodManagementPolicy = podsetv1alpha1.OrderedPodManagement
+	podSet.Spec.TargetNamespace = "pods"
+	podSet.Spec.PersistentVolumeClaimRetentionPolicy = &podsetv1alpha1.PersistentVolumeClaimRetentionPolicy{
+		WhenScaled:  whenScaled,
+		WhenDeleted: whenDeleted,
+	}
+	podSet.Finalizers = []string{podSetFinalizer}
+	return podSet
+}
+
+// ordinalTestPod returns the PodSet's pod of the ordinal, with its claim
+// volumes.
+func ordinalTestPod(podSet *podsetv1alpha1.PodSet, ordinal int) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Name = ordinalPodName(podSet, ordinal)
+	pod.Namespace = podNamespace(podSet)
+	addClaimVolumes(podSet, pod)
+	return pod
+}
+
+// claimOwners maps the names of the claims in the namespace pods to the UID
+// of the PodSet that owns them, if any.
+func claimOwners(t *testing.T, r *PodSetReconciler) map[string]string {
+	t.Helper()
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(context.Background(), claims, client.InNamespace("pods")); err != nil {
+		t.Fatal(err)
+	}
+	owners := map[string]string{}
+	for _, claim := range claims.Items {
+		owners[claim.Name] = claim.Labels[ownerUIDLabel]
+	}
+	return owners
+}
+
+func claimNames(owners map[string]string) []string {
+	names := []string{}
+	for name := range owners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestClaimRetentionPolicy(t *testing.T) {
+	retain, remove := podsetv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType, podsetv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType
+	for _, tc := range []struct {
+		name                    string
+		whenScaled, whenDeleted podsetv1alpha1.PersistentVolumeClaimRetentionPolicyType
+		afterScaleDown          []string
+		afterDelete             []string
+	}{
+		{"retain, retain", retain, retain, []string{"data-web-0", "data-web-1"}, []string{"data-web-0", "data-web-1"}},
+		{"retain, delete", retain, remove, []string{"data-web-0", "data-web-1"}, []string{}},
+		{"delete, retain", remove, retain, []string{"data-web-0"}, []string{"data-web-0"}},
+		{"delete, delete", remove, remove, []string{"data-web-0"}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			podSet := retentionTestPodSet("1", tc.whenScaled, tc.whenDeleted)
+			r := newTestReconciler(t, podSet)
+			ctx := context.Background()
+			for ordinal := 0; ordinal < 2; ordinal++ {
+				if err := r.createClaims(ctx, podSet, ordinalTestPod(podSet, ordinal)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Scaled down from 2 to 1, web-1 is gone.
+			if err := r.pruneClaims(ctx, podSet, []corev1.Pod{*ordinalTestPod(podSet, 0)}); err != nil {
+				t.Fatal(err)
+			}
+			if got := claimNames(claimOwners(t, r)); !reflect.DeepEqual(got, tc.afterScaleDown) {
+				t.Errorf("claims after scale-down = %v, want %v", got, tc.afterScaleDown)
+			}
+
+			if err := r.Delete(ctx, podSet); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(podSet), podSet); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.finalize(ctx, podSet); err != nil {
+				t.Fatal(err)
+			}
+			owners := claimOwners(t, r)
+			if got := claimNames(owners); !reflect.DeepEqual(got, tc.afterDelete) {
+				t.Errorf("claims after deletion = %v, want %v", got, tc.afterDelete)
+			}
+			for name, owner := range owners {
+				if owner != "" {
+					t.Errorf("retained claim %s still owned by %s, want it released", name, owner)
+				}
+			}
+		})
+	}
+}
+
+func TestRetainedClaimReattaches(t *testing.T) {
+	retain := podsetv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType
+	old := retentionTestPodSet("1", retain, retain)
+	r := newTestReconciler(t, old)
+	ctx := context.Background()
+	if err := r.createClaims(ctx, old, ordinalTestPod(old, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(old), old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.finalize(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// A PodSet of the same name recreates the pod of ordinal 0, which
+	// mounts the retained claim, now adopted by the new PodSet.
+	recreated := retentionTestPodSet("2", retain, retain)
+	controllerutil.RemoveFinalizer(recreated, podSetFinalizer)
+	pod := ordinalTestPod(recreated, 0)
+	if err := r.createClaims(ctx, recreated, pod); err != nil {
+		t.Fatal(err)
+	}
+	if volume := pod.Spec.Volumes[0].PersistentVolumeClaim; volume == nil || volume.ClaimName != "data-web-0" {
+		t.Errorf("pod volumes = %+v, want data-web-0 mounted", pod.Spec.Volumes)
+	}
+	if owners := claimOwners(t, r); !reflect.DeepEqual(owners, map[string]string{"data-web-0": "web-2"}) {
+		t.Errorf("claim owners = %v, want data-web-0 adopted by the recreated PodSet", owners)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+)
+
+// applyVolumes adds spec.volumes to the pod, skipping those the template
+// defines, and spec.volumeMounts to the containers and init containers they
+// name, skipping mount paths a container already uses.
+func applyVolumes(cr *podsetv1alpha1.PodSet, pod *corev1.Pod) {
+	defined := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		defined[volume.Name] = true
+	}
+	for _, volume := range cr.Spec.Volumes {
+		if !defined[volume.Name] {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, *volume.DeepCopy())
+			defined[volume.Name] = true
+		}
+	}
+	for _, mounts := range cr.Spec.VolumeMounts {
+		for i := range pod.Spec.InitContainers {
+			addVolumeMounts(mounts, &pod.Spec.InitContainers[i])
+		}
+		for i := range pod.Spec.Containers {
+			addVolumeMounts(mounts, &pod.Spec.Containers[i])
+		}
+	}
+}
+
+// addVolumeMounts adds mounts to the container if it names it.
+func addVolumeMounts(mounts podsetv1alpha1.ContainerVolumeMountsSpec, container *corev1.Container) {
+	if mounts.ContainerName != "" && mounts.ContainerName != container.Name {
+		return
+	}
+	used := map[string]bool{}
+	for _, mount := range container.VolumeMounts {
+		used[mount.MountPath] = true
+	}
+	for _, mount := range mounts.VolumeMounts {
+		if !used[mount.MountPath] {
+			container.VolumeMounts = append(container.VolumeMounts, *mount.DeepCopy())
+			used[mount.MountPath] = true
+		}
+	}
+}
@@ -18,20 +18,34 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/go-logr/logr"
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	podsetv1alpha1 "github.com/asmacdo/podset-operator/api/v1alpha1"
+	podsetv1beta1 "github.com/asmacdo/podset-operator/api/v1beta1"
 	"github.com/asmacdo/podset-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -45,29 +59,197 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(podsetv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(podsetv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
 	var metricsAddr string
+	var secureMetrics bool
+	var metricsCertDir string
 	var enableLeaderElection bool
 	var probeAddr string
+	var podNamesLimit int
+	var podConfigRefreshInterval time.Duration
+	var createConcurrency int
+	var maxConcurrentReconciles int
+	var maxCreatesPerReconcile int
+	var allowedTargetNamespaces string
+	var cleanupHookHosts string
+	var capacityCheck bool
+	var createQPS float64
+	var createBurst int
+	var flapWindow time.Duration
+	var flapThreshold int
+	var flapStabilization time.Duration
+	var createFailureLimit int
+	var reconcileInterval time.Duration
+	var scopePodCache bool
+	var retryBaseDelay time.Duration
+	var retryMaxDelay time.Duration
+	var retryQPS float64
+	var retryBurst int
+	var inPlaceResize bool
+	var scaleDownGuardPercent int
+	var scaleDownGuardPods int
+	var sweepInterval time.Duration
+	var sweepMinPodAge time.Duration
+	var sweepDelete bool
+	var sweepDeleteQPS float64
+	var debugAddr string
+	var shardIndex int
+	var shardTotal int
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.BoolVar(&secureMetrics, "metrics-secure", false,
+		"Serve the metrics endpoint over TLS to clients authorized to get /metrics, checked with TokenReviews "+
+			"and SubjectAccessReviews, instead of over plain HTTP to anyone.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "",
+		"Directory holding the tls.crt and tls.key of the secure metrics endpoint. "+
+			"Defaults to the webhook server's certificate directory.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&createConcurrency, "create-concurrency", 5,
+		"Maximum number of pod creates issued concurrently for a single PodSet.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Number of PodSets reconciled concurrently. A single PodSet is never reconciled by two workers at once.")
+	flag.IntVar(&maxCreatesPerReconcile, "max-creates-per-reconcile", 500,
+		"Maximum number of pods created for a PodSet in a single reconcile; the rest are created on the next. "+
+			"Zero means no limit.")
+	flag.StringVar(&allowedTargetNamespaces, "allowed-target-namespaces", "",
+		"Comma-separated namespaces, other than their own, that PodSets may create pods in. "+
+			"Use \"*\" to allow any namespace.")
+	flag.StringVar(&cleanupHookHosts, "cleanup-hook-hosts", "",
+		"Comma-separated hosts that the cleanup hooks of PodSets may call. Use \"*\" to allow any host. "+
+			"Hooks to other hosts are skipped.")
+	flag.IntVar(&podNamesLimit, "pod-names-limit", 0,
+		"Maximum number of pod names written to each PodSet's status. "+
+			"Zero means no limit and a negative value omits the list entirely.")
+	flag.DurationVar(&podConfigRefreshInterval, "pod-config-refresh-interval", 10*time.Second,
+		"Minimum time between rewrites of a PodSet's per-pod ConfigMaps.")
+	flag.BoolVar(&capacityCheck, "capacity-check", false,
+		"Estimate the free capacity of the cluster before scaling up and create only the pods that fit.")
+	flag.Float64Var(&createQPS, "create-qps", 0,
+		"Maximum rate of pod creates per second across all PodSets. Zero means no limit.")
+	flag.IntVar(&createBurst, "create-burst", 10,
+		"Number of pod creates allowed in a burst above --create-qps.")
+	flag.DurationVar(&flapWindow, "flap-window", time.Hour,
+		"Window over which changes of a PodSet's scale direction are counted to detect flapping.")
+	flag.IntVar(&flapThreshold, "flap-threshold", 6,
+		"Number of scale direction changes within --flap-window above which a PodSet is flapping.")
+	flag.DurationVar(&flapStabilization, "flap-stabilization", 0,
+		"Hold off scale-downs of a flapping PodSet until its scale direction has been stable this long. "+
+			"Zero disables the hold.")
+	flag.IntVar(&createFailureLimit, "create-failure-limit", 5,
+		"Number of consecutive failed attempts to create a PodSet's pods after which they are no longer created "+
+			"until its spec changes.")
+	flag.DurationVar(&reconcileInterval, "reconcile-interval", 0,
+		"Reconcile each PodSet again this long after each reconcile, even without a watch event, to correct drift. "+
+			"Zero reconciles only on events. A PodSet's spec.reconcileInterval takes precedence.")
+	flag.BoolVar(&scopePodCache, "scope-pod-cache", false,
+		"Cache only the pods the operator created, identified by their template hash label, rather than every pod "+
+			"in the cluster. Pods without the label, such as orphans matching a PodSet's selector, are not adopted, "+
+			"and --capacity-check lists pods from the API server.")
+	flag.DurationVar(&retryBaseDelay, "retry-base-delay", 5*time.Millisecond,
+		"Delay before the first retry of a failed reconcile of a PodSet; it doubles with each further failure.")
+	flag.DurationVar(&retryMaxDelay, "retry-max-delay", 1000*time.Second,
+		"Longest delay between retries of a failed reconcile of a PodSet.")
+	flag.Float64Var(&retryQPS, "retry-qps", 10,
+		"Maximum rate of retries and requeues per second across all PodSets.")
+	flag.IntVar(&retryBurst, "retry-burst", 100,
+		"Number of retries and requeues allowed in a burst above --retry-qps.")
+	flag.BoolVar(&inPlaceResize, "in-place-resize", false,
+		"Update the container resources of existing pods in place when they are all that changed in a PodSet's "+
+			"pod template. Requires the InPlacePodVerticalScaling feature.")
+	flag.IntVar(&scaleDownGuardPercent, "scale-down-guard-percent", 0,
+		"Largest reduction of a PodSet's replicas, as a percentage, that the webhook admits in one update "+
+			"without the podset.example.com/confirm-scale-down annotation. Zero disables the check.")
+	flag.IntVar(&scaleDownGuardPods, "scale-down-guard-pods", 0,
+		"Largest number of pods that the webhook admits removing from a PodSet in one update "+
+			"without the podset.example.com/confirm-scale-down annotation. Zero disables the check.")
+	flag.DurationVar(&sweepInterval, "sweep-interval", 10*time.Minute,
+		"Time between sweeps for managed pods whose PodSet no longer exists. Zero disables the sweeper.")
+	flag.DurationVar(&sweepMinPodAge, "sweep-min-pod-age", 10*time.Minute,
+		"Age below which the sweeper leaves a pod alone, whether or not its PodSet exists.")
+	flag.BoolVar(&sweepDelete, "sweep-delete", false,
+		"Delete the pods the sweeper finds rather than only reporting them through events and metrics.")
+	flag.Float64Var(&sweepDeleteQPS, "sweep-delete-qps", 1,
+		"Maximum rate of deletes per second by the sweeper.")
+	flag.StringVar(&debugAddr, "debug-addr", "",
+		"Loopback address, such as 127.0.0.1:8082, to serve a JSON view of the operator's PodSets and "+
+			"the runtime log level on. Empty disables the debug endpoint.")
+	flag.IntVar(&shardIndex, "shard-index", 0,
+		"Index of this replica among --shard-total replicas that split the PodSets between them. "+
+			"A negative value takes the ordinal suffix of the pod's hostname, as set for a StatefulSet.")
+	flag.IntVar(&shardTotal, "shard-total", 1,
+		"Number of operator replicas that split the PodSets between them, each reconciling its own. "+
+			"Leader election must be disabled when this is more than one.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	// The level is shared by every logger so that the debug endpoint can
+	// change it while the operator runs.
+	logLevel, ok := opts.Level.(uberzap.AtomicLevel)
+	if !ok {
+		logLevel = uberzap.NewAtomicLevelAt(zapcore.InfoLevel)
+		if opts.Development {
+			logLevel.SetLevel(zapcore.DebugLevel)
+		}
+	}
+	opts.Level = logLevel
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	logLevels := &controllers.LogLevels{
+		Level: logLevel,
+		NewLogger: func(level zapcore.LevelEnabler) logr.Logger {
+			overridden := opts
+			overridden.Level = level
+			return zap.New(zap.UseFlagOptions(&overridden))
+		},
+	}
+
+	if shardTotal > 1 {
+		if enableLeaderElection {
+			setupLog.Error(nil, "--leader-elect cannot be used with --shard-total greater than one")
+			os.Exit(1)
+		}
+		if shardIndex < 0 {
+			ordinal, err := hostnameOrdinal()
+			if err != nil {
+				setupLog.Error(err, "unable to determine the shard index from the hostname")
+				os.Exit(1)
+			}
+			shardIndex = ordinal
+		}
+		if shardIndex >= shardTotal {
+			setupLog.Error(nil, "--shard-index must be less than --shard-total", "shardIndex", shardIndex, "shardTotal", shardTotal)
+			os.Exit(1)
+		}
+		setupLog.Info("reconciling a shard of the PodSets", "shardIndex", shardIndex, "shardTotal", shardTotal)
+	}
 
+	// The secure endpoint is served by its own runnable below, so the
+	// manager's plaintext one is turned off.
+	managerMetricsAddr := metricsAddr
+	if secureMetrics {
+		managerMetricsAddr = "0"
+	}
+
+	var newCache cache.NewCacheFunc
+	if scopePodCache {
+		newCache = cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Pod{}: {Label: controllers.ManagedPodSelector()},
+			},
+		})
+	}
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
+		NewCache:               newCache,
+		MetricsBindAddress:     managerMetricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -89,13 +271,112 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.PodSetReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	if secureMetrics {
+		if metricsCertDir == "" {
+			metricsCertDir = mgr.GetWebhookServer().CertDir
+		}
+		if metricsCertDir == "" {
+			// The webhook server's own default, which it applies only
+			// when it starts.
+			metricsCertDir = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+		}
+		if err := mgr.Add(&controllers.SecureMetricsServer{
+			BindAddress:          metricsAddr,
+			CertDir:              metricsCertDir,
+			TokenReviews:         clientset.AuthenticationV1(),
+			SubjectAccessReviews: clientset.AuthorizationV1(),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up secure metrics server")
+			os.Exit(1)
+		}
+	}
+
+	var createLimiter *rate.Limiter
+	if createQPS > 0 {
+		createLimiter = rate.NewLimiter(rate.Limit(createQPS), createBurst)
+	}
+	// The same shape as the controller-runtime default, with its delays and
+	// rate taken from the flags.
+	retryLimiter := workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(retryBaseDelay, retryMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(retryQPS), retryBurst)},
+	)
+
+	reconciler := &controllers.PodSetReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("podset-controller"),
+		Pods:      clientset.CoreV1(),
+		APIReader: mgr.GetAPIReader(),
+
+		AllowedTargetNamespaces:  splitList(allowedTargetNamespaces),
+		CleanupHookHosts:         splitList(cleanupHookHosts),
+		CreateConcurrency:        createConcurrency,
+		MaxConcurrentReconciles:  maxConcurrentReconciles,
+		MaxCreatesPerReconcile:   maxCreatesPerReconcile,
+		PodNamesLimit:            podNamesLimit,
+		PodConfigRefreshInterval: podConfigRefreshInterval,
+		CapacityCheck:            capacityCheck,
+		ScopedPodCache:           scopePodCache,
+		CreateLimiter:            createLimiter,
+		RateLimiter:              retryLimiter,
+		RetryBaseDelay:           retryBaseDelay,
+		RetryMaxDelay:            retryMaxDelay,
+		FlapWindow:               flapWindow,
+		FlapThreshold:            flapThreshold,
+		FlapStabilization:        flapStabilization,
+		CreateFailureLimit:       createFailureLimit,
+		ReconcileInterval:        reconcileInterval,
+		InPlaceResize:            inPlaceResize,
+		LogLevels:                logLevels,
+		ShardIndex:               shardIndex,
+		ShardTotal:               shardTotal,
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PodSet")
 		os.Exit(1)
 	}
+	if debugAddr != "" {
+		if err := mgr.Add(&controllers.DebugServer{
+			Addr:       debugAddr,
+			Reader:     mgr.GetClient(),
+			Reconciler: reconciler,
+			LogLevels:  logLevels,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up debug server")
+			os.Exit(1)
+		}
+	}
+	if sweepInterval > 0 {
+		if err := mgr.Add(&controllers.PodSweeper{
+			Client:        mgr.GetClient(),
+			Reader:        mgr.GetAPIReader(),
+			Recorder:      mgr.GetEventRecorderFor("podset-sweeper"),
+			Interval:      sweepInterval,
+			MinPodAge:     sweepMinPodAge,
+			Delete:        sweepDelete,
+			DeleteLimiter: rate.NewLimiter(rate.Limit(sweepDeleteQPS), 1),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up pod sweeper")
+			os.Exit(1)
+		}
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		guard := podsetv1alpha1.ScaleDownGuard{
+			MaxPercent: int32(scaleDownGuardPercent),
+			MaxPods:    int32(scaleDownGuardPods),
+		}
+		if err = (&podsetv1alpha1.PodSet{}).SetupWebhookWithManager(mgr, guard, splitList(allowedTargetNamespaces)); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PodSet")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -113,3 +394,29 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// hostnameOrdinal returns the ordinal suffix of the hostname, which is the
+// pod name for a StatefulSet replica such as podset-controller-manager-2.
+func hostnameOrdinal() (int, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	i := strings.LastIndex(hostname, "-")
+	ordinal, err := strconv.Atoi(hostname[i+1:])
+	if err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("hostname %q has no ordinal suffix", hostname)
+	}
+	return ordinal, nil
+}